@@ -0,0 +1,122 @@
+// backend/alert.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 告警 Webhook 的消息格式
+const (
+	AlertTypeWebhook = "webhook" // 原样 POST InfectionAlert 的 JSON
+	AlertTypeSlack   = "slack"   // Slack Incoming Webhook: {"text": ...}
+	AlertTypeDiscord = "discord" // Discord Webhook: {"content": ...}
+)
+
+// alertQueueSize 是等待发送的告警数量上限，队列满时丢弃新告警而不是阻塞上传
+const alertQueueSize = 100
+
+// InfectionAlert 描述一次感染文件检测，ClientIP 在后台重扫时为空
+type InfectionAlert struct {
+	AccessCode string    `json:"accessCode"`
+	VirusName  string    `json:"virusName"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+	Source     string    `json:"source"` // upload 或 rescan
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// AlertNotifier 在后台协程中把感染告警发送到配置的 Webhook。
+// nil 表示未配置告警，此时 NotifyInfected 不做任何处理
+type AlertNotifier struct {
+	url    string
+	kind   string
+	client *http.Client
+	queue  chan InfectionAlert
+}
+
+// NewAlertNotifier 根据配置创建告警发送器，未配置 URL 时返回 nil
+func NewAlertNotifier(config AlertWebhookConfig) (*AlertNotifier, error) {
+	if strings.TrimSpace(config.URL) == "" {
+		return nil, nil
+	}
+	kind := strings.ToLower(strings.TrimSpace(config.Type))
+	switch kind {
+	case "":
+		kind = AlertTypeWebhook
+	case AlertTypeWebhook, AlertTypeSlack, AlertTypeDiscord:
+	default:
+		return nil, fmt.Errorf("不支持的告警类型 (AlertWebhook.Type): %s", config.Type)
+	}
+	n := &AlertNotifier{
+		url:    config.URL,
+		kind:   kind,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan InfectionAlert, alertQueueSize),
+	}
+	go n.run()
+	slog.Info("已启用感染文件告警", "type", kind)
+	return n, nil
+}
+
+// NotifyInfected 将告警放入发送队列后立即返回，不会阻塞调用方
+func (n *AlertNotifier) NotifyInfected(alert InfectionAlert) {
+	if n == nil {
+		return
+	}
+	if alert.DetectedAt.IsZero() {
+		alert.DetectedAt = time.Now()
+	}
+	select {
+	case n.queue <- alert:
+	default:
+		slog.Warn("告警队列已满，丢弃感染文件告警", "accessCode", alert.AccessCode, "virusName", alert.VirusName)
+	}
+}
+
+func (n *AlertNotifier) run() {
+	for alert := range n.queue {
+		if err := n.send(alert); err != nil {
+			slog.Error("发送感染文件告警失败", "accessCode", alert.AccessCode, "error", err)
+		}
+	}
+}
+
+func (n *AlertNotifier) send(alert InfectionAlert) error {
+	var payload interface{} = alert
+	switch n.kind {
+	case AlertTypeSlack:
+		payload = map[string]string{"text": alert.text()}
+	case AlertTypeDiscord:
+		payload = map[string]string{"content": alert.text()}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook 返回 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// text 生成 Slack/Discord 使用的纯文本消息
+func (a InfectionAlert) text() string {
+	clientIP := a.ClientIP
+	if clientIP == "" {
+		clientIP = "-"
+	}
+	return fmt.Sprintf("[TempShare] 检测到感染文件 (%s)\n分享码: %s\n病毒: %s\n客户端 IP: %s\n时间: %s",
+		a.Source, a.AccessCode, a.VirusName, clientIP, a.DetectedAt.Format(time.RFC3339))
+}
@@ -0,0 +1,427 @@
+// backend/b2.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// --- Backblaze B2 Storage Implementation ---
+
+// b2MinPartSize 是 B2 大文件分片的最小尺寸 (最后一个分片除外)
+const b2MinPartSize = 5 * 1024 * 1024
+
+// B2Storage 通过 Backblaze B2 原生 API (b2api/v2) 存储文件。小于 PartSizeMB 的文件用 b2_upload_file 一次上传，
+// 更大的文件按分片上传 (b2_start_large_file)，每次只在内存中缓冲一个分片，不缓冲整个文件。
+// 授权令牌 24 小时后过期，过期时自动重新授权
+type B2Storage struct {
+	config   B2Config
+	prefix   string
+	partSize int
+	http     *http.Client
+
+	mu   sync.Mutex
+	auth b2Auth
+}
+
+// b2Auth 是 b2_authorize_account 返回的授权信息，以及 Bucket 对应的 bucketId
+type b2Auth struct {
+	AccountID          string `json:"accountId"`
+	AuthorizationToken string `json:"authorizationToken"`
+	APIURL             string `json:"apiUrl"`
+	DownloadURL        string `json:"downloadUrl"`
+	bucketID           string
+}
+
+// b2Error 是 B2 API 出错时返回的 JSON。实现 HTTPStatusCode，使重试装饰器能识别 5xx 和 429
+type b2Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *b2Error) Error() string {
+	return fmt.Sprintf("B2 返回 %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func (e *b2Error) HTTPStatusCode() int { return e.Status }
+
+// b2FileInfo 是 b2_list_file_names 和 b2_list_file_versions 返回的文件条目
+type b2FileInfo struct {
+	FileID   string `json:"fileId"`
+	FileName string `json:"fileName"`
+	Action   string `json:"action"`
+}
+
+func NewB2Storage(config StorageConfig) (*B2Storage, error) {
+	s := &B2Storage{
+		config:   config.B2,
+		prefix:   config.KeyPrefix,
+		partSize: config.B2.PartSizeMB * 1024 * 1024,
+		http:     &http.Client{},
+	}
+	// 启动时授权一次，同时确认桶存在且密钥有权访问
+	if _, err := s.authorize(context.Background(), ""); err != nil {
+		return nil, fmt.Errorf("B2 授权失败: %w", err)
+	}
+	slog.Info("使用 Backblaze B2 存储", "bucket", config.B2.Bucket, "partSizeMB", config.B2.PartSizeMB, "keyPrefix", config.KeyPrefix)
+	return s, nil
+}
+
+// b2EscapeName 按 B2 的要求对文件名做 URL 编码，保留路径分隔符 "/"
+func b2EscapeName(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.QueryEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// readB2Error 把非 2xx 响应转换为 *b2Error，响应体不是 B2 的错误 JSON 时 (例如 HEAD 请求) 只保留状态码
+func readB2Error(resp *http.Response) error {
+	apiErr := &b2Error{}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(apiErr)
+	apiErr.Status = resp.StatusCode
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
+
+// isB2AuthExpired 判断请求是否因授权令牌失效而失败，此时重新授权后可以重试
+func isB2AuthExpired(err error) bool {
+	var apiErr *b2Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized &&
+		(apiErr.Code == "expired_auth_token" || apiErr.Code == "bad_auth_token")
+}
+
+// authorize 返回当前的授权信息。stale 非空且等于当前令牌时 (即该令牌已被服务端拒绝) 重新授权，
+// 并发请求同时发现令牌过期时只会重新授权一次
+func (s *B2Storage) authorize(ctx context.Context, stale string) (b2Auth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.auth.AuthorizationToken != "" && s.auth.AuthorizationToken != stale {
+		return s.auth, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(s.config.AuthURL, "/")+"/b2api/v2/b2_authorize_account", nil)
+	if err != nil {
+		return b2Auth{}, err
+	}
+	req.SetBasicAuth(s.config.AccountID, s.config.ApplicationKey)
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return b2Auth{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return b2Auth{}, readB2Error(resp)
+	}
+	var auth b2Auth
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return b2Auth{}, fmt.Errorf("解析授权响应失败: %w", err)
+	}
+
+	// bucketId 不随令牌变化，只在首次授权时查询
+	auth.bucketID = s.auth.bucketID
+	if auth.bucketID == "" {
+		var buckets struct {
+			Buckets []struct {
+				BucketID string `json:"bucketId"`
+			} `json:"buckets"`
+		}
+		body := map[string]string{"accountId": auth.AccountID, "bucketName": s.config.Bucket}
+		if err := s.post(ctx, auth, "b2_list_buckets", body, &buckets); err != nil {
+			return b2Auth{}, fmt.Errorf("查询桶 %s 失败: %w", s.config.Bucket, err)
+		}
+		if len(buckets.Buckets) == 0 {
+			return b2Auth{}, fmt.Errorf("桶 %s 不存在或密钥无权访问", s.config.Bucket)
+		}
+		auth.bucketID = buckets.Buckets[0].BucketID
+	}
+	s.auth = auth
+	return auth, nil
+}
+
+// post 以给定的授权调用一次 B2 API (POST JSON)，out 非 nil 时解析响应
+func (s *B2Storage) post(ctx context.Context, auth b2Auth, operation string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.APIURL+"/b2api/v2/"+operation, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth.AuthorizationToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readB2Error(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// call 调用 B2 API，令牌过期时重新授权并重试一次。body 根据授权信息生成请求体 (例如填入 bucketId)
+func (s *B2Storage) call(ctx context.Context, operation string, body func(auth b2Auth) interface{}, out interface{}) error {
+	auth, err := s.authorize(ctx, "")
+	if err != nil {
+		return err
+	}
+	err = s.post(ctx, auth, operation, body(auth), out)
+	if isB2AuthExpired(err) {
+		if auth, err = s.authorize(ctx, auth.AuthorizationToken); err != nil {
+			return err
+		}
+		err = s.post(ctx, auth, operation, body(auth), out)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	return nil
+}
+
+// download 向下载端点发送 GET 或 HEAD 请求，令牌过期时重新授权并重试一次。404 转换为 gorm.ErrRecordNotFound
+func (s *B2Storage) download(ctx context.Context, method, key string) (*http.Response, error) {
+	var stale string
+	for attempt := 0; attempt < 2; attempt++ {
+		auth, err := s.authorize(ctx, stale)
+		if err != nil {
+			return nil, err
+		}
+		fileURL := auth.DownloadURL + "/file/" + url.PathEscape(s.config.Bucket) + "/" + b2EscapeName(s.prefix+key)
+		req, err := http.NewRequestWithContext(ctx, method, fileURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", auth.AuthorizationToken)
+		resp, err := s.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		err = readB2Error(resp)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, gorm.ErrRecordNotFound
+		case resp.StatusCode == http.StatusUnauthorized && (method == http.MethodHead || isB2AuthExpired(err)):
+			// HEAD 响应没有错误体，无法区分令牌过期和其他授权错误，一律重新授权后再试一次
+			stale = auth.AuthorizationToken
+		default:
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("B2 重新授权后请求仍被拒绝")
+}
+
+// upload 把 data 作为整个文件 (b2_upload_file) 或大文件的一个分片 (b2_upload_part) 上传
+func (s *B2Storage) upload(ctx context.Context, uploadURL, token string, headers map[string]string, data []byte) error {
+	sum := sha1.Sum(data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Authorization", token)
+	req.Header.Set("X-Bz-Content-Sha1", hex.EncodeToString(sum[:]))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readB2Error(resp)
+	}
+	return nil
+}
+
+// b2UploadURL 是 b2_get_upload_url 和 b2_get_upload_part_url 的响应。上传地址不能被并发请求共用，每次上传单独获取
+type b2UploadURL struct {
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// Save 先读取一个分片大小的数据: 文件不超过一个分片时直接上传，否则逐个分片上传，内存中最多缓冲一个分片
+func (s *B2Storage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	name := s.prefix + key
+	br := bufio.NewReader(&contextReader{ctx: ctx, r: reader})
+	part := make([]byte, s.partSize)
+	n, err := io.ReadFull(br, part)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("B2 存储读取数据流失败: %w", err)
+	}
+	if _, peekErr := br.Peek(1); err != nil || peekErr == io.EOF {
+		var target b2UploadURL
+		if err := s.call(ctx, "b2_get_upload_url", func(auth b2Auth) interface{} {
+			return map[string]string{"bucketId": auth.bucketID}
+		}, &target); err != nil {
+			return 0, fmt.Errorf("B2 存储上传文件失败: %w", err)
+		}
+		headers := map[string]string{"X-Bz-File-Name": b2EscapeName(name), "Content-Type": "b2/x-auto"}
+		if err := s.upload(ctx, target.UploadURL, target.AuthorizationToken, headers, part[:n]); err != nil {
+			return 0, fmt.Errorf("B2 存储上传文件失败: %w", err)
+		}
+		return int64(n), nil
+	}
+	return s.saveLarge(ctx, name, br, part)
+}
+
+// saveLarge 以大文件 API 上传: part 中已是第一个完整分片。任何一步失败都会取消大文件，释放已上传的分片
+func (s *B2Storage) saveLarge(ctx context.Context, name string, br *bufio.Reader, part []byte) (total int64, err error) {
+	var large struct {
+		FileID string `json:"fileId"`
+	}
+	if err := s.call(ctx, "b2_start_large_file", func(auth b2Auth) interface{} {
+		return map[string]string{"bucketId": auth.bucketID, "fileName": name, "contentType": "b2/x-auto"}
+	}, &large); err != nil {
+		return 0, fmt.Errorf("B2 存储上传文件失败: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			cancelErr := s.call(context.WithoutCancel(ctx), "b2_cancel_large_file", func(b2Auth) interface{} {
+				return map[string]string{"fileId": large.FileID}
+			}, nil)
+			if cancelErr != nil {
+				slog.Warn("B2 取消未完成的大文件失败", "fileName", name, "error", cancelErr)
+			}
+		}
+	}()
+
+	var target b2UploadURL
+	if err := s.call(ctx, "b2_get_upload_part_url", func(b2Auth) interface{} {
+		return map[string]string{"fileId": large.FileID}
+	}, &target); err != nil {
+		return 0, fmt.Errorf("B2 存储上传文件失败: %w", err)
+	}
+	var sha1s []string
+	n := len(part)
+	for number := 1; n > 0; number++ {
+		sum := sha1.Sum(part[:n])
+		sha1s = append(sha1s, hex.EncodeToString(sum[:]))
+		headers := map[string]string{"X-Bz-Part-Number": strconv.Itoa(number)}
+		if err := s.upload(ctx, target.UploadURL, target.AuthorizationToken, headers, part[:n]); err != nil {
+			return 0, fmt.Errorf("B2 存储上传第 %d 个分片失败: %w", number, err)
+		}
+		total += int64(n)
+		n, err = io.ReadFull(br, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("B2 存储读取数据流失败: %w", err)
+		}
+	}
+	if err := s.call(ctx, "b2_finish_large_file", func(b2Auth) interface{} {
+		return map[string]interface{}{"fileId": large.FileID, "partSha1Array": sha1s}
+	}, nil); err != nil {
+		return 0, fmt.Errorf("B2 存储上传文件失败: %w", err)
+	}
+	return total, nil
+}
+
+func (s *B2Storage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.download(ctx, http.MethodGet, key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("B2 存储读取流失败: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// Delete 删除该文件名的所有版本 (B2 的桶默认保留历史版本，只隐藏或只删最新版本都不会释放空间)
+func (s *B2Storage) Delete(ctx context.Context, key string) error {
+	name := s.prefix + key
+	var listing struct {
+		Files []b2FileInfo `json:"files"`
+	}
+	if err := s.call(ctx, "b2_list_file_versions", func(auth b2Auth) interface{} {
+		return map[string]interface{}{"bucketId": auth.bucketID, "startFileName": name, "prefix": name, "maxFileCount": 1000}
+	}, &listing); err != nil {
+		return fmt.Errorf("B2 存储删除文件失败: %w", err)
+	}
+	for _, file := range listing.Files {
+		if file.FileName != name {
+			continue // prefix 也会匹配以该键开头的其他文件
+		}
+		err := s.call(ctx, "b2_delete_file_version", func(b2Auth) interface{} {
+			return map[string]string{"fileName": file.FileName, "fileId": file.FileID}
+		}, nil)
+		var apiErr *b2Error
+		if err != nil && !(errors.As(err, &apiErr) && apiErr.Code == "file_not_present") {
+			return fmt.Errorf("B2 存储删除文件失败: %w", err)
+		}
+	}
+	return nil // 文件本就不存在，任务完成
+}
+
+func (s *B2Storage) Exists(key string) bool {
+	_, err := s.Size(context.Background(), key)
+	return err == nil
+}
+
+func (s *B2Storage) Size(ctx context.Context, key string) (int64, error) {
+	resp, err := s.download(ctx, http.MethodHead, key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("B2 存储读取文件信息失败: %w", err)
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// Walk 用 b2_list_file_names 分页列出 prefix 下的文件，只包含已上传完成的最新版本
+func (s *B2Storage) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	start := s.prefix + prefix
+	for {
+		var page struct {
+			Files        []b2FileInfo `json:"files"`
+			NextFileName *string      `json:"nextFileName"`
+		}
+		if err := s.call(ctx, "b2_list_file_names", func(auth b2Auth) interface{} {
+			return map[string]interface{}{"bucketId": auth.bucketID, "startFileName": start, "prefix": s.prefix + prefix, "maxFileCount": 1000}
+		}, &page); err != nil {
+			return fmt.Errorf("B2 存储列出文件失败: %w", err)
+		}
+		for _, file := range page.Files {
+			if file.Action != "upload" {
+				continue
+			}
+			if err := fn(strings.TrimPrefix(file.FileName, s.prefix)); err != nil {
+				return err
+			}
+		}
+		if page.NextFileName == nil {
+			return nil
+		}
+		start = *page.NextFileName
+	}
+}
@@ -0,0 +1,138 @@
+// backend/b2_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeB2 是只实现上传相关 API 的 B2 服务端，记录每次上传的分片
+type fakeB2 struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu          sync.Mutex
+	singleFiles []int // b2_upload_file 上传的文件大小
+	parts       []int // b2_upload_part 上传的分片大小，按分片编号排列
+	finished    []string
+	canceled    bool
+}
+
+func newFakeB2(t *testing.T) *fakeB2 {
+	f := &fakeB2{t: t}
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("/b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]string{"accountId": "account", "authorizationToken": "token", "apiUrl": f.server.URL, "downloadUrl": f.server.URL})
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"buckets": []map[string]string{{"bucketId": "bucket-id"}}})
+	})
+	mux.HandleFunc("/b2api/v2/b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]string{"uploadUrl": f.server.URL + "/upload/file", "authorizationToken": "upload-token"})
+	})
+	mux.HandleFunc("/b2api/v2/b2_start_large_file", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]string{"fileId": "large-file"})
+	})
+	mux.HandleFunc("/b2api/v2/b2_get_upload_part_url", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]string{"uploadUrl": f.server.URL + "/upload/part", "authorizationToken": "upload-token"})
+	})
+	mux.HandleFunc("/b2api/v2/b2_finish_large_file", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			PartSha1Array []string `json:"partSha1Array"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.finished = body.PartSha1Array
+		f.mu.Unlock()
+		reply(w, map[string]string{"fileId": "large-file"})
+	})
+	mux.HandleFunc("/b2api/v2/b2_cancel_large_file", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.canceled = true
+		f.mu.Unlock()
+		reply(w, map[string]string{"fileId": "large-file"})
+	})
+	mux.HandleFunc("/upload/", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		sum := sha1.Sum(data)
+		if r.Header.Get("X-Bz-Content-Sha1") != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: X-Bz-Content-Sha1 与内容不一致", r.URL.Path)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if r.URL.Path == "/upload/file" {
+			f.singleFiles = append(f.singleFiles, len(data))
+		} else {
+			if number, _ := strconv.Atoi(r.Header.Get("X-Bz-Part-Number")); number != len(f.parts)+1 {
+				t.Errorf("分片编号 = %d, want %d", number, len(f.parts)+1)
+			}
+			f.parts = append(f.parts, len(data))
+		}
+		reply(w, map[string]string{})
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func TestB2SavePartSplitting(t *testing.T) {
+	const partSize = 1024 * 1024
+	tests := []struct {
+		name        string
+		size        int
+		wantSingle  bool
+		wantParts   []int
+		description string
+	}{
+		{"empty", 0, true, nil, "空文件一次上传"},
+		{"one byte below part size", partSize - 1, true, nil, "不足一个分片时一次上传"},
+		{"exactly part size", partSize, true, nil, "正好一个分片时一次上传，不开始大文件"},
+		{"one byte over part size", partSize + 1, false, []int{partSize, 1}, "多出的 1 字节成为最后一个分片"},
+		{"exactly two parts", 2 * partSize, false, []int{partSize, partSize}, "正好两个分片时没有多余的空分片"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeB2(t)
+			storage, err := NewB2Storage(StorageConfig{B2: B2Config{Bucket: "bucket", PartSizeMB: 1, AuthURL: fake.server.URL}})
+			if err != nil {
+				t.Fatalf("NewB2Storage: %v", err)
+			}
+			data := bytes.Repeat([]byte("x"), tt.size)
+			n, err := storage.Save(context.Background(), "key", bytes.NewReader(data))
+			if err != nil || n != int64(tt.size) {
+				t.Fatalf("Save = %d, %v; want %d", n, err, tt.size)
+			}
+
+			if tt.wantSingle {
+				if len(fake.singleFiles) != 1 || fake.singleFiles[0] != tt.size || len(fake.parts) != 0 {
+					t.Fatalf("%s: singleFiles=%v parts=%v", tt.description, fake.singleFiles, fake.parts)
+				}
+				return
+			}
+			if len(fake.singleFiles) != 0 || len(fake.parts) != len(tt.wantParts) {
+				t.Fatalf("%s: singleFiles=%v parts=%v, want parts %v", tt.description, fake.singleFiles, fake.parts, tt.wantParts)
+			}
+			for i := range tt.wantParts {
+				if fake.parts[i] != tt.wantParts[i] {
+					t.Fatalf("%s: parts=%v, want %v", tt.description, fake.parts, tt.wantParts)
+				}
+			}
+			if len(fake.finished) != len(tt.wantParts) || fake.canceled {
+				t.Fatalf("大文件没有正常完成: finished=%d canceled=%v", len(fake.finished), fake.canceled)
+			}
+		})
+	}
+}
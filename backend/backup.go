@@ -0,0 +1,305 @@
+// backend/backup.go
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// backupKeyPrefix 是备份对象的键前缀。备份写入存储后端时与普通文件共用命名空间，fsck 会跳过该前缀
+const backupKeyPrefix = "backups/"
+
+// backupFormatVersion 是备份文件格式的版本，写在第一行的头部中
+const backupFormatVersion = 1
+
+// backupLine 是备份文件 (gzip 压缩的 JSON Lines) 中的一行。第一行只有 Version 和 CreatedAt，
+// 其后每行是一条记录，Row 以 Go 字段名为键保存全部列 (包括 JSON 响应中隐藏的字段)，见 backupFields
+type backupLine struct {
+	Version   int                        `json:"version,omitempty"`
+	CreatedAt *time.Time                 `json:"createdAt,omitempty"`
+	Table     string                     `json:"table,omitempty"`
+	Row       map[string]json.RawMessage `json:"row,omitempty"`
+}
+
+// backupTables 是需要备份的表。恢复时按表名找到对应的模型
+var backupTables = map[string]func() interface{}{
+	"files":   func() interface{} { return &File{} },
+	"reports": func() interface{} { return &Report{} },
+}
+
+// backupFields 按 Go 字段名收集结构体的全部持久化字段 (展开嵌入的 gorm.Model，跳过 gorm:"-")。
+// 不使用 json 标签，因为 StorageKey、PasswordHash 等字段在 API 响应中是隐藏的，但恢复记录时必不可少
+func backupFields(v reflect.Value, out map[string]json.RawMessage) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("gorm") == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := backupFields(v.Field(i), out); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := json.Marshal(v.Field(i).Interface())
+		if err != nil {
+			return fmt.Errorf("序列化字段 %s 失败: %w", field.Name, err)
+		}
+		out[field.Name] = data
+	}
+	return nil
+}
+
+// restoreFields 是 backupFields 的逆操作，备份中没有的字段保持零值，多余的字段被忽略
+func restoreFields(v reflect.Value, row map[string]json.RawMessage) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("gorm") == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := restoreFields(v.Field(i), row); err != nil {
+				return err
+			}
+			continue
+		}
+		data, ok := row[field.Name]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(data, v.Field(i).Addr().Interface()); err != nil {
+			return fmt.Errorf("解析字段 %s 失败: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// writeBackup 把 files 和 reports 表分批写成 gzip 压缩的 JSON Lines
+func writeBackup(db *gorm.DB, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	now := time.Now().UTC()
+	if err := enc.Encode(backupLine{Version: backupFormatVersion, CreatedAt: &now}); err != nil {
+		return err
+	}
+	writeRows := func(table string, value reflect.Value) error {
+		for i := 0; i < value.Len(); i++ {
+			row := make(map[string]json.RawMessage)
+			if err := backupFields(value.Index(i), row); err != nil {
+				return err
+			}
+			if err := enc.Encode(backupLine{Table: table, Row: row}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var files []File
+	if err := db.FindInBatches(&files, migrateBatchSize, func(tx *gorm.DB, _ int) error {
+		return writeRows("files", reflect.ValueOf(files))
+	}).Error; err != nil {
+		return fmt.Errorf("导出文件记录失败: %w", err)
+	}
+	var reports []Report
+	if err := db.FindInBatches(&reports, migrateBatchSize, func(tx *gorm.DB, _ int) error {
+		return writeRows("reports", reflect.ValueOf(reports))
+	}).Error; err != nil {
+		return fmt.Errorf("导出举报记录失败: %w", err)
+	}
+	return gz.Close()
+}
+
+// backupStorage 返回备份的目标存储: 配置了 LocalDir 时写入该本地目录，否则写入文件所在的存储后端
+func backupStorage(config BackupConfig, storage FileStorage) (FileStorage, error) {
+	if config.LocalDir == "" {
+		return storage, nil
+	}
+	return NewLocalStorage(StorageConfig{LocalPath: config.LocalDir})
+}
+
+// runBackup 导出一份备份并按 Retention 删除最旧的备份，返回新备份的键。
+// 数据库内容以流的方式写入存储，不在内存或本地磁盘中缓存整个备份
+func runBackup(ctx context.Context, db *gorm.DB, storage FileStorage, retention int) (string, error) {
+	key := backupKeyPrefix + "tempshare-" + time.Now().UTC().Format("20060102T150405Z") + ".jsonl.gz"
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(writeBackup(db, pw)) }()
+	size, err := storage.Save(ctx, key, pr)
+	pr.CloseWithError(err) // 写入失败时让导出的 goroutine 退出
+	if err != nil {
+		storage.Delete(context.WithoutCancel(ctx), key)
+		return "", fmt.Errorf("写入备份失败: %w", err)
+	}
+	slog.Info("数据库备份完成", "key", key, "sizeBytes", size)
+	if retention > 0 {
+		if err := pruneBackups(ctx, storage, retention); err != nil {
+			slog.Error("删除旧备份失败", "error", err)
+		}
+	}
+	return key, nil
+}
+
+// listBackups 返回已有备份的键，按时间从旧到新排列 (键中的时间戳可以按字典序比较)
+func listBackups(ctx context.Context, storage FileStorage) ([]string, error) {
+	var keys []string
+	err := storage.Walk(ctx, backupKeyPrefix, func(key string) error {
+		if strings.HasSuffix(key, ".jsonl.gz") {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+// pruneBackups 只保留最新的 retention 份备份
+func pruneBackups(ctx context.Context, storage FileStorage, retention int) error {
+	keys, err := listBackups(ctx, storage)
+	if err != nil {
+		return err
+	}
+	for len(keys) > retention {
+		if err := storage.Delete(ctx, keys[0]); err != nil {
+			return fmt.Errorf("删除备份 %s 失败: %w", keys[0], err)
+		}
+		slog.Info("已删除超出保留数量的旧备份", "key", keys[0])
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// BackupTask 按 IntervalHours 定期备份文件和举报记录，启动时先备份一次。
+// 存储对象本身不在备份范围内；数据库丢失而存储完好时，可用 `tempshare restore` 重建记录
+func BackupTask(db *gorm.DB, storage FileStorage, config BackupConfig) {
+	if !config.Enabled {
+		return
+	}
+	target, err := backupStorage(config, storage)
+	if err != nil {
+		slog.Error("备份目标初始化失败，定期备份未启动", "error", err)
+		return
+	}
+	ticker := time.NewTicker(time.Duration(config.IntervalHours) * time.Hour)
+	defer ticker.Stop()
+	for {
+		if _, err := runBackup(context.Background(), db, target, config.Retention); err != nil {
+			slog.Error("定期备份失败", "error", err)
+		}
+		<-ticker.C
+	}
+}
+
+// runBackupCommand 实现 `tempshare backup [--list]`: 立即按 Backup 配置导出一份备份，--list 只列出已有备份
+func runBackupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	list := fs.Bool("list", false, "列出已有备份 (从旧到新)")
+	fs.Parse(args)
+
+	storage, err := NewFileStorage(AppConfig().Storage)
+	if err != nil {
+		return fmt.Errorf("存储后端初始化失败: %w", err)
+	}
+	target, err := backupStorage(AppConfig().Backup, storage)
+	if err != nil {
+		return fmt.Errorf("备份目标初始化失败: %w", err)
+	}
+	ctx := context.Background()
+	if *list {
+		keys, err := listBackups(ctx, target)
+		if err != nil {
+			return fmt.Errorf("列出备份失败: %w", err)
+		}
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+		return nil
+	}
+	db, err := ConnectDatabase(AppConfig().Database)
+	if err != nil {
+		return fmt.Errorf("数据库初始化失败: %w", err)
+	}
+	_, err = runBackup(ctx, db, target, AppConfig().Backup.Retention)
+	return err
+}
+
+// runRestore 实现 `tempshare restore <备份键>`: 把备份中的记录写回数据库。主键已存在的记录会被跳过，
+// 因此可以恢复到部分丢失的数据库，重复运行也不会产生重复记录。备份键可通过 `tempshare backup --list` 查看
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("用法: tempshare restore <备份键>")
+	}
+	key := fs.Arg(0)
+
+	storage, err := NewFileStorage(AppConfig().Storage)
+	if err != nil {
+		return fmt.Errorf("存储后端初始化失败: %w", err)
+	}
+	source, err := backupStorage(AppConfig().Backup, storage)
+	if err != nil {
+		return fmt.Errorf("备份目标初始化失败: %w", err)
+	}
+	db, err := ConnectDatabase(AppConfig().Database)
+	if err != nil {
+		return fmt.Errorf("数据库初始化失败: %w", err)
+	}
+	rc, err := source.Retrieve(context.Background(), key)
+	if err != nil {
+		return fmt.Errorf("读取备份 %s 失败: %w", key, err)
+	}
+	defer rc.Close()
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		return fmt.Errorf("备份 %s 不是有效的 gzip 文件: %w", key, err)
+	}
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	restored := make(map[string]int64)
+	for line := 1; scanner.Scan(); line++ {
+		var entry backupLine
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("备份第 %d 行格式错误: %w", line, err)
+		}
+		if line == 1 {
+			if entry.Version != backupFormatVersion {
+				return fmt.Errorf("不支持的备份格式版本: %d", entry.Version)
+			}
+			continue
+		}
+		newModel, ok := backupTables[entry.Table]
+		if !ok {
+			return fmt.Errorf("备份第 %d 行包含未知的表: %q", line, entry.Table)
+		}
+		record := newModel()
+		if err := restoreFields(reflect.ValueOf(record).Elem(), entry.Row); err != nil {
+			return fmt.Errorf("备份第 %d 行: %w", line, err)
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return fmt.Errorf("备份第 %d 行写入数据库失败: %w", line, result.Error)
+		}
+		restored[entry.Table] += result.RowsAffected
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取备份失败: %w", err)
+	}
+	slog.Info("备份恢复完成", "key", key, "files", restored["files"], "reports", restored["reports"])
+	return nil
+}
@@ -0,0 +1,220 @@
+// backend/batch.go
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errFileTooLarge 表示批量上传中的单个文件超过了 MaxUploadSizeMB
+var errFileTooLarge = errors.New("文件超过大小限制")
+
+// BatchUploadResult 是批量上传中单个文件的处理结果，失败时 Error 非空
+type BatchUploadResult struct {
+	Filename    string `json:"filename"`
+	AccessCode  string `json:"accessCode,omitempty"`
+	URLPath     string `json:"urlPath,omitempty"`
+	ManageToken string `json:"manageToken,omitempty"`
+	ScanStatus  string `json:"scanStatus,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorCode   string `json:"errorCode,omitempty"`
+}
+
+// fileSizeLimitReader 在读取超过 limit 字节时返回 errFileTooLarge
+type fileSizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *fileSizeLimitReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, errFileTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// HandleBatchUpload 接收包含多个文件 part 的 multipart 请求，逐个存储并扫描。
+// X-File-Expires-In、X-File-Expiry-Label、X-File-Download-Once、X-File-Burn-On-View、X-File-Password-Hash、X-File-Public、X-File-Tags、X-File-Allowed-Countries、X-File-Notify 和 X-File-Description 作用于批次中的所有文件；
+// 也可以在文件 part 之前加入名为 description 的表单字段，为其后的文件设置说明 (覆盖 X-File-Description)。
+// 批量上传不支持端到端加密。部分文件失败时返回 207，并在对应条目中给出错误。
+func (h *FileHandler) HandleBatchUpload(c *gin.Context) {
+	cfg := AppConfig()
+	maxUploadBytes := cfg.MaxUploadSizeMB * 1024 * 1024
+	maxFiles := cfg.MaxBatchFiles
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes*int64(maxFiles))
+
+	expiresInSeconds, _ := strconv.ParseInt(c.GetHeader("X-File-Expires-In"), 10, 64)
+	downloadOnce, _ := strconv.ParseBool(c.GetHeader("X-File-Download-Once"))
+	burnOnView, _ := strconv.ParseBool(c.GetHeader("X-File-Burn-On-View"))
+	isPublic, _ := strconv.ParseBool(c.GetHeader("X-File-Public"))
+	passwordHash := c.GetHeader("X-File-Password-Hash")
+	if passwordHash != "" {
+		if err := ValidatePasswordHash(passwordHash); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidPasswordHash))
+			return
+		}
+	}
+	if !allowedExpiresIn(c.GetHeader("X-File-Expires-In")) {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgExpiryNotPreset, strings.Join(AppConfig().ExpiryPresets, ", ")))
+		return
+	}
+	expiryLabel, err := parseExpiryLabel(c.GetHeader("X-File-Expiry-Label"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidExpiryLabel, MaxExpiryLabelLength))
+		return
+	}
+	tags, err := parseFileTags(c.GetHeader("X-File-Tags"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidFileTags, MaxFileTags, MaxFileTagKeyLen, MaxFileTagValueLen))
+		return
+	}
+	allowedCountries, err := parseAllowedCountries(c.GetHeader("X-File-Allowed-Countries"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidCountries, MaxAllowedCountries))
+		return
+	}
+	notifyTarget, err := parseNotifyTarget(c.GetHeader("X-File-Notify"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidNotifyTarget, MaxNotifyTargetLength))
+		return
+	}
+	notifyEvery, _ := strconv.ParseBool(c.GetHeader("X-File-Notify-Every"))
+	description, err := parseFileDescription(c.GetHeader("X-File-Description"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidDescription, cfg.MaxDescriptionLength))
+		return
+	}
+	expiresIn := time.Duration(AppConfig().DefaultExpiryHours) * time.Hour // 上传者未指定时的默认有效期
+	if expiresInSeconds > 0 {
+		expiresIn = time.Duration(expiresInSeconds) * time.Second
+	}
+	if expiryLabel == "" {
+		expiryLabel = expiryLabelFor(expiresIn)
+	}
+	expiresAt := time.Now().Add(expiresIn)
+
+	// 批量上传按整个请求体统计进度，完成后会话中不记录分享码
+	session, body, ok := h.beginTrackedUpload(c)
+	if !ok {
+		return
+	}
+	c.Request.Body = body
+	defer h.Uploads.Finish(session)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgBatchNeedsMultipart))
+		return
+	}
+
+	var results []BatchUploadResult
+	var failed int
+	var retryAfter time.Duration // 有文件因配额不足失败时，建议客户端等待的最长时间
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			requestLogger(c).Warn("批量上传: 读取 multipart 失败", "clientIP", c.ClientIP(), "error", err)
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgBatchInvalidMultipart), gin.H{"results": results})
+			return
+		}
+		fileName := sanitizeFilename(part.FileName())
+		if fileName == "" && part.FormName() == "description" {
+			description, err = readDescriptionPart(part)
+			part.Close()
+			if err != nil {
+				respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidDescription, cfg.MaxDescriptionLength), gin.H{"results": results})
+				return
+			}
+			continue
+		}
+		if fileName == "" {
+			// 其他非文件字段直接忽略
+			part.Close()
+			continue
+		}
+		if len(results) >= maxFiles {
+			part.Close()
+			results = append(results, BatchUploadResult{Filename: fileName, Error: translate(c, msgBatchTooManyFiles, maxFiles), ErrorCode: ErrCodeInvalidRequest})
+			failed++
+			continue
+		}
+
+		body := &fileSizeLimitReader{r: part, remaining: maxUploadBytes}
+		newFile, err := h.storeUpload(c.Request.Context(), c.ClientIP(), body, -1, File{
+			Filename:          fileName,
+			DownloadOnce:      downloadOnce,
+			BurnOnView:        burnOnView,
+			PasswordProtected: passwordHash != "",
+			PasswordHash:      passwordHash,
+			ExpiresAt:         expiresAt,
+			ExpiryLabel:       expiryLabel,
+			Tags:              tags,
+			IsPublic:          &isPublic,
+			AllowedCountries:  allowedCountries,
+			NotifyTarget:      notifyTarget,
+			NotifyEvery:       notifyEvery,
+			Description:       description,
+		})
+		part.Close()
+
+		result := BatchUploadResult{Filename: fileName}
+		switch {
+		case body.remaining < 0:
+			result.Error = translate(c, msgFileTooLarge, cfg.MaxUploadSizeMB)
+			result.ErrorCode = ErrCodeFileTooLarge
+		case err != nil:
+			result.Error, result.ErrorCode = translate(c, msgInternalError), ErrCodeInternal
+			var uploadErr *uploadError
+			if errors.As(err, &uploadErr) {
+				result.Error, result.ErrorCode = uploadErr.localized(c), uploadErr.code
+				if uploadErr.status == http.StatusInsufficientStorage {
+					retryAfter = max(retryAfter, h.Quota.RetryAfter(uploadErr.code == ErrCodeFileLimitReached))
+				}
+			}
+		default:
+			result.AccessCode = newFile.AccessCode
+			result.URLPath = downloadURLPath(newFile.AccessCode)
+			result.ManageToken = newFile.ManageToken
+			result.ScanStatus = newFile.ScanStatus
+			if newFile.ScanStatus == ScanStatusInfected {
+				result.Error = translate(c, msgFileInfected)
+				result.ErrorCode = ErrCodeFileInfected
+			}
+		}
+		if result.Error != "" {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgBatchNoFiles))
+		return
+	}
+	requestLogger(c).Info("批量上传完成", "clientIP", c.ClientIP(), "total", len(results), "failed", failed)
+	if failed > 0 {
+		if retryAfter > 0 {
+			setRetryAfter(c, retryAfter)
+		}
+		c.JSON(http.StatusMultiStatus, results)
+		return
+	}
+	c.JSON(http.StatusCreated, results)
+}
@@ -0,0 +1,310 @@
+// backend/compress.go
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// incompressibleExtensions 是本身已经压缩过的格式，再做 gzip 只会浪费 CPU
+var incompressibleExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true, ".heic": true,
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".flac": true, ".opus": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".webm": true, ".avi": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".epub": true, ".apk": true, ".jar": true,
+	".pdf": true, ".woff": true, ".woff2": true,
+}
+
+// shouldCompress 根据扩展名和文件头部内容判断是否值得压缩存储，只压缩文本类内容
+func shouldCompress(filename string, head []byte) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if incompressibleExtensions[ext] {
+		return false
+	}
+	contentType := http.DetectContentType(head)
+	if byExt := mime.TypeByExtension(ext); byExt != "" && !strings.HasPrefix(contentType, "text/") {
+		// 扩展名能识别为文本类 (如 .json/.svg) 而嗅探结果不是文本时，以扩展名为准
+		contentType = byExt
+	}
+	return compressibleContentType(contentType)
+}
+
+// compressibleContentType 报告该 MIME 类型是否为值得压缩的文本类内容
+func compressibleContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json", mediaType == "application/xml", mediaType == "application/javascript",
+		mediaType == "application/x-javascript", mediaType == "image/svg+xml", mediaType == "application/x-ndjson":
+		return true
+	}
+	return false
+}
+
+// supportedEncodings 是支持的响应内容编码，按服务器的偏好排列: q 值相同时靠前的优先
+var supportedEncodings = []string{"br", "gzip", "deflate"}
+
+// acceptEncodingWeights 解析 Accept-Encoding，返回每种编码 (小写) 的 q 值。未写 q 或 q 无效时为 1，q=0 表示客户端明确拒绝该编码
+func acceptEncodingWeights(acceptEncoding string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if q, ok := strings.CutPrefix(strings.ReplaceAll(param, " ", ""), "q="); ok {
+				if w, err := strconv.ParseFloat(q, 64); err == nil && w >= 0 && w <= 1 {
+					weight = w
+				}
+			}
+		}
+		weights[name] = weight
+	}
+	return weights
+}
+
+// encodingWeight 返回 encoding 的 q 值: 没有单独列出时取 * 的 q 值，两者都没有时为 0
+func encodingWeight(weights map[string]float64, encoding string) float64 {
+	if w, ok := weights[encoding]; ok {
+		return w
+	}
+	return weights["*"]
+}
+
+// negotiateEncoding 根据 Accept-Encoding 的 q 值选择响应的内容编码 (br、gzip 或 deflate)，
+// q 值相同时依次优先 br、gzip、deflate，都不接受时返回空字符串
+func negotiateEncoding(acceptEncoding string) string {
+	weights := acceptEncodingWeights(acceptEncoding)
+	best, bestWeight := "", 0.0
+	for _, encoding := range supportedEncodings {
+		if w := encodingWeight(weights, encoding); w > bestWeight {
+			best, bestWeight = encoding, w
+		}
+	}
+	return best
+}
+
+// acceptsEncoding 报告客户端是否接受 encoding (q 值大于 0)
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	return encodingWeight(acceptEncodingWeights(acceptEncoding), encoding) > 0
+}
+
+// newEncodingWriter 返回按 encoding 压缩写入 w 的 WriteCloser，调用方必须 Close 以写出剩余数据。
+// HTTP 的 deflate 编码指 zlib 格式 (RFC 1950)，而不是裸 deflate 流
+func newEncodingWriter(w io.Writer, encoding string) io.WriteCloser {
+	switch encoding {
+	case "br":
+		return brotli.NewWriterLevel(w, brotliResponseLevel)
+	case "deflate":
+		return zlib.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+// brotliResponseLevel 是动态响应使用的 brotli 压缩级别。更高的级别压缩率提升有限但 CPU 开销成倍增加
+const brotliResponseLevel = 5
+
+// countingReader 统计经过的字节数，用于记录压缩前的原始大小
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// gzipStorage 在写入时以 gzip 流式压缩，读取时解压；Delete/Exists 直接交给底层存储。
+// 只有 File.Compressed 为 true 的对象才应通过它读取，见 retrieveFile
+type gzipStorage struct {
+	FileStorage
+}
+
+// Save 通过管道边压缩边写入，返回值为压缩后实际写入存储的字节数
+func (g gzipStorage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	pr, pw := io.Pipe()
+	defer pr.Close() // 存储提前失败时让压缩协程退出
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, reader)
+		if closeErr := zw.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	return g.FileStorage.Save(ctx, key, pr)
+}
+
+func (g gzipStorage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := g.FileStorage.Retrieve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: zr, underlying: rc}, nil
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	underlying io.Closer
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.underlying.Close()
+}
+
+// retrieveFile 读取文件内容，压缩存储的文件会被透明解压
+func retrieveFile(ctx context.Context, storage FileStorage, file File) (io.ReadCloser, error) {
+	if file.Compressed {
+		return gzipStorage{storage}.Retrieve(ctx, file.StorageKey)
+	}
+	return storage.Retrieve(ctx, file.StorageKey)
+}
+
+// contentLength 返回文件解压后的大小，即下载时的 Content-Length
+func (f File) contentLength() int64 {
+	if f.Compressed {
+		return f.OriginalSizeBytes
+	}
+	return f.SizeBytes
+}
+
+// ResponseCompressionMiddleware 按 Accept-Encoding 以 br、gzip 或 deflate 压缩 JSON、文本等响应。先缓冲 minBytes 字节再决定是否压缩:
+// 响应不足 minBytes、类型不可压缩 (图片等二进制内容) 或处理函数已经设置了 Content-Encoding (例如预览直接发送压缩存储的内容) 时原样发送。
+// 压缩时删除 Content-Length，以分块编码发送。文件下载 (/data) 不经过此中间件
+func ResponseCompressionMiddleware(minBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		w := &compressResponseWriter{ResponseWriter: c.Writer, encoding: encoding, minBytes: minBytes}
+		c.Writer = w
+		defer w.finish()
+		c.Next()
+	}
+}
+
+// compressResponseWriter 缓冲响应开头的数据，在 decide 中决定是否压缩后再写出响应头
+type compressResponseWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minBytes int
+	buf      []byte
+	decided  bool
+	encoder  io.WriteCloser
+	size     int
+}
+
+func (w *compressResponseWriter) Write(data []byte) (int, error) {
+	w.size += len(data)
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.minBytes {
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 推迟到 decide 中执行，此时才能确定是否需要修改 Content-Encoding 和 Content-Length
+func (w *compressResponseWriter) WriteHeaderNow() {}
+
+func (w *compressResponseWriter) Written() bool {
+	return w.decided || len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Size 返回处理函数写入的 (压缩前) 字节数
+func (w *compressResponseWriter) Size() int {
+	if !w.Written() {
+		return -1
+	}
+	return w.size
+}
+
+// Flush 在流式响应 (例如分批导出的 CSV) 中立即做出决定并把已压缩的数据推送给客户端
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide 根据已缓冲的数据和响应头决定是否压缩，写出响应头和缓冲的数据
+func (w *compressResponseWriter) decide() error {
+	w.decided = true
+	header := w.Header()
+	status := w.Status()
+	if len(w.buf) > 0 && len(w.buf) >= w.minBytes && header.Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified &&
+		compressibleContentType(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		// 压缩后的表示与原内容不同，强 ETag 降级为弱 ETag
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.encoder = newEncodingWriter(w.ResponseWriter, w.encoding)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// finish 在处理函数返回后写出剩余的缓冲数据并结束压缩流
+func (w *compressResponseWriter) finish() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
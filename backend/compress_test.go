@@ -0,0 +1,203 @@
+// backend/compress_test.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip, deflate", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=1.0, gzip;q=0.8", "br"},
+		{"deflate;q=0.9, gzip;q=0.1", "deflate"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.5, br;q=0", "gzip"},
+		{"gzip;q=0, *", "br"},
+		{"BR ; q = 0.7 , GZIP;q=0.6", "br"},
+		{"br;q=abc", "br"},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.acceptEncoding); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	if !acceptsEncoding("br, gzip;q=0.1", "gzip") {
+		t.Error("q=0.1 的 gzip 应视为接受")
+	}
+	if acceptsEncoding("br, gzip;q=0", "gzip") || acceptsEncoding("br", "gzip") {
+		t.Error("拒绝或未列出的 gzip 不应视为接受")
+	}
+}
+
+func TestResponseCompressionMiddlewareBrotli(t *testing.T) {
+	payload := strings.Repeat(`{"accessCode":"ABC123"}`, 100)
+	router := gin.New()
+	router.Use(ResponseCompressionMiddleware(64))
+	router.GET("/api/v1/info", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(payload))
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/info", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	router.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("Content-Encoding = %q, want br", w.Header().Get("Content-Encoding"))
+	}
+	body, err := io.ReadAll(brotli.NewReader(w.Body))
+	if err != nil {
+		t.Fatalf("无法解压 brotli 响应: %v", err)
+	}
+	if string(body) != payload {
+		t.Fatalf("解压后的响应与原内容不一致")
+	}
+}
+
+func TestResponseCompressionMiddlewareMinSize(t *testing.T) {
+	const minBytes = 64
+	tests := []struct {
+		name         string
+		contentType  string
+		size         int
+		encoding     string // 处理函数自己设置的 Content-Encoding
+		wantCompress bool
+	}{
+		{"below min size", "application/json", minBytes - 1, "", false},
+		{"exactly min size", "application/json", minBytes, "", true},
+		{"crosses min size in chunks", "application/json", 10 * minBytes, "", true},
+		{"not compressible", "image/png", 10 * minBytes, "", false},
+		{"already encoded", "text/plain", 10 * minBytes, "gzip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := strings.Repeat("a", tt.size)
+			router := gin.New()
+			router.Use(ResponseCompressionMiddleware(minBytes))
+			router.GET("/api/v1/info", func(c *gin.Context) {
+				c.Header("Content-Type", tt.contentType)
+				c.Header("Content-Length", strconv.Itoa(len(payload)))
+				if tt.encoding != "" {
+					c.Header("Content-Encoding", tt.encoding)
+				}
+				c.Status(http.StatusOK)
+				// 每次只写 10 字节，直到缓冲的数据达到 minBytes 才决定是否压缩
+				for rest := payload; rest != ""; {
+					n := min(10, len(rest))
+					c.Writer.WriteString(rest[:n])
+					rest = rest[n:]
+				}
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/info", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			router.ServeHTTP(w, req)
+
+			if !tt.wantCompress {
+				if w.Header().Get("Content-Encoding") != tt.encoding {
+					t.Fatalf("Content-Encoding = %q, want %q", w.Header().Get("Content-Encoding"), tt.encoding)
+				}
+				if w.Header().Get("Content-Length") != strconv.Itoa(len(payload)) || w.Body.String() != payload {
+					t.Fatalf("未压缩的响应被修改: Content-Length=%q, body %d 字节", w.Header().Get("Content-Length"), w.Body.Len())
+				}
+				return
+			}
+			if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" || w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Fatalf("压缩响应的响应头不正确: %v", w.Header())
+			}
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("gzip.NewReader: %v", err)
+			}
+			body, err := io.ReadAll(zr)
+			if err != nil || string(body) != payload {
+				t.Fatalf("解压后的响应与原内容不一致: %d 字节, %v", len(body), err)
+			}
+		})
+	}
+}
+
+func TestCompressedStorageRoundTrip(t *testing.T) {
+	withTestConfig(t, func(c *Config) {
+		c.CompressStorage = true
+		c.DefaultExpiryHours = 1
+		c.AccessCodeLength = 6
+		c.AccessCodeCharset = AccessCodeCharsetSafe
+	})
+	dir := t.TempDir()
+	storage, err := NewLocalStorage(StorageConfig{LocalPath: dir})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	db := newTestDB(t, &File{})
+	quota, err := NewStorageQuota(db, storage, 0, false)
+	if err != nil {
+		t.Fatalf("NewStorageQuota: %v", err)
+	}
+	h := &FileHandler{DB: db, Scanner: NoopScanner{}, Storage: storage, Quota: quota}
+	router := gin.New()
+	router.POST("/api/v1/uploads/stream-complete", h.HandleStreamUpload)
+	router.GET("/data/:code", h.HandleDownloadFile)
+
+	content := strings.Repeat("2026-10-16 12:00:00 INFO request served in 12ms\n", 2000)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/uploads/stream-complete", strings.NewReader(content))
+	req.Header.Set("X-File-Name", "server.log")
+	req.Header.Set("X-File-Original-Size", strconv.Itoa(len(content)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("上传失败: %d %s", w.Code, w.Body)
+	}
+
+	var file File
+	if err := db.First(&file).Error; err != nil {
+		t.Fatalf("查询文件记录: %v", err)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, file.StorageKey))
+	if err != nil {
+		t.Fatalf("读取存储对象: %v", err)
+	}
+	if !file.Compressed || file.OriginalSizeBytes != int64(len(content)) || file.SizeBytes != int64(len(stored)) ||
+		file.SizeBytes >= file.OriginalSizeBytes {
+		t.Fatalf("压缩记录不正确: compressed=%v size=%d original=%d stored=%d", file.Compressed, file.SizeBytes, file.OriginalSizeBytes, len(stored))
+	}
+	if !bytes.HasPrefix(stored, []byte{0x1f, 0x8b}) {
+		t.Fatal("存储对象不是 gzip 格式")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data/"+file.AccessCode, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("下载失败: %d %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(content)) {
+		t.Fatalf("Content-Length = %s, want 解压后的大小 %d", got, len(content))
+	}
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != content {
+		t.Fatal("下载的内容不是解压后的原始数据")
+	}
+}
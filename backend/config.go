@@ -6,27 +6,166 @@ import (
 	"fmt"
 	"log/slog"
 	"os" // ✨ 导入 os 包
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
-	"time"
+	"sync/atomic"
 
 	"github.com/spf13/viper"
 )
 
 // --- 结构体定义保持不变 ---
 type RateLimitConfig struct {
+	Enabled         bool          `mapstructure:"Enabled"`
+	Requests        int           `mapstructure:"Requests"`
+	DurationMinutes int           `mapstructure:"DurationMinutes"`
+	Uploads         RateLimitRule `mapstructure:"Uploads"`
+	Downloads       RateLimitRule `mapstructure:"Downloads"`
+	Reports         RateLimitRule `mapstructure:"Reports"`
+	Previews        RateLimitRule `mapstructure:"Previews"`
+}
+
+// RateLimitRule 是单个接口类别的限流规则，Burst 为 0 时等于 Requests
+type RateLimitRule struct {
+	Requests        int `mapstructure:"Requests"`
+	DurationMinutes int `mapstructure:"DurationMinutes"`
+	Burst           int `mapstructure:"Burst"`
+}
+
+// orDefault 在规则未配置时返回 fallback
+func (r RateLimitRule) orDefault(fallback RateLimitRule) RateLimitRule {
+	if r.Requests <= 0 || r.DurationMinutes <= 0 {
+		fallback.Burst = r.Burst
+		return fallback
+	}
+	return r
+}
+
+type AccessControlConfig struct {
+	AllowCIDRs       []string `mapstructure:"AllowCIDRs"`
+	DenyCIDRs        []string `mapstructure:"DenyCIDRs"`
+	ApplyToDownloads bool     `mapstructure:"ApplyToDownloads"`
+}
+type VirusTotalConfig struct {
+	APIKey             string `mapstructure:"APIKey"`
+	UploadUnknown      bool   `mapstructure:"UploadUnknown"`
+	RequestsPerMinute  int    `mapstructure:"RequestsPerMinute"`
+	PollTimeoutSeconds int    `mapstructure:"PollTimeoutSeconds"`
+}
+
+// ScanRetryConfig 控制后台重扫任务: 每 IntervalMinutes 分钟重新扫描处于 pending/error/skipped 状态的文件，
+// 每个文件最多重试 MaxAttempts 次 (0 表示不限制)，第 n 次失败后等待 BackoffMinutes*2^(n-1) 分钟再重试
+type ScanRetryConfig struct {
 	Enabled         bool `mapstructure:"Enabled"`
-	Requests        int  `mapstructure:"Requests"`
-	DurationMinutes int  `mapstructure:"DurationMinutes"`
+	IntervalMinutes int  `mapstructure:"IntervalMinutes"`
+	MaxAttempts     int  `mapstructure:"MaxAttempts"`
+	BackoffMinutes  int  `mapstructure:"BackoffMinutes"`
+}
+
+// IntegrityCheckConfig 控制下载时的存储完整性校验: VerifySize 在发送前比较对象大小与记录的 SizeBytes，
+// VerifyHash 在发送过程中计算 SHA-256 并与上传时记录的 ContentHash 比较 (需要读取全部内容，不一致时只能中断传输)
+type IntegrityCheckConfig struct {
+	VerifySize bool `mapstructure:"VerifySize"`
+	VerifyHash bool `mapstructure:"VerifyHash"`
+}
+
+// E2EEConfig 控制上传端到端加密文件时对客户端参数的校验。服务器看不到密码，只能检查参数格式:
+// VerificationHashLength 是 X-File-Verification-Hash 的十六进制字符数 (默认 64，即 SHA-256)，0 表示不检查格式；
+// MinSaltBytes 是 X-File-Salt (base64) 解码后的最少字节数
+type E2EEConfig struct {
+	VerificationHashLength int `mapstructure:"VerificationHashLength"`
+	MinSaltBytes           int `mapstructure:"MinSaltBytes"`
+}
+
+// BackupConfig 控制文件和举报记录的定期备份。LocalDir 为空时备份写入存储后端的 backups/ 下，
+// 否则写入该本地目录；Retention 是保留的备份份数，0 表示全部保留
+type BackupConfig struct {
+	Enabled       bool   `mapstructure:"Enabled"`
+	IntervalHours int    `mapstructure:"IntervalHours"`
+	LocalDir      string `mapstructure:"LocalDir"`
+	Retention     int    `mapstructure:"Retention"`
+}
+
+// MetaCacheConfig 控制按分享码缓存文件记录的 LRU 缓存 (见 FileMetaCache)。MaxEntries 是缓存的最大记录数，
+// TTLSeconds 是单条记录的最长缓存时间，也是其他进程 (命令行子命令、其他实例) 的修改最多延迟生效的时间
+type MetaCacheConfig struct {
+	Enabled    bool `mapstructure:"Enabled"`
+	MaxEntries int  `mapstructure:"MaxEntries"`
+	TTLSeconds int  `mapstructure:"TTLSeconds"`
+}
+
+// CompressionConfig 控制 JSON、文本等响应的压缩 (按 Accept-Encoding 选择 br、gzip 或 deflate)，MinSizeBytes 以下的响应原样发送。
+// 文件预览 (HandlePreviewFile) 没有单独的开关: 它按同样的 Enabled 和 MinSizeBytes 自行以流式压缩 (不经过中间件的缓冲)，
+// 关闭后只保留直接发送 gzip 压缩存储内容的路径
+type CompressionConfig struct {
+	Enabled      bool `mapstructure:"Enabled"`
+	MinSizeBytes int  `mapstructure:"MinSizeBytes"`
+}
+
+// TracingConfig 控制 OpenTelemetry 追踪: 启用后为每个请求以及其中的存储操作、SQL 语句和 clamd 扫描创建 span，
+// 通过 OTLP/HTTP 发送到 Endpoint (例如 http://otel-collector:4318，未写路径时使用 /v1/traces)。
+// SampleRatio 是对没有上游采样决定的请求的采样比例 (0 到 1)
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"Enabled"`
+	Endpoint    string  `mapstructure:"Endpoint"`
+	ServiceName string  `mapstructure:"ServiceName"`
+	SampleRatio float64 `mapstructure:"SampleRatio"`
+}
+
+// GeoIPConfig 决定如何确定请求来源的国家 (用于 X-File-Allowed-Countries)。DatabasePath 是 MaxMind
+// GeoLite2-Country/GeoIP2-Country 数据库 (.mmdb) 的路径，按客户端 IP 查询；CountryHeader 是受信任代理写入的国家请求头，
+// 请求带有该请求头时优先于数据库。两者都未配置时不支持国家限制
+type GeoIPConfig struct {
+	DatabasePath  string `mapstructure:"DatabasePath"`
+	CountryHeader string `mapstructure:"CountryHeader"`
+}
+type DownloadNotifyConfig struct {
+	Enabled             bool `mapstructure:"Enabled"`
+	AllowPrivateTargets bool `mapstructure:"AllowPrivateTargets"`
+}
+type SMTPConfig struct {
+	Host     string `mapstructure:"Host"`
+	Port     int    `mapstructure:"Port"`
+	Username string `mapstructure:"Username"`
+	Password string `mapstructure:"Password"`
+	From     string `mapstructure:"From"`
+}
+type AlertWebhookConfig struct {
+	URL  string `mapstructure:"URL"`
+	Type string `mapstructure:"Type"`
+}
+type VerificationHashConfig struct {
+	MemoryKB    uint32 `mapstructure:"MemoryKB"`
+	Iterations  uint32 `mapstructure:"Iterations"`
+	Parallelism uint8  `mapstructure:"Parallelism"`
 }
 type DBConfig struct {
 	Type string `mapstructure:"Type"`
 	DSN  string `mapstructure:"DSN"`
+	// SlowQueryThresholdMs 是慢查询日志的阈值 (毫秒)，0 表示不记录
+	SlowQueryThresholdMs int `mapstructure:"SlowQueryThresholdMs"`
 }
 type StorageConfig struct {
-	Type      string       `mapstructure:"Type"`
-	LocalPath string       `mapstructure:"LocalPath"`
-	S3        S3Config     `mapstructure:"S3"`
-	WebDAV    WebDAVConfig `mapstructure:"WebDAV"`
+	Type                   string       `mapstructure:"Type"`
+	LocalPath              string       `mapstructure:"LocalPath"`
+	LocalShard             bool         `mapstructure:"LocalShard"`
+	KeyPrefix              string       `mapstructure:"KeyPrefix"`
+	SaveTimeoutSeconds     int          `mapstructure:"SaveTimeoutSeconds"`
+	RetrieveTimeoutSeconds int          `mapstructure:"RetrieveTimeoutSeconds"`
+	DeleteTimeoutSeconds   int          `mapstructure:"DeleteTimeoutSeconds"`
+	S3                     S3Config     `mapstructure:"S3"`
+	WebDAV                 WebDAVConfig `mapstructure:"WebDAV"`
+	IPFS                   IPFSConfig   `mapstructure:"IPFS"`
+	B2                     B2Config     `mapstructure:"B2"`
+	Retry                  RetryConfig  `mapstructure:"Retry"`
+}
+
+// RetryConfig 控制存储操作遇到暂时性错误时的重试，MaxAttempts 为包括首次在内的总尝试次数，1 表示不重试
+type RetryConfig struct {
+	MaxAttempts      int `mapstructure:"MaxAttempts"`
+	InitialBackoffMs int `mapstructure:"InitialBackoffMs"`
+	MaxBackoffMs     int `mapstructure:"MaxBackoffMs"`
 }
 type S3Config struct {
 	Endpoint        string `mapstructure:"Endpoint"`
@@ -35,6 +174,24 @@ type S3Config struct {
 	AccessKeyID     string `mapstructure:"AccessKeyID"`
 	SecretAccessKey string `mapstructure:"SecretAccessKey"`
 	UsePathStyle    bool   `mapstructure:"UsePathStyle"`
+	// CreateBucketIfMissing 为 true 时在启动时创建不存在的桶，便于 MinIO 等自建存储首次部署
+	CreateBucketIfMissing bool `mapstructure:"CreateBucketIfMissing"`
+	// Fallbacks 是只读的备用端点 (例如跨区域复制的副本)，仅用于 Retrieve 失败时的故障转移
+	Fallbacks []S3Config `mapstructure:"Fallbacks"`
+}
+type IPFSConfig struct {
+	APIURL  string `mapstructure:"APIURL"`
+	MFSRoot string `mapstructure:"MFSRoot"`
+}
+type B2Config struct {
+	// AccountID 可以是主密钥的账户 ID，也可以是应用密钥的 keyID
+	AccountID      string `mapstructure:"AccountID"`
+	ApplicationKey string `mapstructure:"ApplicationKey"`
+	Bucket         string `mapstructure:"Bucket"`
+	// PartSizeMB 是分片上传的分片大小，也是每个上传在内存中缓冲的最大数据量；不超过该大小的文件一次上传
+	PartSizeMB int `mapstructure:"PartSizeMB"`
+	// AuthURL 是 b2_authorize_account 的地址，通常无需修改
+	AuthURL string `mapstructure:"AuthURL"`
 }
 type WebDAVConfig struct {
 	URL      string `mapstructure:"URL"`
@@ -42,18 +199,80 @@ type WebDAVConfig struct {
 	Password string `mapstructure:"Password"`
 }
 type Config struct {
-	ServerPort         string          `mapstructure:"ServerPort"`
-	PublicHost         string          `mapstructure:"PublicHost"`
-	CORSAllowedOrigins string          `mapstructure:"CORS_ALLOWED_ORIGINS"`
-	MaxUploadSizeMB    int64           `mapstructure:"MaxUploadSizeMB"`
-	RateLimit          RateLimitConfig `mapstructure:"RateLimit"`
-	Database           DBConfig        `mapstructure:"Database"`
-	Storage            StorageConfig   `mapstructure:"Storage"`
-	ClamdSocket        string          `mapstructure:"ClamdSocket"`
-	Initialized        bool            `mapstructure:"Initialized"`
+	ServerPort                 string                 `mapstructure:"ServerPort"`
+	PublicHost                 string                 `mapstructure:"PublicHost"`
+	DownloadURLTemplate        string                 `mapstructure:"DownloadURLTemplate"`
+	DownloadLandingPage        bool                   `mapstructure:"DownloadLandingPage"`
+	EnablePublicGallery        bool                   `mapstructure:"EnablePublicGallery"`
+	CORSAllowedOrigins         string                 `mapstructure:"CORS_ALLOWED_ORIGINS"`
+	CORSUploadAllowedOrigins   string                 `mapstructure:"CORS_UPLOAD_ALLOWED_ORIGINS"`
+	CORSPublicAllowedOrigins   string                 `mapstructure:"CORS_PUBLIC_ALLOWED_ORIGINS"`
+	CORSPublicAllowCredentials bool                   `mapstructure:"CORS_PUBLIC_ALLOW_CREDENTIALS"`
+	CORSMaxAgeMinutes          int                    `mapstructure:"CORS_MAX_AGE_MINUTES"`
+	TrustedProxies             []string               `mapstructure:"TrustedProxies"`
+	TrustedHeader              string                 `mapstructure:"TrustedHeader"`
+	TrustedPlatform            string                 `mapstructure:"TrustedPlatform"`
+	RequestTimeoutSeconds      int                    `mapstructure:"RequestTimeoutSeconds"`
+	MaxUploadSizeMB            int64                  `mapstructure:"MaxUploadSizeMB"`
+	MaxBatchFiles              int                    `mapstructure:"MaxBatchFiles"`
+	MaxConcurrentUploads       int                    `mapstructure:"MaxConcurrentUploads"`
+	MaxSnippetSizeKB           int64                  `mapstructure:"MaxSnippetSizeKB"`
+	MaxDescriptionLength       int                    `mapstructure:"MaxDescriptionLength"`
+	BurnOnViewGraceSeconds     int                    `mapstructure:"BurnOnViewGraceSeconds"`
+	CompressStorage            bool                   `mapstructure:"CompressStorage"`
+	MaxDataURISizeMB           int64                  `mapstructure:"MaxDataURISizeMB"`
+	PreviewMimeTypes           map[string]string      `mapstructure:"PreviewMimeTypes"`
+	AccessCodeLength           int                    `mapstructure:"AccessCodeLength"`
+	AccessCodeCharset          string                 `mapstructure:"AccessCodeCharset"`
+	MaxTotalStorageGB          int64                  `mapstructure:"MaxTotalStorageGB"`
+	MaxActiveFiles             int                    `mapstructure:"MaxActiveFiles"`
+	EvictOldest                bool                   `mapstructure:"EvictOldest"`
+	MaxScanSizeMB              int64                  `mapstructure:"MaxScanSizeMB"`
+	ScanEncryptedBlobs         bool                   `mapstructure:"ScanEncryptedBlobs"`
+	QuarantineDeleteAfterHours int                    `mapstructure:"QuarantineDeleteAfterHours"`
+	ReportTakedownThreshold    int                    `mapstructure:"ReportTakedownThreshold"`
+	IdempotencyKeyTTLHours     int                    `mapstructure:"IdempotencyKeyTTLHours"`
+	DownloadSigningSecret      string                 `mapstructure:"DownloadSigningSecret"`
+	ExpiredCodeResponse        string                 `mapstructure:"ExpiredCodeResponse"`
+	DefaultExpiryHours         int                    `mapstructure:"DefaultExpiryHours"`
+	ExpiryPresets              []string               `mapstructure:"ExpiryPresets"`
+	StrictExpiryPresets        bool                   `mapstructure:"StrictExpiryPresets"`
+	MaintenanceMode            bool                   `mapstructure:"MaintenanceMode"`
+	LogLevel                   string                 `mapstructure:"LogLevel"`
+	LogFormat                  string                 `mapstructure:"LogFormat"`
+	RateLimit                  RateLimitConfig        `mapstructure:"RateLimit"`
+	AccessControl              AccessControlConfig    `mapstructure:"AccessControl"`
+	Database                   DBConfig               `mapstructure:"Database"`
+	Storage                    StorageConfig          `mapstructure:"Storage"`
+	IntegrityCheck             IntegrityCheckConfig   `mapstructure:"IntegrityCheck"`
+	E2EE                       E2EEConfig             `mapstructure:"E2EE"`
+	Backup                     BackupConfig           `mapstructure:"Backup"`
+	MetaCache                  MetaCacheConfig        `mapstructure:"MetaCache"`
+	ScannerType                string                 `mapstructure:"ScannerType"`
+	ClamdSocket                string                 `mapstructure:"ClamdSocket"`
+	ClamdMaxConcurrentScans    int                    `mapstructure:"ClamdMaxConcurrentScans"`
+	ScanTempDir                string                 `mapstructure:"ScanTempDir"`
+	ScanTempMaxAgeMinutes      int                    `mapstructure:"ScanTempMaxAgeMinutes"`
+	VirusTotal                 VirusTotalConfig       `mapstructure:"VirusTotal"`
+	ScanRetry                  ScanRetryConfig        `mapstructure:"ScanRetry"`
+	AlertWebhook               AlertWebhookConfig     `mapstructure:"AlertWebhook"`
+	GeoIP                      GeoIPConfig            `mapstructure:"GeoIP"`
+	ResponseCompression        CompressionConfig      `mapstructure:"ResponseCompression"`
+	DownloadNotify             DownloadNotifyConfig   `mapstructure:"DownloadNotify"`
+	SMTP                       SMTPConfig             `mapstructure:"SMTP"`
+	VerificationHash           VerificationHashConfig `mapstructure:"VerificationHash"`
+	Tracing                    TracingConfig          `mapstructure:"Tracing"`
+	Initialized                bool                   `mapstructure:"Initialized"`
 }
 
-var AppConfig *Config
+// appConfig 保存当前生效的配置。重新加载 (SIGHUP) 时整体替换为新的 *Config，从不修改已发布的对象，
+// 请求中取得的配置在处理期间保持一致
+var appConfig atomic.Pointer[Config]
+
+// AppConfig 返回当前生效的配置，返回值只读
+func AppConfig() *Config {
+	return appConfig.Load()
+}
 
 func LoadConfig(path string) error {
 	viper.SetEnvPrefix("TEMPSHARE")
@@ -62,19 +281,154 @@ func LoadConfig(path string) error {
 
 	viper.SetDefault("ServerPort", "8080")
 	viper.SetDefault("PublicHost", "")
+	viper.SetDefault("DownloadURLTemplate", "/download/{code}")
+	viper.SetDefault("DownloadLandingPage", false)
+	viper.SetDefault("EnablePublicGallery", true)
 	viper.SetDefault("CORS_ALLOWED_ORIGINS", "https://localhost:5173")
+	viper.SetDefault("CORS_UPLOAD_ALLOWED_ORIGINS", "")
+	viper.SetDefault("CORS_PUBLIC_ALLOWED_ORIGINS", "")
+	viper.SetDefault("CORS_PUBLIC_ALLOW_CREDENTIALS", true)
+	viper.SetDefault("CORS_MAX_AGE_MINUTES", 720)
+	viper.SetDefault("TrustedProxies", []string{})
+	viper.SetDefault("TrustedHeader", "X-Forwarded-For")
+	viper.SetDefault("TrustedPlatform", "")
 	viper.SetDefault("MaxUploadSizeMB", 1024)
+	viper.SetDefault("MaxBatchFiles", 10)
+	viper.SetDefault("MaxConcurrentUploads", 0)
+	viper.SetDefault("MaxSnippetSizeKB", 512)
+	viper.SetDefault("MaxDescriptionLength", 500) // 按字符计；URL 编码后的中文约 9 字节/字，需留意反向代理的请求头大小限制
+	viper.SetDefault("MaxDataURISizeMB", 10)
+	viper.SetDefault("BurnOnViewGraceSeconds", 300)
+	viper.SetDefault("CompressStorage", false)
+	viper.SetDefault("AccessCodeLength", 6)
+	viper.SetDefault("AccessCodeCharset", AccessCodeCharsetSafe)
+	viper.SetDefault("MaxTotalStorageGB", 0)
+	viper.SetDefault("EvictOldest", false)
+	viper.SetDefault("MaxActiveFiles", 0) // 0 表示不限制
+	viper.SetDefault("RequestTimeoutSeconds", 30)
 	viper.SetDefault("RateLimit.Enabled", true)
 	viper.SetDefault("RateLimit.Requests", 30)
 	viper.SetDefault("RateLimit.DurationMinutes", 10)
+	for _, group := range []string{"Uploads", "Downloads", "Reports", "Previews"} {
+		viper.SetDefault("RateLimit."+group+".Requests", 0)
+		viper.SetDefault("RateLimit."+group+".DurationMinutes", 0)
+		viper.SetDefault("RateLimit."+group+".Burst", 0)
+	}
+	viper.SetDefault("AccessControl.AllowCIDRs", []string{})
+	viper.SetDefault("AccessControl.DenyCIDRs", []string{})
+	viper.SetDefault("AccessControl.ApplyToDownloads", false)
 	viper.SetDefault("Database.Type", "sqlite")
 	viper.SetDefault("Database.DSN", "data/tempshare.db")
+	viper.SetDefault("Database.SlowQueryThresholdMs", 200)
 	viper.SetDefault("Storage.Type", "local")
 	viper.SetDefault("Storage.LocalPath", "data/files")
+	viper.SetDefault("Storage.LocalShard", false)
+	viper.SetDefault("Storage.KeyPrefix", "")
+	viper.SetDefault("Storage.S3.Endpoint", "")
+	viper.SetDefault("Storage.S3.Region", "")
+	viper.SetDefault("Storage.S3.Bucket", "")
+	viper.SetDefault("Storage.S3.AccessKeyID", "")
+	viper.SetDefault("Storage.S3.SecretAccessKey", "")
 	viper.SetDefault("Storage.S3.UsePathStyle", true)
+	viper.SetDefault("Storage.S3.CreateBucketIfMissing", false)
+	viper.SetDefault("Storage.WebDAV.URL", "")
+	viper.SetDefault("Storage.WebDAV.Username", "")
+	viper.SetDefault("Storage.WebDAV.Password", "")
+	viper.SetDefault("Storage.IPFS.APIURL", "http://127.0.0.1:5001")
+	viper.SetDefault("Storage.IPFS.MFSRoot", "/tempshare")
+	viper.SetDefault("Storage.B2.AccountID", "")
+	viper.SetDefault("Storage.B2.ApplicationKey", "")
+	viper.SetDefault("Storage.B2.Bucket", "")
+	viper.SetDefault("Storage.B2.PartSizeMB", 16)
+	viper.SetDefault("Storage.B2.AuthURL", "https://api.backblazeb2.com")
+	viper.SetDefault("Storage.SaveTimeoutSeconds", 0)
+	viper.SetDefault("Storage.RetrieveTimeoutSeconds", 0)
+	viper.SetDefault("Storage.DeleteTimeoutSeconds", 30)
+	viper.SetDefault("Storage.Retry.MaxAttempts", 3)
+	viper.SetDefault("Storage.Retry.InitialBackoffMs", 200)
+	viper.SetDefault("Storage.Retry.MaxBackoffMs", 5000)
+	viper.SetDefault("IntegrityCheck.VerifySize", true)
+	viper.SetDefault("IntegrityCheck.VerifyHash", false)
+	viper.SetDefault("E2EE.VerificationHashLength", 64)
+	viper.SetDefault("E2EE.MinSaltBytes", 16)
+	viper.SetDefault("Backup.Enabled", false)
+	viper.SetDefault("Backup.IntervalHours", 24)
+	viper.SetDefault("Backup.LocalDir", "")
+	viper.SetDefault("Backup.Retention", 7)
+	viper.SetDefault("MetaCache.Enabled", false)
+	viper.SetDefault("MetaCache.MaxEntries", 1000)
+	viper.SetDefault("MetaCache.TTLSeconds", 30)
+	viper.SetDefault("ScannerType", "auto")
 	viper.SetDefault("ClamdSocket", "")
+	viper.SetDefault("ClamdMaxConcurrentScans", 0) // 0 表示不限制
+	viper.SetDefault("ScanTempDir", filepath.Join(os.TempDir(), "tempshare-scans"))
+	viper.SetDefault("ScanTempMaxAgeMinutes", 60)
+	viper.SetDefault("VirusTotal.APIKey", "")
+	viper.SetDefault("VirusTotal.UploadUnknown", false)
+	viper.SetDefault("VirusTotal.RequestsPerMinute", 4)
+	viper.SetDefault("VirusTotal.PollTimeoutSeconds", 60)
+	viper.SetDefault("ScanRetry.Enabled", true)
+	viper.SetDefault("ScanRetry.IntervalMinutes", 30)
+	viper.SetDefault("ScanRetry.MaxAttempts", 5)
+	viper.SetDefault("ScanRetry.BackoffMinutes", 30)
+	viper.SetDefault("AlertWebhook.URL", "")
+	viper.SetDefault("AlertWebhook.Type", AlertTypeWebhook)
+	viper.SetDefault("GeoIP.DatabasePath", "")
+	viper.SetDefault("GeoIP.CountryHeader", "")
+	viper.SetDefault("ResponseCompression.Enabled", true)
+	viper.SetDefault("ResponseCompression.MinSizeBytes", 1024)
+	viper.SetDefault("DownloadNotify.Enabled", false)
+	viper.SetDefault("DownloadNotify.AllowPrivateTargets", false)
+	viper.SetDefault("SMTP.Host", "")
+	viper.SetDefault("SMTP.Port", 587)
+	viper.SetDefault("SMTP.Username", "")
+	viper.SetDefault("SMTP.Password", "")
+	viper.SetDefault("SMTP.From", "")
+	// OWASP 推荐的 argon2id 最低参数 (19 MiB, t=2, p=1)
+	viper.SetDefault("VerificationHash.MemoryKB", 19*1024)
+	viper.SetDefault("VerificationHash.Iterations", 2)
+	viper.SetDefault("VerificationHash.Parallelism", 1)
+	viper.SetDefault("Tracing.Enabled", false)
+	viper.SetDefault("Tracing.Endpoint", "")
+	viper.SetDefault("Tracing.ServiceName", "tempshare")
+	viper.SetDefault("Tracing.SampleRatio", 1.0)
+	viper.SetDefault("MaxScanSizeMB", 25) // 与 clamd 默认的 StreamMaxLength 保持一致
+	viper.SetDefault("ScanEncryptedBlobs", false)
+	viper.SetDefault("QuarantineDeleteAfterHours", 0)
+	viper.SetDefault("ReportTakedownThreshold", 0)
+	viper.SetDefault("IdempotencyKeyTTLHours", 24)
+	viper.SetDefault("DownloadSigningSecret", "")
+	viper.SetDefault("ExpiredCodeResponse", ExpiredCodeResponseGeneric)
+	viper.SetDefault("DefaultExpiryHours", 7*24)
+	// 与前端默认提供的有效期选项一致
+	viper.SetDefault("ExpiryPresets", []string{"3m", "10m", "1h", "24h", "7d"})
+	viper.SetDefault("StrictExpiryPresets", false)
+	viper.SetDefault("MaintenanceMode", false)
+	viper.SetDefault("LogLevel", "info")
+	viper.SetDefault("LogFormat", LogFormatJSON)
 	viper.SetDefault("Initialized", false)
+	bindConfigEnv(reflect.TypeOf(Config{}), "")
+
+	cfg, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	appConfig.Store(cfg)
+
+	slog.Info("配置加载完成",
+		slog.String("serverPort", cfg.ServerPort),
+		slog.String("dbType", cfg.Database.Type),
+		slog.String("storageType", cfg.Storage.Type),
+		slog.Bool("initialized", cfg.Initialized),
+		slog.String("allowedOrigins", cfg.CORSAllowedOrigins),
+	)
 
+	return nil
+}
+
+// readConfig 读取配置文件并与环境变量、默认值合并，返回新的 Config。LoadConfig 注册默认值之后，
+// 重新加载配置时也通过它读取
+func readConfig(path string) (*Config, error) {
 	viper.SetConfigFile(path)
 	viper.SetConfigType("json")
 
@@ -87,28 +441,231 @@ func LoadConfig(path string) error {
 			slog.Info("配置文件 config.json 未找到，将完全依赖环境变量和默认值。这在 Docker 环境下是正常行为。")
 		} else {
 			// 如果是其他错误 (例如 JSON 格式无效)，这是一个严重错误，必须返回它
-			return fmt.Errorf("解析配置文件 %s 时发生致命错误: %w", path, err)
+			return nil, fmt.Errorf("解析配置文件 %s 时发生致命错误: %w", path, err)
 		}
 	} else {
 		slog.Info("成功从文件加载配置", "path", path)
 	}
 
-	AppConfig = &Config{}
-	if err := viper.Unmarshal(&AppConfig); err != nil {
-		return fmt.Errorf("将配置解析到结构体时失败: %w", err)
+	if err := loadSecretFiles(reflect.TypeOf(Config{}), ""); err != nil {
+		return nil, err
 	}
 
-	slog.Info("配置加载完成",
-		slog.String("serverPort", AppConfig.ServerPort),
-		slog.String("dbType", AppConfig.Database.Type),
-		slog.String("storageType", AppConfig.Storage.Type),
-		slog.Bool("initialized", AppConfig.Initialized),
-		slog.String("allowedOrigins", AppConfig.CORSAllowedOrigins),
-	)
+	cfg := &Config{}
+	if err := viper.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("将配置解析到结构体时失败: %w", err)
+	}
+	return cfg, nil
+}
 
-	return nil
+// Validate 检查启动服务前必须正确的配置项，一次返回所有问题 (用 errors.Join 合并)，每条都指出对应的配置键，
+// 避免修好一项重启后才发现下一项。只检查配置本身，不连接数据库、存储等外部服务
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.ServerPort); err != nil || port < 1 || port > 65535 {
+		add("ServerPort 必须是 1 到 65535 之间的端口号，当前为 %q", c.ServerPort)
+	}
+	if c.AccessCodeLength < MinAccessCodeLength || c.AccessCodeLength > MaxAccessCodeLength {
+		add("AccessCodeLength 必须在 %d 到 %d 之间，当前为 %d", MinAccessCodeLength, MaxAccessCodeLength, c.AccessCodeLength)
+	}
+	if _, err := accessCodeAlphabet(c.AccessCodeCharset); err != nil {
+		add("AccessCodeCharset: %w", err)
+	}
+	switch strings.ToLower(c.ExpiredCodeResponse) {
+	case ExpiredCodeResponseGeneric, ExpiredCodeResponseDistinct:
+	default:
+		add("ExpiredCodeResponse 不支持 %q，可选 generic、distinct", c.ExpiredCodeResponse)
+	}
+	if c.ResponseCompression.MinSizeBytes < 0 {
+		add("ResponseCompression.MinSizeBytes 不能为负数，当前为 %d", c.ResponseCompression.MinSizeBytes)
+	}
+	if c.DefaultExpiryHours <= 0 {
+		add("DefaultExpiryHours 必须大于 0，当前为 %d", c.DefaultExpiryHours)
+	}
+	if c.ScanRetry.Enabled && c.ScanRetry.IntervalMinutes <= 0 {
+		add("ScanRetry.IntervalMinutes 必须大于 0，当前为 %d", c.ScanRetry.IntervalMinutes)
+	}
+	if c.ScanRetry.MaxAttempts < 0 || c.ScanRetry.BackoffMinutes < 0 {
+		add("ScanRetry.MaxAttempts 和 ScanRetry.BackoffMinutes 不能为负数")
+	}
+	for _, preset := range c.ExpiryPresets {
+		if _, err := parseExpiryPreset(preset); err != nil {
+			add("ExpiryPresets: %w", err)
+		}
+	}
+	if c.StrictExpiryPresets && len(c.ExpiryPresets) == 0 {
+		add("启用 StrictExpiryPresets 时 ExpiryPresets 不能为空")
+	}
+	if c.MaxUploadSizeMB <= 0 {
+		add("MaxUploadSizeMB 必须大于 0，当前为 %d", c.MaxUploadSizeMB)
+	}
+
+	switch strings.ToLower(c.Database.Type) {
+	case "sqlite", "mysql", "postgres":
+	default:
+		add("Database.Type 不支持 %q，可选 sqlite、mysql、postgres", c.Database.Type)
+	}
+	if c.Database.DSN == "" {
+		add("Database.DSN 不能为空")
+	}
+	if c.E2EE.VerificationHashLength < 0 || c.E2EE.MinSaltBytes < 0 {
+		add("E2EE.VerificationHashLength 和 E2EE.MinSaltBytes 不能为负数")
+	}
+	if c.Backup.Enabled && c.Backup.IntervalHours <= 0 {
+		add("启用 Backup 时 Backup.IntervalHours 必须大于 0，当前为 %d", c.Backup.IntervalHours)
+	}
+	if c.Backup.Retention < 0 {
+		add("Backup.Retention 不能为负数 (0 表示全部保留)，当前为 %d", c.Backup.Retention)
+	}
+	if c.MetaCache.Enabled && (c.MetaCache.MaxEntries <= 0 || c.MetaCache.TTLSeconds <= 0) {
+		add("启用 MetaCache 时 MetaCache.MaxEntries 和 MetaCache.TTLSeconds 都必须大于 0")
+	}
+	if c.RequestTimeoutSeconds < 0 {
+		add("RequestTimeoutSeconds 不能为负数 (0 表示不限制)，当前为 %d", c.RequestTimeoutSeconds)
+	}
+	if c.MaxActiveFiles < 0 {
+		add("MaxActiveFiles 不能为负数 (0 表示不限制)，当前为 %d", c.MaxActiveFiles)
+	}
+	if c.MaxDescriptionLength <= 0 {
+		add("MaxDescriptionLength 必须大于 0，当前为 %d", c.MaxDescriptionLength)
+	}
+	if c.Storage.Retry.MaxAttempts < 1 {
+		add("Storage.Retry.MaxAttempts 至少为 1 (不重试)，当前为 %d", c.Storage.Retry.MaxAttempts)
+	}
+	if c.Storage.Retry.InitialBackoffMs < 0 || c.Storage.Retry.MaxBackoffMs < 0 {
+		add("Storage.Retry.InitialBackoffMs 和 Storage.Retry.MaxBackoffMs 不能为负数")
+	}
+	if c.Database.SlowQueryThresholdMs < 0 {
+		add("Database.SlowQueryThresholdMs 不能为负数，当前为 %d", c.Database.SlowQueryThresholdMs)
+	}
+
+	switch strings.ToLower(c.Storage.Type) {
+	case "local":
+		if c.Storage.LocalPath == "" {
+			add("Storage.Type 为 local 时必须设置 Storage.LocalPath")
+		}
+	case "s3":
+		if c.Storage.S3.Bucket == "" {
+			add("Storage.Type 为 s3 时必须设置 Storage.S3.Bucket")
+		}
+		if c.Storage.S3.Region == "" {
+			add("Storage.Type 为 s3 时必须设置 Storage.S3.Region")
+		}
+		// 存储使用静态凭证，两者缺一都无法签名请求
+		if c.Storage.S3.AccessKeyID == "" || c.Storage.S3.SecretAccessKey == "" {
+			add("Storage.Type 为 s3 时必须设置 Storage.S3.AccessKeyID 和 Storage.S3.SecretAccessKey")
+		}
+	case "webdav":
+		if c.Storage.WebDAV.URL == "" {
+			add("Storage.Type 为 webdav 时必须设置 Storage.WebDAV.URL")
+		}
+	case "ipfs":
+		if c.Storage.IPFS.APIURL == "" {
+			add("Storage.Type 为 ipfs 时必须设置 Storage.IPFS.APIURL")
+		}
+	case "b2":
+		if c.Storage.B2.AccountID == "" || c.Storage.B2.ApplicationKey == "" || c.Storage.B2.Bucket == "" {
+			add("Storage.Type 为 b2 时必须设置 Storage.B2.AccountID、Storage.B2.ApplicationKey 和 Storage.B2.Bucket")
+		}
+		if c.Storage.B2.PartSizeMB*1024*1024 < b2MinPartSize {
+			add("Storage.B2.PartSizeMB 不能小于 %d (B2 分片的最小尺寸)", b2MinPartSize/1024/1024)
+		}
+		if c.Storage.B2.AuthURL == "" {
+			add("Storage.Type 为 b2 时必须设置 Storage.B2.AuthURL")
+		}
+	default:
+		add("Storage.Type 不支持 %q，可选 local、s3、webdav、ipfs、b2", c.Storage.Type)
+	}
+
+	if c.RateLimit.Enabled && (c.RateLimit.Requests <= 0 || c.RateLimit.DurationMinutes <= 0) {
+		add("启用 RateLimit 时 RateLimit.Requests 和 RateLimit.DurationMinutes 都必须大于 0")
+	}
+	rules := map[string]RateLimitRule{
+		"Uploads":   c.RateLimit.Uploads,
+		"Downloads": c.RateLimit.Downloads,
+		"Reports":   c.RateLimit.Reports,
+		"Previews":  c.RateLimit.Previews,
+	}
+	for _, group := range []string{"Uploads", "Downloads", "Reports", "Previews"} {
+		if rule := rules[group]; rule.Requests > 0 && rule.DurationMinutes <= 0 {
+			add("设置了 RateLimit.%s.Requests 时 RateLimit.%s.DurationMinutes 必须大于 0", group, group)
+		}
+	}
+
+	if c.Tracing.Enabled {
+		if _, err := tracingEndpointURL(c.Tracing.Endpoint); err != nil {
+			add("%w", err)
+		}
+		if c.Tracing.ServiceName == "" {
+			add("启用 Tracing 时 Tracing.ServiceName 不能为空")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			add("Tracing.SampleRatio 必须在 0 到 1 之间，当前为 %v", c.Tracing.SampleRatio)
+		}
+	}
+
+	if c.ClamdSocket != "" && !strings.HasPrefix(c.ClamdSocket, "tcp://") && !strings.HasPrefix(c.ClamdSocket, "unix://") {
+		add("ClamdSocket 必须以 tcp:// 或 unix:// 开头，当前为 %q", c.ClamdSocket)
+	}
+	if c.ClamdMaxConcurrentScans < 0 {
+		add("ClamdMaxConcurrentScans 不能为负数 (0 表示不限制)，当前为 %d", c.ClamdMaxConcurrentScans)
+	}
+	return errors.Join(errs...)
+}
+
+// bindConfigEnv 为 Config 中的每个叶子键绑定环境变量 (例如 Storage.S3.Bucket -> TEMPSHARE_STORAGE_S3_BUCKET)。
+// AutomaticEnv 只对 viper 已知的键生效，未注册默认值的键即使设置了环境变量也会被忽略；
+// 这里按结构体标签逐一绑定，新增配置项时不会因为漏写 SetDefault 而无法通过环境变量设置
+func bindConfigEnv(t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			bindConfigEnv(field.Type, prefix+key+".")
+			continue
+		}
+		viper.BindEnv(prefix + key)
+	}
 }
 
-func (c *Config) GetRateLimitDuration() time.Duration {
-	return time.Duration(c.RateLimit.DurationMinutes) * time.Minute
+// secretFileSuffix 标记从文件读取的配置值，例如 TEMPSHARE_STORAGE_S3_SECRETACCESSKEY_FILE=/run/secrets/s3_key，
+// 与 Docker/Kubernetes secrets 的惯例一致，避免密钥出现在 docker inspect 或进程列表中
+const secretFileSuffix = "_FILE"
+
+// loadSecretFiles 为 Config 中的每个叶子键检查对应的 <环境变量>_FILE，设置时读取文件内容作为该键的值，
+// 优先于同名的环境变量和配置文件；未设置时沿用普通环境变量。文件末尾的换行会被去掉。
+// 每次读取配置时都会重新读取文件，轮换密钥后发送 SIGHUP 即可生效 (仅限可重新加载的配置项)
+func loadSecretFiles(t reflect.Type, prefix string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			if err := loadSecretFiles(field.Type, prefix+key+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		env := "TEMPSHARE_" + strings.ToUpper(strings.ReplaceAll(prefix+key, ".", "_")) + secretFileSuffix
+		path := os.Getenv(env)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("无法读取 %s 指定的文件: %w", env, err)
+		}
+		viper.Set(prefix+key, strings.TrimRight(string(data), "\r\n"))
+		slog.Info("已从文件读取配置项", "key", prefix+key, "path", path)
+	}
+	return nil
 }
@@ -0,0 +1,169 @@
+// backend/config_test.go
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// configLeaf 是 Config 中的一个叶子配置项及其环境变量名，与 bindConfigEnv 绑定的键一一对应
+type configLeaf struct {
+	key   string
+	env   string
+	index []int
+	typ   reflect.Type
+}
+
+// configLeaves 按 mapstructure 标签遍历 Config，返回所有叶子配置项
+func configLeaves(t reflect.Type, prefix string, index []int) []configLeaf {
+	var leaves []configLeaf
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if field.Type.Kind() == reflect.Struct {
+			leaves = append(leaves, configLeaves(field.Type, prefix+key+".", fieldIndex)...)
+			continue
+		}
+		env := "TEMPSHARE_" + strings.ToUpper(strings.ReplaceAll(prefix+key, ".", "_"))
+		leaves = append(leaves, configLeaf{key: prefix + key, env: env, index: fieldIndex, typ: field.Type})
+	}
+	return leaves
+}
+
+// loadTestConfig 以不存在的配置文件调用 LoadConfig (只使用环境变量和默认值)，返回加载的配置。
+// 测试结束时重置 viper 并恢复原配置
+func loadTestConfig(t *testing.T) *Config {
+	t.Helper()
+	previous := appConfig.Load()
+	t.Cleanup(func() {
+		viper.Reset()
+		appConfig.Store(previous)
+	})
+	viper.Reset()
+	if err := LoadConfig(filepath.Join(t.TempDir(), "config.json")); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return AppConfig()
+}
+
+// envTestValue 返回与默认值不同的环境变量值及其解析后的期望值。map 和结构体切片 (PreviewMimeTypes、
+// S3.Fallbacks) 无法从单个环境变量解析，只能写在 config.json 中，返回 ok=false
+func envTestValue(leaf configLeaf, n int, def reflect.Value) (env string, want interface{}, ok bool) {
+	switch leaf.typ.Kind() {
+	case reflect.String:
+		v := "test-" + strings.ToLower(leaf.env)
+		return v, v, true
+	case reflect.Bool:
+		return strconv.FormatBool(!def.Bool()), !def.Bool(), true
+	case reflect.Int, reflect.Int64, reflect.Uint8, reflect.Uint32:
+		v := int64(100 + n%100)
+		if def.CanInt() && def.Int() == v || def.CanUint() && def.Uint() == uint64(v) {
+			v++
+		}
+		return strconv.FormatInt(v, 10), reflect.ValueOf(v).Convert(leaf.typ).Interface(), true
+	case reflect.Float64:
+		return "0.375", 0.375, true
+	case reflect.Slice:
+		if leaf.typ.Elem().Kind() != reflect.String {
+			return "", nil, false
+		}
+		v := []string{"a" + strconv.Itoa(n), "b" + strconv.Itoa(n)}
+		return strings.Join(v, ","), v, true
+	}
+	return "", nil, false
+}
+
+func TestConfigEnvRoundTrip(t *testing.T) {
+	defaults := reflect.ValueOf(*loadTestConfig(t))
+
+	leaves := configLeaves(reflect.TypeOf(Config{}), "", nil)
+	expected := make(map[string]interface{})
+	var nested int
+	for n, leaf := range leaves {
+		env, want, ok := envTestValue(leaf, n, defaults.FieldByIndex(leaf.index))
+		if !ok {
+			continue
+		}
+		t.Setenv(leaf.env, env)
+		expected[leaf.key] = want
+		if strings.HasPrefix(leaf.key, "Storage.S3.") || strings.HasPrefix(leaf.key, "Storage.WebDAV.") {
+			nested++
+		}
+	}
+	if nested == 0 {
+		t.Fatal("没有找到 Storage.S3/Storage.WebDAV 下的配置项")
+	}
+
+	cfg := reflect.ValueOf(*loadTestConfig(t))
+	for _, leaf := range leaves {
+		want, ok := expected[leaf.key]
+		if !ok {
+			continue
+		}
+		if got := cfg.FieldByIndex(leaf.index).Interface(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %s = %#v, want %#v", leaf.env, leaf.key, got, want)
+		}
+	}
+}
+
+// documentedEnvPattern 匹配文档和初始化向导中的环境变量名
+var documentedEnvPattern = regexp.MustCompile(`\bTEMPSHARE_[A-Z0-9_]+`)
+
+func TestDocumentedEnvVarsMatchConfig(t *testing.T) {
+	known := make(map[string]bool)
+	for _, leaf := range configLeaves(reflect.TypeOf(Config{}), "", nil) {
+		known[leaf.env] = true
+	}
+
+	envExample, err := os.ReadFile("../.env.example")
+	if err != nil {
+		t.Fatalf("无法读取 .env.example: %v", err)
+	}
+	sources := map[string]string{".env.example": string(envExample), "初始化向导": captureStdout(t, runInitializationGuide)}
+	for source, text := range sources {
+		names := documentedEnvPattern.FindAllString(text, -1)
+		if len(names) == 0 {
+			t.Errorf("%s 中没有环境变量", source)
+		}
+		for _, name := range names {
+			if !known[strings.TrimSuffix(name, secretFileSuffix)] {
+				t.Errorf("%s 中的 %s 不对应任何配置项", source, name)
+			}
+		}
+	}
+}
+
+// captureStdout 返回 fn 写入标准输出的内容
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
@@ -0,0 +1,112 @@
+// backend/cors.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// corsUploadPathPrefixes 是使用上传类 CORS 规则的路径，其余路径使用公开读取规则
+var corsUploadPathPrefixes = []string{"/api/v1/uploads/", "/api/v1/report"}
+
+var corsAllowHeaders = []string{
+	"Origin", "Content-Type", "X-Requested-With",
+	"X-File-Name", "X-File-Encrypted-Name", "X-File-Original-Size", "X-File-Encrypted", "X-File-Salt", "X-File-Encryption-Manifest", "X-File-Expires-In", "X-File-Expiry-Label",
+	"X-File-Download-Once", "X-File-Burn-On-View", "X-File-Public", "X-File-Verification-Hash", "X-File-Password-Hash", "X-File-Password", "X-File-Tags", "X-File-Allowed-Countries", "X-File-Notify", "X-File-Notify-Every", "X-File-Description",
+	"X-Upload-ID", "Idempotency-Key", "X-Manage-Token", requestIDHeader,
+}
+
+// errCORSWildcardCredentials 表示配置中把通配来源和 AllowCredentials 组合在一起，
+// 这会允许任意网站携带用户凭据访问接口，因此直接拒绝启动
+var errCORSWildcardCredentials = errors.New("CORS 配置错误: 允许所有来源 (*) 时不能同时启用 AllowCredentials")
+
+// parseOrigins 将逗号分隔的来源列表拆分并去除空白，空字符串返回 fallback
+func parseOrigins(value, fallback string) []string {
+	if strings.TrimSpace(value) == "" {
+		value = fallback
+	}
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// buildCORSConfig 根据来源列表和凭据设置生成 cors.Config 并校验。
+// origins 为空时返回 nil，表示该组接口不发送 CORS 头 (仅允许同源访问)
+func buildCORSConfig(origins []string, allowCredentials bool, maxAge time.Duration) (*cors.Config, error) {
+	if len(origins) == 0 {
+		return nil, nil
+	}
+	config := &cors.Config{
+		AllowMethods:     []string{"GET", "HEAD", "POST", "OPTIONS"},
+		AllowHeaders:     corsAllowHeaders,
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "ETag", "X-Total-Count", "X-Has-More", "X-Page", "X-Page-Size", "Idempotent-Replayed", requestIDHeader},
+		AllowCredentials: allowCredentials,
+		MaxAge:           maxAge,
+	}
+	for _, origin := range origins {
+		if origin == "*" {
+			config.AllowAllOrigins = true
+		} else if strings.Contains(origin, "*") {
+			config.AllowWildcard = true
+		}
+	}
+	if config.AllowAllOrigins {
+		if allowCredentials {
+			return nil, errCORSWildcardCredentials
+		}
+	} else {
+		config.AllowOrigins = origins
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("CORS 配置错误: %w", err)
+	}
+	return config, nil
+}
+
+// NewCORSMiddleware 为上传接口和公开读取接口分别构建 CORS 规则，并按请求路径选择。
+// 必须注册为全局中间件，否则没有对应路由的 OPTIONS 预检请求不会经过它
+func NewCORSMiddleware(config *Config) (gin.HandlerFunc, error) {
+	maxAge := time.Duration(config.CORSMaxAgeMinutes) * time.Minute
+
+	uploadOrigins := parseOrigins(config.CORSUploadAllowedOrigins, config.CORSAllowedOrigins)
+	uploadConfig, err := buildCORSConfig(uploadOrigins, true, maxAge)
+	if err != nil {
+		return nil, fmt.Errorf("上传接口 %w", err)
+	}
+	publicOrigins := parseOrigins(config.CORSPublicAllowedOrigins, config.CORSAllowedOrigins)
+	publicConfig, err := buildCORSConfig(publicOrigins, config.CORSPublicAllowCredentials, maxAge)
+	if err != nil {
+		return nil, fmt.Errorf("公开接口 %w", err)
+	}
+	slog.Info("CORS 配置", "uploadOrigins", uploadOrigins, "publicOrigins", publicOrigins,
+		"publicAllowCredentials", config.CORSPublicAllowCredentials, "maxAge", maxAge)
+
+	uploadHandler, publicHandler := corsHandler(uploadConfig), corsHandler(publicConfig)
+	return func(c *gin.Context) {
+		for _, prefix := range corsUploadPathPrefixes {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				uploadHandler(c)
+				return
+			}
+		}
+		publicHandler(c)
+	}, nil
+}
+
+// corsHandler 在 config 为 nil 时返回一个不做任何处理的中间件
+func corsHandler(config *cors.Config) gin.HandlerFunc {
+	if config == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return cors.New(*config)
+}
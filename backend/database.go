@@ -10,7 +10,6 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 // --- 模型定义 (无变化) ---
@@ -23,21 +22,71 @@ const (
 )
 
 type File struct {
-	ID                string `gorm:"primaryKey" json:"-"`
-	AccessCode        string `gorm:"uniqueIndex,size:6" json:"accessCode"`
-	Filename          string `gorm:"size:255" json:"filename"`
+	ID         string `gorm:"primaryKey" json:"-"`
+	AccessCode string `gorm:"uniqueIndex;size:32" json:"accessCode"`
+	Filename   string `gorm:"size:255" json:"filename"`
+	// EncryptedFilename 是客户端加密后的真实文件名 (服务器不解析)，设置时 Filename 为通用名称 encryptedDisplayName
+	EncryptedFilename string `gorm:"size:1024" json:"-"`
 	SizeBytes         int64  `gorm:"not null" json:"sizeBytes"`
 	OriginalSizeBytes int64  `json:"originalSizeBytes"`
-	IsEncrypted       bool   `gorm:"default:false;index" json:"isEncrypted"`
-	EncryptionSalt    string `json:"encryptionSalt"`
-	VerificationHash  string `gorm:"size:64" json:"-"`
-	DownloadOnce      bool   `gorm:"default:false" json:"downloadOnce"`
+	// Compressed 表示对象以 gzip 压缩存储，此时 SizeBytes 为压缩后大小，OriginalSizeBytes 为解压后大小
+	Compressed     bool   `gorm:"default:false" json:"-"`
+	IsEncrypted    bool   `gorm:"default:false;index" json:"isEncrypted"`
+	EncryptionSalt string `json:"encryptionSalt"`
+	// EncryptionManifest 是分块加密时客户端提供的 JSON 清单，服务器不解析，只在元信息中原样返回
+	EncryptionManifest string `gorm:"type:text" json:"-"`
+	VerificationHash   string `gorm:"size:255" json:"-"`
+	DownloadOnce       bool   `gorm:"default:false" json:"downloadOnce"`
+	// BurnOnView 表示文件在元信息首次被读取后即失效 (保留 BurnOnViewGraceSeconds 供本次下载)，ViewedAt 记录首次读取时间
+	BurnOnView bool       `gorm:"default:false;index" json:"burnOnView"`
+	ViewedAt   *time.Time `json:"-"`
+	// PasswordProtected 表示未加密文件受服务器端密码保护，PasswordHash 为上传者提供的 bcrypt/argon2id 哈希
+	PasswordProtected bool   `gorm:"default:false;index" json:"passwordProtected"`
+	PasswordHash      string `gorm:"size:255" json:"-"`
 	// ✨ 核心修改点: StorageKey 现在是一个更通用的标识符，而不是文件路径
 	StorageKey string    `gorm:"unique;size:255" json:"-"`
 	ExpiresAt  time.Time `gorm:"index" json:"expiresAt"`
-	CreatedAt  time.Time `json:"createdAt"`
-	ScanStatus string    `gorm:"default:'pending';index" json:"scanStatus"`
-	ScanResult string    `gorm:"size:255" json:"scanResult"`
+	// ExpiryLabel 是上传者选择的有效期描述 (例如 "1小时")，前端据此展示原始意图而不受时区影响
+	ExpiryLabel string    `gorm:"size:64" json:"expiryLabel"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ScanStatus  string    `gorm:"default:'pending';index" json:"scanStatus"`
+	ScanResult  string    `gorm:"size:255" json:"scanResult"`
+	// ScanAttempts 是后台重扫任务对该文件的重试次数，NextScanAt 之前不会再次重扫，见 rescan
+	ScanAttempts int        `gorm:"default:0" json:"-"`
+	NextScanAt   *time.Time `gorm:"index" json:"-"`
+	// ContentHash 是上传时写入存储的字节 (压缩存储时为压缩后的数据) 的十六进制 SHA-256，旧记录为空，见 verifyingStorage
+	ContentHash string `gorm:"size:64" json:"-"`
+	// ConsumedAt 是一次性下载文件开始被下载的时间，同时过期时间被设为该时刻，存储对象由清理任务删除
+	ConsumedAt *time.Time `json:"-"`
+	// AllowedCountries 是允许下载和预览的国家代码 (逗号分隔，例如 "CN,US")，为空表示不限制，见 checkCountry
+	AllowedCountries string `gorm:"size:255" json:"-"`
+	// NotifyTarget 是上传者提供的下载通知目标 (Webhook URL 或 "mailto:邮箱")，为空表示不通知；
+	// NotifyEvery 为 false 时只通知首次下载，NotifiedAt 为最近一次通知的时间，见 NotifyDownload
+	NotifyTarget string     `gorm:"size:512" json:"-"`
+	NotifyEvery  bool       `gorm:"default:false" json:"-"`
+	NotifiedAt   *time.Time `json:"-"`
+	// IsPublic 表示上传者是否同意在公开列表中展示 (X-File-Public)，新上传默认为 false。
+	// 此列加入之前的旧记录为 NULL，仍按原来的隐含规则展示 (未加密、非阅后即焚等)，见 publicFiles
+	IsPublic *bool `gorm:"index" json:"-"`
+	// IsFeatured 表示运维置顶的文件 (tempshare feature)，在公开列表第一页按 FeaturedOrder 从小到大排在最前
+	IsFeatured    bool `gorm:"default:false;index" json:"isFeatured"`
+	FeaturedOrder int  `gorm:"default:0" json:"-"`
+	// Quarantined 表示文件因举报人数达到 ReportTakedownThreshold 被自动下架，复核前禁止下载和预览
+	Quarantined bool `gorm:"default:false;index" json:"-"`
+	// ContentType 是上传时根据内容检测到的 MIME 类型，加密文件为空
+	ContentType string `gorm:"size:255" json:"-"`
+	// ManageTokenHash 是上传时返回给上传者的管理令牌的 SHA-256，用于授权轮换分享码等管理操作。
+	// ManageToken 只在上传流程中携带明文令牌，不入库
+	ManageTokenHash string `gorm:"size:64" json:"-"`
+	ManageToken     string `gorm:"-" json:"-"`
+	// ViewCount 和 DownloadCount 分别统计元信息读取和下载次数，LastAccessedAt 为最后一次访问时间，见 recordAccess
+	ViewCount      int64      `gorm:"default:0" json:"-"`
+	DownloadCount  int64      `gorm:"default:0" json:"-"`
+	LastAccessedAt *time.Time `json:"-"`
+	// Tags 是上传者提供的自定义标签 (JSON 对象)，只在元信息中返回，不会出现在公开列表中
+	Tags string `gorm:"type:text" json:"-"`
+	// Description 是上传者提供的文件说明 (纯文本)，在元信息和落地页中展示；公开列表只包含本来就公开的文件，因此也会返回
+	Description string `gorm:"type:text" json:"description,omitempty"`
 }
 
 type Report struct {
@@ -70,16 +119,22 @@ func ConnectDatabase(config DBConfig) (*gorm.DB, error) {
 	}
 
 	db, err := gorm.Open(dialector, &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: newGormLogger(time.Duration(config.SlowQueryThresholdMs) * time.Millisecond),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("无法连接数据库 (%s): %w", dbType, err)
 	}
 
-	err = db.AutoMigrate(&File{}, &Report{})
+	err = db.AutoMigrate(&File{}, &Report{}, &UploadIdempotencyKey{})
 	if err != nil {
 		return nil, fmt.Errorf("无法迁移数据库: %w", err)
 	}
+	// 旧版本在幂等记录中保存明文管理令牌，现已改为加密保存 (SealedManageToken)，删除旧列以免明文令牌留在数据库中
+	if db.Migrator().HasColumn(&UploadIdempotencyKey{}, "manage_token") {
+		if err := db.Migrator().DropColumn(&UploadIdempotencyKey{}, "manage_token"); err != nil {
+			return nil, fmt.Errorf("无法删除幂等记录中的明文管理令牌列: %w", err)
+		}
+	}
 
 	fmt.Printf("成功连接到 %s 数据库\n", dbType)
 	return db, nil
@@ -0,0 +1,53 @@
+// backend/description.go
+package main
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var errInvalidDescription = errors.New("无效的文件说明 (X-File-Description)")
+
+// parseFileDescription 解码并校验上传者通过 X-File-Description 提供的文件说明。与 X-File-Name 一样，
+// 非 ASCII 字符需要经过 URL 编码。返回空字符串表示未提供
+func parseFileDescription(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	description, err := url.QueryUnescape(raw)
+	if err != nil {
+		return "", errInvalidDescription
+	}
+	return validateFileDescription(description)
+}
+
+// validateFileDescription 校验已解码的文件说明: 最多 MaxDescriptionLength 个字符，除换行和制表符外不能包含控制字符。
+// 说明始终作为纯文本保存和输出，由展示方负责转义 (落地页使用 html/template)
+func validateFileDescription(description string) (string, error) {
+	description = strings.TrimSpace(strings.ReplaceAll(description, "\r\n", "\n"))
+	if !utf8.ValidString(description) || utf8.RuneCountInString(description) > AppConfig().MaxDescriptionLength {
+		return "", errInvalidDescription
+	}
+	if strings.IndexFunc(description, func(r rune) bool { return unicode.IsControl(r) && r != '\n' && r != '\t' }) >= 0 {
+		return "", errInvalidDescription
+	}
+	return description, nil
+}
+
+// readDescriptionPart 读取批量上传中名为 description 的表单字段，超过长度限制时不读取剩余内容
+func readDescriptionPart(part io.Reader) (string, error) {
+	// 每个字符最多 4 个字节，多读一个字节用于判断是否超长
+	limit := int64(AppConfig().MaxDescriptionLength)*utf8.UTFMax + 1
+	data, err := io.ReadAll(io.LimitReader(part, limit))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) >= limit {
+		return "", errInvalidDescription
+	}
+	return validateFileDescription(string(data))
+}
@@ -0,0 +1,80 @@
+// backend/e2ee.go
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+// MaxEncryptedFilenameLength 是 X-File-Encrypted-Name 的最大长度。加密后的文件名 (含 IV 和认证标签)
+// 经 base64 编码后通常只有几百字节
+const MaxEncryptedFilenameLength = 1024
+
+// encryptedDisplayName 是带有加密文件名的文件对外展示的通用名称，也用于加密文件下载时的 Content-Disposition
+const encryptedDisplayName = "encrypted.bin"
+
+// MaxEncryptionManifestBytes 是 X-File-Encryption-Manifest 的最大字节数。常见反向代理单个请求头的缓冲区为 8KB，
+// 分块很多时客户端应由计数器推导每块的 nonce，而不是逐个列出
+const MaxEncryptionManifestBytes = 8 * 1024
+
+var (
+	errInvalidEncryptedFilename  = errors.New("无效的加密文件名 (X-File-Encrypted-Name)")
+	errInvalidEncryptionManifest = errors.New("无效的加密清单 (X-File-Encryption-Manifest)")
+	errInvalidEncryptionParams   = errors.New("无效的端到端加密参数 (X-File-Verification-Hash / X-File-Salt)")
+)
+
+// validateEncryptionParams 校验加密上传的验证哈希和盐。没有验证哈希的加密文件永远无法通过下载验证，
+// 盐过短或缺失说明客户端没有正确派生密钥，这些上传都直接拒绝。长度要求见 E2EEConfig
+func validateEncryptionParams(verificationHash, salt string) error {
+	cfg := AppConfig().E2EE
+	if verificationHash == "" {
+		return errInvalidEncryptionParams
+	}
+	if cfg.VerificationHashLength > 0 {
+		if len(verificationHash) != cfg.VerificationHashLength {
+			return errInvalidEncryptionParams
+		}
+		if _, err := hex.DecodeString(verificationHash); err != nil {
+			return errInvalidEncryptionParams
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(salt)
+	}
+	if err != nil || len(decoded) < cfg.MinSaltBytes {
+		return errInvalidEncryptionParams
+	}
+	return nil
+}
+
+// parseEncryptedFilename 校验客户端加密后的文件名。服务器不解析其内容，只要求是长度受限的可打印 ASCII
+// (base64 或 JSON 均可)，以便原样放进 JSON 响应。返回空字符串表示未提供
+func parseEncryptedFilename(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if len(raw) > MaxEncryptedFilenameLength {
+		return "", errInvalidEncryptedFilename
+	}
+	for i := 0; i < len(raw); i++ {
+		if raw[i] < 0x20 || raw[i] > 0x7e {
+			return "", errInvalidEncryptedFilename
+		}
+	}
+	return raw, nil
+}
+
+// parseEncryptionManifest 校验分块加密的清单 (分块数量、每块 nonce、总大小等)。
+// 服务器只检查大小和 JSON 格式，内容原样保存并在元信息中返回。返回空字符串表示未提供
+func parseEncryptionManifest(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if len(raw) > MaxEncryptionManifestBytes || !json.Valid([]byte(raw)) {
+		return "", errInvalidEncryptionManifest
+	}
+	return raw, nil
+}
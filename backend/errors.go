@@ -0,0 +1,64 @@
+// backend/errors.go
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 错误码是稳定的机器可读标识，客户端和 i18n 应以 code 区分错误类型，message 仅用于展示
+const (
+	ErrCodeInvalidRequest     = "INVALID_REQUEST"
+	ErrCodeMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	ErrCodeFileNotFound       = "FILE_NOT_FOUND"
+	ErrCodeFileExpired        = "FILE_EXPIRED"
+	ErrCodeFileInfected       = "FILE_INFECTED"
+	ErrCodeFileQuarantined    = "FILE_QUARANTINED"
+	ErrCodeFileMissing        = "FILE_MISSING" // 数据库记录存在但存储对象丢失
+	ErrCodePasswordRequired   = "PASSWORD_REQUIRED"
+	ErrCodeWrongPassword      = "WRONG_PASSWORD"
+	ErrCodePreviewUnavailable = "PREVIEW_UNAVAILABLE"
+	ErrCodeNotTextFile        = "NOT_TEXT_FILE"
+	ErrCodeUploadNotFound     = "UPLOAD_NOT_FOUND"
+	ErrCodeUploadInProgress   = "UPLOAD_IN_PROGRESS"
+	ErrCodeFileTooLarge       = "FILE_TOO_LARGE"
+	ErrCodeStorageFull        = "STORAGE_FULL"
+	ErrCodeFileLimitReached   = "FILE_LIMIT_REACHED" // 未过期文件数量达到 MaxActiveFiles
+	ErrCodeRateLimited        = "RATE_LIMITED"
+	ErrCodeServerBusy         = "SERVER_BUSY"
+	ErrCodeMaintenance        = "MAINTENANCE"
+	ErrCodeIPForbidden        = "IP_FORBIDDEN"
+	ErrCodeCountryForbidden   = "COUNTRY_FORBIDDEN"
+	ErrCodeInvalidManageToken = "INVALID_MANAGE_TOKEN"
+	ErrCodeInvalidSignature   = "INVALID_SIGNATURE"
+	ErrCodeInvalidConfirm     = "INVALID_CONFIRMATION_TOKEN"
+	ErrCodeStorageError       = "STORAGE_ERROR"
+	ErrCodeRequestTimeout     = "REQUEST_TIMEOUT"
+	ErrCodeIntegrityFailed    = "INTEGRITY_CHECK_FAILED" // 存储对象与上传时记录的大小不一致
+	ErrCodeInternal           = "INTERNAL_ERROR"
+)
+
+// errorBody 构建统一的错误响应体 {code, message}，extra 中的字段会被合并进去
+func errorBody(code, message string, extra ...gin.H) gin.H {
+	body := gin.H{"code": code, "message": message}
+	for _, fields := range extra {
+		for k, v := range fields {
+			body[k] = v
+		}
+	}
+	return body
+}
+
+// respondError 写入统一格式的错误响应。请求已超过 RequestTimeoutSeconds 时，处理函数因此失败而写入的错误统一改为 504
+func respondError(c *gin.Context, status int, code, message string, extra ...gin.H) {
+	if status >= http.StatusInternalServerError && requestTimedOut(c) {
+		status, code, message = http.StatusGatewayTimeout, ErrCodeRequestTimeout, translate(c, msgRequestTimeout)
+	}
+	c.JSON(status, errorBody(code, message, extra...))
+}
+
+// abortWithError 用于中间件: 写入错误响应并中止后续处理
+func abortWithError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, errorBody(code, message))
+}
@@ -0,0 +1,130 @@
+// backend/expiry.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxExpiryLabelLength 是 X-File-Expiry-Label 的最大字符数
+const MaxExpiryLabelLength = 32
+
+var errInvalidExpiryLabel = errors.New("无效的有效期描述 (X-File-Expiry-Label)")
+
+// parseExpiryLabel 解码并校验上传者提供的有效期描述。与 X-File-Name 一样，
+// 非 ASCII 字符需要经过 URL 编码。返回空字符串表示未提供
+func parseExpiryLabel(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	label, err := url.QueryUnescape(raw)
+	if err != nil {
+		return "", errInvalidExpiryLabel
+	}
+	label = strings.TrimSpace(label)
+	if !utf8.ValidString(label) || utf8.RuneCountInString(label) > MaxExpiryLabelLength {
+		return "", errInvalidExpiryLabel
+	}
+	if strings.IndexFunc(label, unicode.IsControl) >= 0 {
+		return "", errInvalidExpiryLabel
+	}
+	return label, nil
+}
+
+// expiryLabelFor 在上传者未提供描述时，根据有效期时长生成与前端选项一致的描述，例如 "3分钟"、"7天"
+func expiryLabelFor(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d天", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d小时", d/time.Hour)
+	case d >= time.Minute:
+		return fmt.Sprintf("%d分钟", d/time.Minute)
+	default:
+		return fmt.Sprintf("%d秒", d/time.Second)
+	}
+}
+
+// fileExpiryLabel 返回文件的有效期描述，旧记录没有保存描述时由 ExpiresAt 推算
+func fileExpiryLabel(file File) string {
+	if file.ExpiryLabel != "" {
+		return file.ExpiryLabel
+	}
+	// 创建时间与过期时间之间可能有几毫秒的偏差，按秒取整后再推算
+	return expiryLabelFor(file.ExpiresAt.Sub(file.CreatedAt).Round(time.Second))
+}
+
+// parseExpiryPreset 解析一个有效期预设，支持 time.ParseDuration 的格式 (例如 "30m"、"1h") 以及按天计的 "7d"
+func parseExpiryPreset(preset string) (time.Duration, error) {
+	preset = strings.TrimSpace(preset)
+	if days, ok := strings.CutSuffix(preset, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("无效的有效期预设 %q", preset)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(preset)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("无效的有效期预设 %q", preset)
+	}
+	return d, nil
+}
+
+// expiryMatchesPreset 报告有效期是否等于某个预设。无法解析的预设已在启动时由 Validate 拒绝，这里直接跳过
+func expiryMatchesPreset(d time.Duration, presets []string) bool {
+	for _, preset := range presets {
+		if p, err := parseExpiryPreset(preset); err == nil && p == d {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedExpiresIn 在启用 StrictExpiryPresets 时检查上传者提供的 X-File-Expires-In 是否为预设之一。
+// 未提供时使用服务器的默认有效期，不受限制
+func allowedExpiresIn(raw string) bool {
+	cfg := AppConfig()
+	if !cfg.StrictExpiryPresets || raw == "" {
+		return true
+	}
+	seconds, err := strconv.ParseInt(raw, 10, 64)
+	return err == nil && seconds > 0 && expiryMatchesPreset(time.Duration(seconds)*time.Second, cfg.ExpiryPresets)
+}
+
+// expiryPreset 是 GET /api/v1/config/expiry-presets 返回的一个预设
+type expiryPreset struct {
+	Value   string `json:"value"`
+	Seconds int64  `json:"seconds"`
+	Label   string `json:"label"`
+}
+
+// HandleGetExpiryPresets 返回允许的有效期预设，前端据此生成有效期选项。
+// strict 为 true 时上传只接受这些预设，defaultSeconds 是未指定有效期时使用的默认值
+func HandleGetExpiryPresets(c *gin.Context) {
+	cfg := AppConfig()
+	presets := []expiryPreset{}
+	for _, value := range cfg.ExpiryPresets {
+		d, err := parseExpiryPreset(value)
+		if err != nil {
+			continue
+		}
+		presets = append(presets, expiryPreset{Value: strings.TrimSpace(value), Seconds: int64(d / time.Second), Label: expiryLabelFor(d)})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"presets":        presets,
+		"strict":         cfg.StrictExpiryPresets,
+		"defaultSeconds": int64(cfg.DefaultExpiryHours) * 3600,
+	})
+}
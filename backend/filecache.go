@@ -0,0 +1,100 @@
+// backend/filecache.go
+package main
+
+import (
+	"container/list"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// fileCache 是 findActiveFile 使用的文件记录缓存，未启用 MetaCache 时为 nil (所有方法都可以在 nil 上调用)。
+// 与 activeScanFiles 一样是进程级的状态: 清理、隔离、重扫等后台任务修改记录时也需要使其失效
+var fileCache *FileMetaCache
+
+// fileCacheEntry 是 LRU 链表中的一项
+type fileCacheEntry struct {
+	file     File
+	cachedAt time.Time
+}
+
+// FileMetaCache 按分享码缓存 File 记录，热门文件的元信息、预览和下载请求不必每次都查询数据库。
+// 容量达到 maxEntries 时淘汰最久未使用的记录，超过 ttl 的记录视为未命中。
+// 本进程内修改文件记录的位置都会调用 Invalidate；其他进程 (命令行子命令、多实例部署) 的修改最多延迟 ttl 才可见，
+// 而一次性下载和阅后即焚都以数据库中的条件更新认领，缓存中的旧记录不会让文件被多次下载
+type FileMetaCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	order      *list.List // 最近使用的在前，元素值为 *fileCacheEntry
+	entries    map[string]*list.Element
+}
+
+// NewFileMetaCache 按配置创建缓存，未启用时返回 nil
+func NewFileMetaCache(config MetaCacheConfig) *FileMetaCache {
+	if !config.Enabled {
+		return nil
+	}
+	slog.Info("已启用文件元信息缓存", "maxEntries", config.MaxEntries, "ttlSeconds", config.TTLSeconds)
+	return &FileMetaCache{
+		maxEntries: config.MaxEntries,
+		ttl:        time.Duration(config.TTLSeconds) * time.Second,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get 返回未超过 ttl 的缓存记录。调用方仍需自行检查过期时间和隔离状态
+func (c *FileMetaCache) Get(code string) (File, bool) {
+	if c == nil {
+		return File{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[code]
+	if !ok {
+		return File{}, false
+	}
+	entry := elem.Value.(*fileCacheEntry)
+	if time.Since(entry.cachedAt) >= c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, code)
+		return File{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.file, true
+}
+
+// Add 缓存刚从数据库读取的记录
+func (c *FileMetaCache) Add(file File) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &fileCacheEntry{file: file, cachedAt: time.Now()}
+	if elem, ok := c.entries[file.AccessCode]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[file.AccessCode] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*fileCacheEntry).file.AccessCode)
+	}
+}
+
+// Invalidate 移除分享码对应的缓存记录，在文件记录被修改或删除后调用
+func (c *FileMetaCache) Invalidate(code string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[code]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, code)
+	}
+}
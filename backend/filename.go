@@ -0,0 +1,34 @@
+// backend/filename.go
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameBytes 与 File.Filename 的列宽一致
+const maxFilenameBytes = 255
+
+// sanitizeFilename 清理客户端提供的文件名: 去掉路径部分和控制字符，并截断到 maxFilenameBytes。
+// 上传时的 X-File-Name 和下载时的 ?filename= 都经过这里，结果无效 (为空或只有 . / ..) 时返回空字符串
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for len(name) > maxFilenameBytes {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
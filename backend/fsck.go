@@ -0,0 +1,147 @@
+// backend/fsck.go
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// fsckReport 是一致性检查的结果
+type fsckReport struct {
+	Orphans  []string // 存储中存在但没有数据库记录的对象键
+	Dangling []File   // 数据库记录存在但存储对象丢失的文件
+}
+
+// runFsck 实现 `tempshare fsck [--fix] [--prefix quarantine/]`: 找出孤儿对象 (没有数据库记录) 和悬空记录 (存储对象丢失)。
+// 默认只报告；--fix 删除孤儿对象和悬空记录；--prefix 只检查以该前缀开头的存储键。
+// 服务运行期间上传的文件可能在写入存储后、创建记录前被误判为孤儿，因此建议在停止服务后使用 --fix
+func runFsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "删除孤儿对象和悬空记录 (默认仅报告)")
+	prefix := fs.String("prefix", "", "只检查以该前缀开头的存储键，例如 quarantine/")
+	fs.Parse(args)
+
+	storage, err := NewFileStorage(AppConfig().Storage)
+	if err != nil {
+		return fmt.Errorf("存储后端初始化失败: %w", err)
+	}
+	db, err := ConnectDatabase(AppConfig().Database)
+	if err != nil {
+		return fmt.Errorf("数据库初始化失败: %w", err)
+	}
+
+	ctx := context.Background()
+	report, err := checkConsistency(ctx, db, storage, *prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range report.Orphans {
+		fmt.Printf("orphan\t%s\n", key)
+	}
+	for _, file := range report.Dangling {
+		fmt.Printf("dangling\t%s\t%s\n", file.AccessCode, file.StorageKey)
+	}
+	slog.Info("一致性检查完成", "orphans", len(report.Orphans), "dangling", len(report.Dangling), "fix", *fix)
+
+	if !*fix {
+		if len(report.Orphans)+len(report.Dangling) > 0 {
+			slog.Info("这是试运行，未做任何修改。使用 --fix 删除以上孤儿对象和悬空记录")
+		}
+		return nil
+	}
+	return repairConsistency(ctx, db, storage, report)
+}
+
+// checkConsistency 先读取全部 StorageKey，再遍历存储比对。遍历期间新建或删除的文件会在最后单独复查，
+// 避免把正常的并发上传和过期清理报告为不一致
+func checkConsistency(ctx context.Context, db *gorm.DB, storage FileStorage, prefix string) (fsckReport, error) {
+	var report fsckReport
+	var keys []string
+	query := db.Model(&File{})
+	if prefix != "" {
+		query = query.Where("storage_key LIKE ? ESCAPE '!'", likeEscaper.Replace(prefix)+"%")
+	}
+	if err := query.Pluck("storage_key", &keys).Error; err != nil {
+		return report, fmt.Errorf("读取文件记录失败: %w", err)
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		seen[key] = false
+	}
+
+	var candidates []string
+	err := storage.Walk(ctx, prefix, func(key string) error {
+		// 备份对象没有对应的文件记录，不是孤儿
+		if strings.HasPrefix(key, backupKeyPrefix) {
+			return nil
+		}
+		if _, ok := seen[key]; ok {
+			seen[key] = true
+		} else {
+			candidates = append(candidates, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("遍历存储失败: %w", err)
+	}
+
+	for _, key := range candidates {
+		var count int64
+		if err := db.Model(&File{}).Where("storage_key = ?", key).Count(&count).Error; err != nil {
+			return report, fmt.Errorf("复查文件记录失败: %w", err)
+		}
+		if count == 0 {
+			report.Orphans = append(report.Orphans, key)
+		}
+	}
+	for key, found := range seen {
+		if found {
+			continue
+		}
+		var file File
+		err := db.Where("storage_key = ?", key).First(&file).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue // 遍历期间已被删除
+		}
+		if err != nil {
+			return report, fmt.Errorf("复查文件记录失败: %w", err)
+		}
+		if !storage.Exists(key) {
+			report.Dangling = append(report.Dangling, file)
+		}
+	}
+	return report, nil
+}
+
+// repairConsistency 删除孤儿对象和悬空记录，单个失败只记录日志并继续
+func repairConsistency(ctx context.Context, db *gorm.DB, storage FileStorage, report fsckReport) error {
+	var orphansDeleted, danglingDeleted, failed int
+	for _, key := range report.Orphans {
+		if err := storage.Delete(ctx, key); err != nil {
+			failed++
+			slog.Error("删除孤儿对象失败", "key", key, "error", err)
+			continue
+		}
+		orphansDeleted++
+	}
+	for _, file := range report.Dangling {
+		if err := db.Delete(&File{}, "id = ?", file.ID).Error; err != nil {
+			failed++
+			slog.Error("删除悬空记录失败", "accessCode", file.AccessCode, "key", file.StorageKey, "error", err)
+			continue
+		}
+		danglingDeleted++
+	}
+	slog.Info("一致性修复完成", "orphansDeleted", orphansDeleted, "danglingDeleted", danglingDeleted, "failed", failed)
+	if failed > 0 {
+		return fmt.Errorf("%d 项修复失败", failed)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// backend/geo.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// MaxAllowedCountries 是 X-File-Allowed-Countries 中国家代码的数量上限
+const MaxAllowedCountries = 50
+
+var errInvalidAllowedCountries = errors.New("无效的国家代码列表 (X-File-Allowed-Countries)")
+
+// geoIPReader 是启动时打开的 MaxMind 国家数据库 (GeoLite2-Country 或 GeoIP2-Country)，未配置 GeoIP.DatabasePath 时为 nil
+var geoIPReader *geoip2.Reader
+
+// InitGeoIP 打开 GeoIP.DatabasePath 指定的 MaxMind 数据库，未配置时什么也不做。
+// 数据库在进程生命周期内一直打开，更新数据库文件后需要重启服务
+func InitGeoIP(config GeoIPConfig) error {
+	path := strings.TrimSpace(config.DatabasePath)
+	if path == "" {
+		return nil
+	}
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return fmt.Errorf("无法打开 GeoIP 数据库 %s: %w", path, err)
+	}
+	geoIPReader = reader
+	slog.Info("已加载 GeoIP 数据库", "path", path, "type", reader.Metadata().DatabaseType, "buildEpoch", reader.Metadata().BuildEpoch)
+	return nil
+}
+
+// parseAllowedCountries 解析逗号分隔的 ISO 3166-1 alpha-2 国家代码 (例如 "CN, us")，
+// 返回去重后的大写形式 (例如 "CN,US")。返回空字符串表示不限制。
+// 既没有 GeoIP 数据库也没有配置 GeoIP.CountryHeader 时服务器无法执行限制，不接受任何国家代码，以免上传者误以为限制已生效
+func parseAllowedCountries(raw string) (string, error) {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		code := strings.ToUpper(strings.TrimSpace(part))
+		if code == "" {
+			continue
+		}
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return "", errInvalidAllowedCountries
+		}
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) > MaxAllowedCountries || (len(codes) > 0 && !countrySourceConfigured()) {
+		return "", errInvalidAllowedCountries
+	}
+	return strings.Join(codes, ","), nil
+}
+
+// clientCountryHeader 返回配置的国家请求头名称，未配置时为空字符串。
+// 该请求头由受信任的 CDN 或反向代理写入 (例如 Cloudflare 的 CF-IPCountry)
+func clientCountryHeader() string {
+	return strings.TrimSpace(AppConfig().GeoIP.CountryHeader)
+}
+
+// countrySourceConfigured 报告服务器能否确定请求来源的国家 (加载了 GeoIP 数据库或配置了国家请求头)
+func countrySourceConfigured() bool {
+	return geoIPReader != nil || clientCountryHeader() != ""
+}
+
+// clientCountry 返回请求来源的国家代码，无法确定时返回空字符串。
+// 配置了 GeoIP.CountryHeader 且请求带有该请求头时以它为准 (代理必须覆盖客户端自带的同名请求头，否则客户端可以伪造)；
+// 否则用 GeoIP 数据库查询 c.ClientIP()
+func clientCountry(c *gin.Context) string {
+	if header := clientCountryHeader(); header != "" {
+		if country := strings.ToUpper(strings.TrimSpace(c.GetHeader(header))); country != "" {
+			return country
+		}
+	}
+	if geoIPReader == nil {
+		return ""
+	}
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil {
+		return ""
+	}
+	record, err := geoIPReader.Country(ip)
+	if err != nil {
+		requestLogger(c).Warn("GeoIP 查询失败", "clientIP", c.ClientIP(), "error", err)
+		return ""
+	}
+	return record.Country.IsoCode
+}
+
+// checkCountry 校验文件的国家限制，不允许时写入 403 COUNTRY_FORBIDDEN。
+// 未设置限制时不做检查；设置了限制但无法确定国家时拒绝访问，
+// 包括上传后 GeoIP 数据库和 GeoIP.CountryHeader 被取消配置的情况，限制不会因配置变更而静默失效
+func (h *FileHandler) checkCountry(c *gin.Context, file File) bool {
+	if file.AllowedCountries == "" {
+		return true
+	}
+	country := clientCountry(c)
+	if country != "" {
+		for _, allowed := range strings.Split(file.AllowedCountries, ",") {
+			if allowed == country {
+				return true
+			}
+		}
+	}
+	requestLogger(c).Warn("国家限制拒绝访问", "clientIP", c.ClientIP(), "accessCode", file.AccessCode, "country", country)
+	respondError(c, http.StatusForbidden, ErrCodeCountryForbidden, translate(c, msgCountryForbidden))
+	return false
+}
@@ -0,0 +1,178 @@
+// backend/geo_test.go
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// withGeoIPDatabase 生成把 networks 中每个网段映射到对应国家代码的 GeoLite2-Country 格式数据库，
+// 设为 geoIPReader，测试结束时关闭并恢复
+func withGeoIPDatabase(t *testing.T, networks map[string]string) {
+	t.Helper()
+	writer, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "GeoLite2-Country", IncludeReservedNetworks: true})
+	if err != nil {
+		t.Fatalf("mmdbwriter.New: %v", err)
+	}
+	for cidr, country := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%q): %v", cidr, err)
+		}
+		record := mmdbtype.Map{"country": mmdbtype.Map{"iso_code": mmdbtype.String(country)}}
+		if err := writer.Insert(network, record); err != nil {
+			t.Fatalf("Insert(%q): %v", cidr, err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := writer.WriteTo(f); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	f.Close()
+
+	previous := geoIPReader
+	if err := InitGeoIP(GeoIPConfig{DatabasePath: path}); err != nil {
+		t.Fatalf("InitGeoIP: %v", err)
+	}
+	reader := geoIPReader
+	t.Cleanup(func() {
+		reader.Close()
+		geoIPReader = previous
+	})
+}
+
+func TestParseAllowedCountries(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"empty", "CF-IPCountry", "", "", false},
+		{"normalized and deduplicated", "CF-IPCountry", " cn, US ,cn,", "CN,US", false},
+		{"three letters", "CF-IPCountry", "CHN", "", true},
+		{"digits", "CF-IPCountry", "C1", "", true},
+		{"non-ASCII", "CF-IPCountry", "中国", "", true},
+		{"no country source", "", "CN", "", true},
+		{"no country source, empty", "", " , ", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTestConfig(t, func(c *Config) { c.GeoIP.CountryHeader = tt.header })
+			got, err := parseAllowedCountries(tt.raw)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseAllowedCountries(%q) = %q, %v; want %q, wantErr %v", tt.raw, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseAllowedCountriesLimit(t *testing.T) {
+	withTestConfig(t, func(c *Config) { c.GeoIP.CountryHeader = "CF-IPCountry" })
+	var codes []byte
+	for i := 0; i <= MaxAllowedCountries; i++ {
+		codes = append(codes, 'A'+byte(i/26), 'A'+byte(i%26), ',')
+	}
+	if _, err := parseAllowedCountries(string(codes)); err == nil {
+		t.Errorf("parseAllowedCountries accepted %d codes", MaxAllowedCountries+1)
+	}
+}
+
+func TestParseAllowedCountriesWithDatabaseOnly(t *testing.T) {
+	withTestConfig(t, nil)
+	withGeoIPDatabase(t, map[string]string{"203.0.113.0/24": "DE"})
+	if got, err := parseAllowedCountries("de,us"); err != nil || got != "DE,US" {
+		t.Fatalf("parseAllowedCountries = %q, %v; want \"DE,US\"", got, err)
+	}
+}
+
+func TestInitGeoIPMissingDatabase(t *testing.T) {
+	previous := geoIPReader
+	t.Cleanup(func() { geoIPReader = previous })
+	if err := InitGeoIP(GeoIPConfig{DatabasePath: filepath.Join(t.TempDir(), "missing.mmdb")}); err == nil {
+		t.Fatal("数据库文件不存在时 InitGeoIP 没有返回错误")
+	}
+	if err := InitGeoIP(GeoIPConfig{}); err != nil {
+		t.Fatalf("未配置数据库时 InitGeoIP = %v", err)
+	}
+}
+
+func TestClientCountry(t *testing.T) {
+	withGeoIPDatabase(t, map[string]string{"203.0.113.0/24": "DE", "2001:db8::/32": "FR"})
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		country    string
+		want       string
+	}{
+		{"database", "", "203.0.113.7:1234", "", "DE"},
+		{"database, IPv6", "", "[2001:db8::1]:1234", "", "FR"},
+		{"not in database", "", "198.51.100.1:1234", "", ""},
+		{"header overrides database", "CF-IPCountry", "203.0.113.7:1234", "us", "US"},
+		{"falls back to database without header", "CF-IPCountry", "203.0.113.7:1234", "", "DE"},
+		{"header ignored when not configured", "", "203.0.113.7:1234", "US", "DE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTestConfig(t, func(c *Config) { c.GeoIP.CountryHeader = tt.header })
+			c := newTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/data/ABC123", nil)
+			c.Request.RemoteAddr = tt.remoteAddr
+			if tt.country != "" {
+				c.Request.Header.Set("CF-IPCountry", tt.country)
+			}
+			if got := clientCountry(c); got != tt.want {
+				t.Errorf("clientCountry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCountry(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		country    string
+		allowed    string
+		wantAccess bool
+	}{
+		{"no restriction", "CF-IPCountry", "DE", "", true},
+		{"no restriction, no source", "", "", "", true},
+		{"allowed country", "CF-IPCountry", "us", "CN,US", true},
+		{"disallowed country", "CF-IPCountry", "DE", "CN,US", false},
+		{"unknown country", "CF-IPCountry", "", "CN,US", false},
+		{"partial match is not a match", "CF-IPCountry", "C", "CN,US", false},
+		{"source removed after upload", "", "CN", "CN,US", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTestConfig(t, func(c *Config) { c.GeoIP.CountryHeader = tt.header })
+			rec := httptest.NewRecorder()
+			c := newTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodGet, "/data/ABC123", nil)
+			if tt.country != "" {
+				c.Request.Header.Set("CF-IPCountry", tt.country)
+			}
+			got := (&FileHandler{}).checkCountry(c, File{AccessCode: "ABC123", AllowedCountries: tt.allowed})
+			if got != tt.wantAccess {
+				t.Fatalf("checkCountry() = %v, want %v", got, tt.wantAccess)
+			}
+			if !got && rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", rec.Code)
+			}
+		})
+	}
+}
@@ -2,8 +2,12 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +25,7 @@ import (
 	"gorm.io/gorm"
 )
 
-// 临时的本地文件目录，仅用于病毒扫描
+// 临时的本地文件目录，仅用于病毒扫描。启动时由 ScanTempDir 配置覆盖
 var (
 	tempScanDir = filepath.Join(os.TempDir(), "tempshare-scans")
 )
@@ -29,317 +34,861 @@ type VerificationPayload struct {
 	VerificationHash string `json:"verificationHash" binding:"required"`
 }
 
+type PasswordPayload struct {
+	Password string `json:"password" binding:"required"`
+}
+
 type FileHandler struct {
 	DB      *gorm.DB
-	Scanner *ClamdScanner
+	Scanner Scanner     // 扫描被禁用时为 NoopScanner
 	Storage FileStorage // 使用抽象接口
+	Quota   *StorageQuota
+	Uploads *UploadTracker // 上传进度会话
+	Alerts  *AlertNotifier // 未配置告警时为 nil
+	// 未启用下载通知时为 nil
+	Notify *DownloadNotifier
+}
+
+// db 返回带有 ctx 中的值 (请求的 span 和 logger) 的数据库会话，启用 Tracing 时 SQL 的 span 挂在请求的 span 下。
+// 不继承 ctx 的取消: 客户端断开或请求超时不会中断已经开始的数据库操作
+func (h *FileHandler) db(ctx context.Context) *gorm.DB {
+	return h.DB.WithContext(context.WithoutCancel(ctx))
 }
 
 func (h *FileHandler) HandleStreamUpload(c *gin.Context) {
 	// --- 应用上传大小限制 ---
-	maxUploadBytes := AppConfig.MaxUploadSizeMB * 1024 * 1024
+	// 取一次快照，重新加载配置时同一个请求的限制和错误信息保持一致
+	maxUploadMB := AppConfig().MaxUploadSizeMB
+	maxUploadBytes := maxUploadMB * 1024 * 1024
 	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes)
+	// 声明的 Content-Length 已超过限制时直接拒绝，不必等到读取请求体时才由 MaxBytesReader 报错
+	if c.Request.ContentLength > maxUploadBytes {
+		requestLogger(c).Warn("上传被拒绝: Content-Length 超过大小限制", "clientIP", c.ClientIP(), "contentLength", c.Request.ContentLength)
+		respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, translate(c, msgFileTooLarge, maxUploadMB), gin.H{"maxSizeBytes": maxUploadBytes})
+		return
+	}
 
 	// --- 读取 Headers (逻辑不变) ---
+	isEncrypted, _ := strconv.ParseBool(c.GetHeader("X-File-Encrypted"))
+	// 端到端加密文件可以附带加密后的文件名，此时真实文件名只以密文形式保存，X-File-Name 即使提供也会被忽略
+	encryptedFilename, err := parseEncryptedFilename(c.GetHeader("X-File-Encrypted-Name"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidEncryptedName, MaxEncryptedFilenameLength))
+		return
+	}
+	encryptionManifest, err := parseEncryptionManifest(c.GetHeader("X-File-Encryption-Manifest"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidManifest, MaxEncryptionManifestBytes))
+		return
+	}
+	if !isEncrypted {
+		encryptedFilename, encryptionManifest = "", ""
+	}
 	fileName, err := url.QueryUnescape(c.GetHeader("X-File-Name"))
+	fileName = sanitizeFilename(fileName)
+	if encryptedFilename != "" {
+		fileName, err = encryptedDisplayName, nil
+	}
 	if err != nil || fileName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "无效或缺失的文件名 (X-File-Name)"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidFileName))
 		return
 	}
 	originalSize, err := strconv.ParseInt(c.GetHeader("X-File-Original-Size"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "无效或缺失的原始文件大小 (X-File-Original-Size)"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidOriginalSize))
 		return
 	}
-	isEncrypted, _ := strconv.ParseBool(c.GetHeader("X-File-Encrypted"))
 	salt := c.GetHeader("X-File-Salt")
 	verificationHash := c.GetHeader("X-File-Verification-Hash")
 	expiresInSeconds, _ := strconv.ParseInt(c.GetHeader("X-File-Expires-In"), 10, 64)
 	downloadOnce, _ := strconv.ParseBool(c.GetHeader("X-File-Download-Once"))
+	burnOnView, _ := strconv.ParseBool(c.GetHeader("X-File-Burn-On-View"))
+	isPublic, _ := strconv.ParseBool(c.GetHeader("X-File-Public"))
+	if !allowedExpiresIn(c.GetHeader("X-File-Expires-In")) {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgExpiryNotPreset, strings.Join(AppConfig().ExpiryPresets, ", ")))
+		return
+	}
+	expiryLabel, err := parseExpiryLabel(c.GetHeader("X-File-Expiry-Label"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidExpiryLabel, MaxExpiryLabelLength))
+		return
+	}
+	tags, err := parseFileTags(c.GetHeader("X-File-Tags"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidFileTags, MaxFileTags, MaxFileTagKeyLen, MaxFileTagValueLen))
+		return
+	}
+	allowedCountries, err := parseAllowedCountries(c.GetHeader("X-File-Allowed-Countries"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidCountries, MaxAllowedCountries))
+		return
+	}
+	notifyTarget, err := parseNotifyTarget(c.GetHeader("X-File-Notify"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidNotifyTarget, MaxNotifyTargetLength))
+		return
+	}
+	notifyEvery, _ := strconv.ParseBool(c.GetHeader("X-File-Notify-Every"))
+	description, err := parseFileDescription(c.GetHeader("X-File-Description"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidDescription, AppConfig().MaxDescriptionLength))
+		return
+	}
 
-	var expiresAt time.Time
-	if expiresInSeconds > 0 {
-		expiresAt = time.Now().Add(time.Duration(expiresInSeconds) * time.Second)
+	// 服务器端密码保护仅适用于未加密文件，端到端加密文件已由 VerificationHash 保护
+	passwordHash := c.GetHeader("X-File-Password-Hash")
+	if passwordHash != "" && !isEncrypted {
+		if err := ValidatePasswordHash(passwordHash); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidPasswordHash))
+			return
+		}
 	} else {
-		expiresAt = time.Now().Add(7 * 24 * time.Hour) // 默认值
+		passwordHash = ""
+	}
+
+	if isEncrypted {
+		if err := validateEncryptionParams(verificationHash, salt); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidE2EEParams, AppConfig().E2EE.VerificationHashLength, AppConfig().E2EE.MinSaltBytes))
+			return
+		}
+		if verificationHash, err = HashVerificationToken(verificationHash); err != nil {
+			requestLogger(c).Error("上传错误: 无法生成验证哈希", "error", err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgInternalError))
+			return
+		}
+	}
+
+	expiresIn := time.Duration(AppConfig().DefaultExpiryHours) * time.Hour // 上传者未指定时的默认有效期
+	if expiresInSeconds > 0 {
+		expiresIn = time.Duration(expiresInSeconds) * time.Second
+	}
+	if expiryLabel == "" {
+		expiryLabel = expiryLabelFor(expiresIn)
+	}
+
+	idempotency, done := h.beginIdempotentUpload(c)
+	if done {
+		return
+	}
+	session, body, ok := h.beginTrackedUpload(c)
+	if !ok {
+		h.finishIdempotentUpload(idempotency, File{}, false)
+		return
+	}
+	newFile, err := h.storeUpload(c.Request.Context(), c.ClientIP(), body, c.Request.ContentLength, File{
+		Filename:           fileName,
+		EncryptedFilename:  encryptedFilename,
+		OriginalSizeBytes:  originalSize,
+		IsEncrypted:        isEncrypted,
+		EncryptionSalt:     salt,
+		EncryptionManifest: encryptionManifest,
+		VerificationHash:   verificationHash,
+		DownloadOnce:       downloadOnce,
+		BurnOnView:         burnOnView,
+		PasswordProtected:  passwordHash != "",
+		PasswordHash:       passwordHash,
+		ExpiresAt:          time.Now().Add(expiresIn),
+		ExpiryLabel:        expiryLabel,
+		Tags:               tags,
+		IsPublic:           &isPublic,
+		AllowedCountries:   allowedCountries,
+		NotifyTarget:       notifyTarget,
+		NotifyEvery:        notifyEvery,
+		Description:        description,
+	})
+	h.Uploads.Finish(session)
+	h.finishIdempotentUpload(idempotency, newFile, err == nil)
+	if err != nil {
+		var uploadErr *uploadError
+		if errors.As(err, &uploadErr) {
+			var extra []gin.H
+			if uploadErr.code == ErrCodeFileTooLarge {
+				extra = append(extra, gin.H{"maxSizeBytes": maxUploadBytes})
+			}
+			if uploadErr.status == http.StatusInsufficientStorage {
+				setRetryAfter(c, h.Quota.RetryAfter(uploadErr.code == ErrCodeFileLimitReached))
+			}
+			respondError(c, uploadErr.status, uploadErr.code, uploadErr.localized(c), extra...)
+		} else {
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgInternalError))
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"accessCode": newFile.AccessCode, "urlPath": downloadURLPath(newFile.AccessCode), "manageToken": newFile.ManageToken})
+}
+
+// uploadError 携带应返回给客户端的 HTTP 状态码、错误码和提示信息
+type uploadError struct {
+	status  int
+	code    string
+	message messageID
+	args    []interface{}
+}
+
+func (e *uploadError) Error() string {
+	return fmt.Sprintf(messageCatalogs[defaultLanguage][e.message], e.args...)
+}
+
+// localized 返回请求语言下的提示信息
+func (e *uploadError) localized(c *gin.Context) string {
+	return translate(c, e.message, e.args...)
+}
+
+// saveError 将写入存储时的错误转换为 uploadError，请求体超过大小限制时返回 413
+func saveError(storageKey string, err error) *uploadError {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || errors.Is(err, errFileTooLarge) {
+		slog.Warn("上传被拒绝: 文件超过大小限制", "key", storageKey)
+		return &uploadError{http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, msgFileTooLarge, []interface{}{AppConfig().MaxUploadSizeMB}}
+	}
+	slog.Error("无法保存文件到最终存储", "storageType", AppConfig().Storage.Type, "key", storageKey, "error", err)
+	return &uploadError{http.StatusInternalServerError, ErrCodeStorageError, msgSaveFailed, nil}
+}
+
+// storeUpload 将 body 写入存储 (未加密文件同时扫描，开启 ScanEncryptedBlobs 时加密文件也扫描密文)、占用配额并创建数据库记录。
+// meta 提供文件名、加密、过期时间等上传选项，其余字段由本方法填充。
+// 失败时已写入的对象和配额都会被回收，返回的错误为 *uploadError。
+func (h *FileHandler) storeUpload(ctx context.Context, clientIP string, body io.Reader, contentLength int64, meta File) (File, error) {
+	// --- 文件数量上限检查 ---
+	// 在写入存储之前检查，达到上限时不必接收整个文件
+	if err := h.Quota.ReserveFile(); err != nil {
+		if errors.Is(err, ErrFileLimitReached) {
+			loggerFromContext(ctx).Warn("文件数量已达到上限，拒绝上传", "clientIP", clientIP, "maxActiveFiles", AppConfig().MaxActiveFiles)
+			return File{}, &uploadError{http.StatusInsufficientStorage, ErrCodeFileLimitReached, msgFileLimitReached, []interface{}{AppConfig().MaxActiveFiles}}
+		}
+		loggerFromContext(ctx).Error("文件数量检查失败", "error", err)
+		return File{}, &uploadError{http.StatusInternalServerError, ErrCodeInternal, msgInternalError, nil}
 	}
+	created := false
+	defer func() {
+		if !created {
+			h.Quota.ReleaseFile()
+		}
+	}()
+
+	// --- 存储配额检查 ---
+	// 在写入存储之前按 Content-Length (缺失时按 MaxUploadSizeMB) 预留空间，空间不足时不必接收整个文件，
+	// 并发的上传也不会都通过检查后一起超出上限。写入完成后再修正为实际大小
+	reserved := contentLength
+	if reserved < 0 {
+		reserved = AppConfig().MaxUploadSizeMB * 1024 * 1024
+	}
+	quotaError := func(err error, size int64) error {
+		if errors.Is(err, ErrQuotaExceeded) {
+			loggerFromContext(ctx).Warn("存储空间已满，拒绝上传", "clientIP", clientIP, "sizeBytes", size)
+			return &uploadError{http.StatusInsufficientStorage, ErrCodeStorageFull, msgStorageFull, nil}
+		}
+		loggerFromContext(ctx).Error("存储配额检查失败", "error", err)
+		return &uploadError{http.StatusInternalServerError, ErrCodeInternal, msgInternalError, nil}
+	}
+	if err := h.Quota.Reserve(reserved); err != nil {
+		return File{}, quotaError(err, reserved)
+	}
+	defer func() {
+		if !created {
+			h.Quota.Release(reserved)
+		}
+	}()
 
 	// --- 文件存储与扫描逻辑 (核心修改) ---
+	// 客户端断开时中止写入；清理操作使用不随请求取消的 context，确保残留对象被删除
+	cleanupCtx := context.WithoutCancel(ctx)
 	storageKey := uuid.NewString()
+	expiresAt := meta.ExpiresAt
 	var writtenBytes int64
 	var scanStatus, scanResult string
+	var err error
 
-	// 设计决策: 为保证扫描功能在任何存储后端下都可用，
-	// 我们先将文件流式传输到本地临时文件进行扫描，然后再上传到最终存储。
-	if !isEncrypted && h.Scanner != nil {
-		if err := os.MkdirAll(tempScanDir, os.ModePerm); err != nil {
-			slog.Error("无法创建临时扫描目录", "path", tempScanDir, "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "服务器内部错误"})
-			return
-		}
-		tempFilePath := filepath.Join(tempScanDir, storageKey)
-		tempFile, err := os.Create(tempFilePath)
-		if err != nil {
-			slog.Error("无法创建临时文件", "path", tempFilePath, "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "服务器内部错误"})
-			return
+	// 未加密文件根据前 512 字节记录 Content-Type，供下载时使用。
+	// 开启 CompressStorage 时，文本类的未加密文件以 gzip 压缩后存储。扫描器看到的仍是原始数据
+	hashing := newHashingStorage(h.Storage)
+	var storage FileStorage = hashing
+	var plain *countingReader
+	if !meta.IsEncrypted {
+		br := bufio.NewReader(body)
+		head, _ := br.Peek(512)
+		body = br
+		meta.ContentType = detectContentType(meta.Filename, head)
+		if AppConfig().CompressStorage && shouldCompress(meta.Filename, head) {
+			plain = &countingReader{r: body}
+			body = plain
+			storage = gzipStorage{hashing}
 		}
+	}
+
+	// 超过扫描大小上限的文件不经过 clamd (clamd 自身也有 StreamMaxLength 限制)
+	maxScanBytes := AppConfig().MaxScanSizeMB * 1024 * 1024
+	tooLargeToScan := maxScanBytes > 0 && contentLength > maxScanBytes
 
-		// 流式写入临时文件
-		writtenBytes, err = io.Copy(tempFile, c.Request.Body)
-		tempFile.Close() // 关闭文件以备扫描和读取
+	// 设计决策: 上传数据流在写入最终存储的同时通过 INSTREAM 交给扫描器，
+	// 不再落盘到本地临时文件，因此扫描功能在任何存储后端下都可用。
+	// 端到端加密文件默认不扫描；开启 ScanEncryptedBlobs 后扫描密文本身，用于匹配已知的恶意密文特征
+	scanBlob := !meta.IsEncrypted || AppConfig().ScanEncryptedBlobs
+	if scanBlob && scanningEnabled(h.Scanner) && !tooLargeToScan {
+		writtenBytes, scanStatus, scanResult, err = saveWhileScanning(ctx, storage, storageKey, body, h.Scanner, maxScanBytes)
 		if err != nil {
-			os.Remove(tempFilePath)
-			// ... (处理 MaxBytesError 的逻辑不变)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "文件上传中断"})
-			return
+			h.Storage.Delete(cleanupCtx, storageKey) // 尝试清理
+			return File{}, saveError(storageKey, err)
 		}
 
-		// 扫描临时文件
-		scanStatus, scanResult = h.Scanner.ScanFile(tempFilePath)
-
-		// 从临时文件重新打开并上传到最终存储
-		fileReader, err := os.Open(tempFilePath)
-		if err != nil {
-			os.Remove(tempFilePath)
-			slog.Error("无法重新打开临时文件以上传", "path", tempFilePath, "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "服务器内部错误"})
-			return
+		// Content-Length 缺失时在此处按实际大小 (压缩前) 再判断一次
+		plainBytes := writtenBytes
+		if plain != nil {
+			plainBytes = plain.n
+		}
+		if maxScanBytes > 0 && plainBytes > maxScanBytes {
+			loggerFromContext(ctx).Info("文件超过扫描大小上限，跳过扫描", "sizeBytes", plainBytes, "maxScanSizeMB", AppConfig().MaxScanSizeMB)
+			scanStatus, scanResult = ScanStatusSkipped, fmt.Sprintf("文件超过 %dMB 扫描上限，已跳过", AppConfig().MaxScanSizeMB)
 		}
-		defer fileReader.Close()
-		defer os.Remove(tempFilePath) // 确保临时文件最终被删除
 
-		_, err = h.Storage.Save(storageKey, fileReader)
-		if err != nil {
-			slog.Error("无法保存文件到最终存储", "storageType", AppConfig.Storage.Type, "key", storageKey, "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "无法保存文件"})
-			return
+		// 被感染的文件移入隔离区，不与正常文件混放
+		if scanStatus == ScanStatusInfected {
+			quarantinedKey, err := moveToQuarantine(cleanupCtx, h.Storage, storageKey)
+			if err != nil {
+				h.Storage.Delete(cleanupCtx, storageKey)
+				loggerFromContext(ctx).Error("无法隔离被感染的文件", "key", storageKey, "error", err)
+				return File{}, &uploadError{http.StatusInternalServerError, ErrCodeStorageError, msgSaveFailed, nil}
+			}
+			storageKey = quarantinedKey
+			expiresAt = quarantineExpiry(expiresAt)
 		}
 
 	} else {
 		// 如果是加密文件或扫描器不可用，直接流式传输到最终存储
-		var err error
-		writtenBytes, err = h.Storage.Save(storageKey, c.Request.Body)
+		writtenBytes, err = storage.Save(ctx, storageKey, body)
 		if err != nil {
-			h.Storage.Delete(storageKey) // 尝试清理
-			// ... (处理 MaxBytesError 的逻辑)
-			slog.Error("无法保存文件到最终存储", "storageType", AppConfig.Storage.Type, "key", storageKey, "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "无法保存文件"})
-			return
+			h.Storage.Delete(cleanupCtx, storageKey) // 尝试清理
+			return File{}, saveError(storageKey, err)
 		}
 		// 根据情况设置扫描状态
-		if isEncrypted {
+		if !scanBlob {
 			scanStatus, scanResult = ScanStatusClean, "端到端加密文件，服务器未扫描"
+		} else if tooLargeToScan && scanningEnabled(h.Scanner) {
+			loggerFromContext(ctx).Info("文件超过扫描大小上限，跳过扫描", "sizeBytes", writtenBytes, "maxScanSizeMB", AppConfig().MaxScanSizeMB)
+			scanStatus, scanResult = ScanStatusSkipped, fmt.Sprintf("文件超过 %dMB 扫描上限，已跳过", AppConfig().MaxScanSizeMB)
 		} else {
 			scanStatus, scanResult = ScanStatusSkipped, "扫描器不可用，已跳过"
 		}
 	}
 
+	// --- 按实际大小修正预留的配额 ---
+	if err := h.Quota.Adjust(reserved, writtenBytes); err != nil {
+		h.Storage.Delete(cleanupCtx, storageKey)
+		return File{}, quotaError(err, writtenBytes)
+	}
+	reserved = writtenBytes
+
 	// --- 数据库记录 (逻辑微调) ---
-	accessCode, err := h.generateUniqueAccessCode(6)
+	accessCode, err := h.generateUniqueAccessCode(AppConfig().AccessCodeLength)
 	if err != nil {
-		h.Storage.Delete(storageKey) // 清理已上传的文件
-		slog.Error("无法生成分享码", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "无法生成分享码"})
-		return
+		h.Storage.Delete(cleanupCtx, storageKey) // 清理已上传的文件
+		loggerFromContext(ctx).Error("无法生成分享码", "error", err)
+		return File{}, &uploadError{http.StatusInternalServerError, ErrCodeInternal, msgAccessCodeFailed, nil}
+	}
+
+	manageToken, manageTokenHash, err := newManageToken()
+	if err != nil {
+		h.Storage.Delete(cleanupCtx, storageKey)
+		loggerFromContext(ctx).Error("无法生成管理令牌", "error", err)
+		return File{}, &uploadError{http.StatusInternalServerError, ErrCodeInternal, msgInternalError, nil}
 	}
 
-	newFile := File{
-		ID:                uuid.NewString(), // 使用独立的UUID作为主键
-		AccessCode:        accessCode,
-		Filename:          fileName,
-		SizeBytes:         writtenBytes,
-		OriginalSizeBytes: originalSize,
-		IsEncrypted:       isEncrypted,
-		EncryptionSalt:    salt,
-		VerificationHash:  verificationHash,
-		StorageKey:        storageKey, // 使用 storageKey
-		DownloadOnce:      downloadOnce,
-		ExpiresAt:         expiresAt,
-		CreatedAt:         time.Now(),
-		ScanStatus:        scanStatus,
-		ScanResult:        scanResult,
+	newFile := meta
+	newFile.ID = uuid.NewString() // 使用独立的UUID作为主键
+	newFile.AccessCode = accessCode
+	newFile.ManageToken = manageToken
+	newFile.ManageTokenHash = manageTokenHash
+	newFile.SizeBytes = writtenBytes
+	if newFile.OriginalSizeBytes == 0 {
+		newFile.OriginalSizeBytes = writtenBytes
 	}
+	if plain != nil {
+		// SizeBytes 为实际占用的存储空间，OriginalSizeBytes 为解压后的大小
+		newFile.Compressed = true
+		newFile.OriginalSizeBytes = plain.n
+	}
+	newFile.StorageKey = storageKey
+	newFile.ContentHash = hashing.sum()
+	newFile.ExpiresAt = expiresAt
+	newFile.CreatedAt = time.Now()
+	newFile.ScanStatus = scanStatus
+	newFile.ScanResult = scanResult
+
+	if err := h.db(ctx).Create(&newFile).Error; err != nil {
+		h.Storage.Delete(cleanupCtx, storageKey) // 清理已上传的文件
+		loggerFromContext(ctx).Error("无法保存文件记录到数据库", "error", err)
+		return File{}, &uploadError{http.StatusInternalServerError, ErrCodeInternal, msgSaveRecordFailed, nil}
+	}
+	created = true
+	loggerFromContext(ctx).Info("上传成功", "clientIP", clientIP, "accessCode", accessCode, "key", storageKey, "scanStatus", scanStatus, "compressed", newFile.Compressed)
+	if scanStatus == ScanStatusInfected {
+		h.Alerts.NotifyInfected(InfectionAlert{AccessCode: accessCode, VirusName: scanResult, ClientIP: clientIP, Source: "upload"})
+	}
+	return newFile, nil
+}
+
+// 分享码过期后的响应方式，见 respondFileExpired
+const (
+	ExpiredCodeResponseGeneric  = "generic"
+	ExpiredCodeResponseDistinct = "distinct"
+)
 
-	if err := h.DB.Create(&newFile).Error; err != nil {
-		h.Storage.Delete(storageKey) // 清理已上传的文件
-		slog.Error("无法保存文件记录到数据库", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "无法保存文件记录"})
+// respondFileExpired 响应已过期 (或一次性下载已被消费) 的分享码。默认 generic 与不存在的分享码一样返回 404 FILE_NOT_FOUND，
+// 无法据此判断某个分享码是否曾经存在；distinct 返回 410 FILE_EXPIRED，提示用户请分享者重新分享。
+// 已被清理任务删除的过期文件没有记录可查，始终按不存在处理
+func respondFileExpired(c *gin.Context) {
+	if strings.EqualFold(AppConfig().ExpiredCodeResponse, ExpiredCodeResponseDistinct) {
+		respondError(c, http.StatusGone, ErrCodeFileExpired, translate(c, msgFileExpired))
 		return
 	}
-	slog.Info("上传成功", "clientIP", c.ClientIP(), "accessCode", accessCode, "key", storageKey, "scanStatus", scanStatus)
-	c.JSON(http.StatusCreated, gin.H{"accessCode": accessCode, "urlPath": fmt.Sprintf("/download/%s", accessCode)})
+	respondError(c, http.StatusNotFound, ErrCodeFileNotFound, translate(c, msgFileNotFound))
+}
+
+// findActiveFile 按分享码查找文件。不存在时写入 FILE_NOT_FOUND，已过期 (尚未被清理) 时按 ExpiredCodeResponse 响应，
+// 因举报被下架时写入 451 FILE_QUARANTINED
+func (h *FileHandler) findActiveFile(c *gin.Context, code string) (File, bool) {
+	file, cached := fileCache.Get(code)
+	if !cached {
+		if err := h.db(c.Request.Context()).Where("access_code = ?", code).First(&file).Error; err != nil {
+			respondError(c, http.StatusNotFound, ErrCodeFileNotFound, translate(c, msgFileNotFound))
+			return File{}, false
+		}
+		fileCache.Add(file)
+	}
+	if !time.Now().Before(file.ExpiresAt) {
+		respondFileExpired(c)
+		return File{}, false
+	}
+	if file.Quarantined {
+		respondError(c, http.StatusUnavailableForLegalReasons, ErrCodeFileQuarantined, translate(c, msgFileQuarantined))
+		return File{}, false
+	}
+	return file, true
 }
 
 func (h *FileHandler) HandleDownloadFile(c *gin.Context) {
-	code := c.Param("code")
-	var file File
-	if err := h.DB.Where("access_code = ?", code).First(&file).Error; err != nil {
-		// ... (错误处理逻辑不变)
-		c.JSON(http.StatusNotFound, gin.H{"message": "文件不存在或已过期"})
+	file, ok := h.findActiveFile(c, c.Param("code"))
+	if !ok {
 		return
 	}
 
-	// 检查过期 (在查询后再次检查，更保险)
-	if time.Now().After(file.ExpiresAt) {
-		c.JSON(http.StatusNotFound, gin.H{"message": "文件已过期"})
+	// 被感染的文件已被隔离，禁止下载
+	if file.ScanStatus == ScanStatusInfected {
+		requestLogger(c).Warn("拒绝下载被感染的文件", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+		respondError(c, http.StatusUnavailableForLegalReasons, ErrCodeFileInfected, translate(c, msgFileInfected))
+		return
+	}
+	if !h.checkCountry(c, file) {
+		return
+	}
+	signed, ok := verifyDownloadSignature(c, file)
+	if !ok {
 		return
 	}
 
-	// 加密文件密码验证
-	if file.IsEncrypted {
+	// 有效的签名链接由持有管理令牌的上传者签发，代替密码验证；否则加密文件需要验证哈希
+	if signed {
+		requestLogger(c).Info("签名链接验证成功，开始下载", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+	} else if file.IsEncrypted {
 		if c.Request.Method != "POST" {
-			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "下载加密文件需要使用 POST 方法"})
+			respondError(c, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, translate(c, msgEncryptedNeedsPost))
 			return
 		}
 		var payload VerificationPayload
 		if err := c.ShouldBindJSON(&payload); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "无效的验证请求"})
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidVerification))
+			return
+		}
+		if !VerifyVerificationToken(file.VerificationHash, payload.VerificationHash) {
+			requestLogger(c).Warn("密码验证失败", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+			respondError(c, http.StatusUnauthorized, ErrCodeWrongPassword, translate(c, msgWrongPassword))
+			return
+		}
+		requestLogger(c).Info("密码验证成功，开始下载", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+	} else if file.PasswordProtected {
+		if c.Request.Method != "POST" {
+			respondError(c, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, translate(c, msgProtectedNeedsPost))
+			return
+		}
+		var payload PasswordPayload
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidVerification))
 			return
 		}
-		if payload.VerificationHash != file.VerificationHash {
-			slog.Warn("密码验证失败", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "密码错误"})
+		if !h.checkFilePassword(c, file, payload.Password) {
 			return
 		}
-		slog.Info("密码验证成功，开始下载", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+		requestLogger(c).Info("密码验证成功，开始下载", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+	}
+	// 加密和受密码保护的文件必须 POST 提交凭据，本身就是一次确认；其余一次性下载需要确认令牌
+	if file.DownloadOnce && (signed || (!file.IsEncrypted && !file.PasswordProtected)) && !confirmDownloadOnce(c, file) {
+		return
+	}
+
+	if notModified(c, file, "private, no-cache") {
+		return
 	}
 
 	// --- 从存储后端获取文件流并发送 (核心修改) ---
-	reader, err := h.Storage.Retrieve(file.StorageKey)
+	if err := checkStoredSize(c.Request.Context(), h.Storage, file); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, ErrCodeFileMissing, translate(c, msgFileMissing))
+		} else {
+			respondError(c, http.StatusInternalServerError, ErrCodeIntegrityFailed, translate(c, msgIntegrityFailed))
+		}
+		return
+	}
+	reader, err := retrieveVerifiedFile(c.Request.Context(), h.Storage, file)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"message": "物理文件丢失"})
+			respondError(c, http.StatusNotFound, ErrCodeFileMissing, translate(c, msgFileMissing))
 		} else {
-			slog.Error("下载失败: 无法从存储后端获取文件", "key", file.StorageKey, "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "无法获取文件"})
+			requestLogger(c).Error("下载失败: 无法从存储后端获取文件", "key", file.StorageKey, "error", err)
+			respondError(c, http.StatusInternalServerError, ErrCodeStorageError, translate(c, msgRetrieveFailed))
 		}
 		return
 	}
 	defer reader.Close()
 
-	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename*=UTF-8''%s`, url.PathEscape(file.Filename)))
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Length", strconv.FormatInt(file.SizeBytes, 10))
+	// 一次性下载在开始传输前同步标记为已消费，之后的请求立即返回 404，不依赖存储对象何时被删除
+	if file.DownloadOnce && !h.claimDownloadOnce(file) {
+		respondFileExpired(c)
+		return
+	}
 
+	setDownloadHeaders(c, file)
+
+	h.recordAccess(file, statDownloadCount)
+	h.Notify.NotifyDownload(file, c.ClientIP())
 	_, err = io.Copy(c.Writer, reader)
 	if err != nil {
-		slog.Error("流式传输文件到客户端时出错", "key", file.StorageKey, "clientIP", c.ClientIP(), "error", err)
+		requestLogger(c).Error("流式传输文件到客户端时出错", "key", file.StorageKey, "clientIP", c.ClientIP(), "error", err)
 	}
 
 	h.handleDownloadOnce(c, file)
 }
 
+// setDownloadHeaders 设置下载响应的 Content-Disposition、Content-Type、Content-Length 等响应头，GET/POST 下载和 HEAD 共用
+func setDownloadHeaders(c *gin.Context, file File) {
+	// 默认以附件形式下载；?disposition=inline 时让浏览器直接打开 (例如查看 PDF)，
+	// 加密文件、未记录类型的文件和可能执行脚本的类型 (HTML/SVG 等) 仍然作为附件
+	disposition := "attachment"
+	if c.Query("disposition") == "inline" && !file.IsEncrypted && inlineDownloadAllowed(file.ContentType) {
+		disposition = "inline"
+	}
+	if file.IsEncrypted {
+		// 下载的是密文，客户端解密后自行命名；不在响应头中暴露文件名
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, encryptedDisplayName))
+	} else {
+		// ?filename= 只改变保存时的文件名，不修改记录；无效时回退到上传时的文件名
+		downloadName := file.Filename
+		if override := sanitizeFilename(c.Query("filename")); override != "" {
+			downloadName = override
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`%s; filename*=UTF-8''%s`, disposition, url.PathEscape(downloadName)))
+	}
+	// 使用上传时检测到的类型，附件下载时只作为类型提示；未记录类型的文件 (加密文件、旧记录) 使用 octet-stream
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Length", strconv.FormatInt(file.contentLength(), 10))
+	// 下载不支持 Range 请求，断点续传的客户端需要重新下载整个文件
+	c.Header("Accept-Ranges", "none")
+}
+
+// HandleDownloadHead 响应 HEAD /data/:code，供下载管理器和链接检查工具在下载前获取大小和类型。
+// 只根据数据库记录返回与下载相同的响应头，不读取存储对象，也不会触发一次性下载的销毁、访问统计或下载通知。
+// 加密文件返回密文的大小且不暴露文件名；受密码保护的文件与 GET 一样需要 POST 提交密码 (签名链接除外)
+func (h *FileHandler) HandleDownloadHead(c *gin.Context) {
+	file, ok := h.findActiveFile(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	if file.ScanStatus == ScanStatusInfected {
+		respondError(c, http.StatusUnavailableForLegalReasons, ErrCodeFileInfected, translate(c, msgFileInfected))
+		return
+	}
+	if !h.checkCountry(c, file) {
+		return
+	}
+	signed, ok := verifyDownloadSignature(c, file)
+	if !ok {
+		return
+	}
+	if file.PasswordProtected && !file.IsEncrypted && !signed {
+		respondError(c, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, translate(c, msgProtectedNeedsPost))
+		return
+	}
+	if notModified(c, file, "private, no-cache") {
+		return
+	}
+	setDownloadHeaders(c, file)
+	c.Status(http.StatusOK)
+}
+
+// fileETag 基于存储键和大小生成强 ETag。存储对象写入后不会再改变，因此二者足以标识内容，
+// 哈希后再输出以避免泄露存储键
+func fileETag(file File) string {
+	sum := sha256.Sum256([]byte(file.StorageKey + ":" + strconv.FormatInt(file.SizeBytes, 10)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified 设置缓存相关响应头，并在 If-None-Match 命中时返回 304。
+// 阅后即焚文件禁止任何缓存，以免在销毁后仍被浏览器或代理提供。
+func notModified(c *gin.Context, file File, cacheControl string) bool {
+	if file.DownloadOnce {
+		c.Header("Cache-Control", "no-store")
+		return false
+	}
+	etag := fileETag(file)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// checkFilePassword 校验受密码保护文件的明文密码，失败时直接写入 401 响应
+func (h *FileHandler) checkFilePassword(c *gin.Context, file File, password string) bool {
+	if password == "" {
+		respondError(c, http.StatusUnauthorized, ErrCodePasswordRequired, translate(c, msgPasswordRequired), gin.H{"passwordProtected": true})
+		return false
+	}
+	if !VerifyPassword(file.PasswordHash, password) {
+		requestLogger(c).Warn("密码验证失败", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+		respondError(c, http.StatusUnauthorized, ErrCodeWrongPassword, translate(c, msgWrongPassword), gin.H{"passwordProtected": true})
+		return false
+	}
+	return true
+}
+
+type downloadConfirmPayload struct {
+	DownloadToken string `json:"downloadToken" form:"downloadToken"`
+}
+
+// confirmDownloadOnce 要求一次性下载分两步完成: GET 只返回文件信息和确认令牌，携带令牌的 POST 才会传输并销毁文件。
+// 聊天软件的链接预览和爬虫只会发送 GET，不会消耗唯一的一次下载。令牌可以放在 JSON 或表单字段 downloadToken 中，
+// 表单提交时浏览器会直接保存响应的文件。返回 false 时响应已写入
+func confirmDownloadOnce(c *gin.Context, file File) bool {
+	c.Header("Cache-Control", "no-store")
+	if c.Request.Method != http.MethodPost {
+		token, expiresAt := issueDownloadConfirmToken(file)
+		filename := file.Filename
+		if file.IsEncrypted {
+			filename = encryptedDisplayName
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"accessCode":           file.AccessCode,
+			"filename":             filename,
+			"sizeBytes":            file.contentLength(),
+			"downloadOnce":         true,
+			"confirmationRequired": true,
+			"downloadToken":        token,
+			"tokenExpiresAt":       expiresAt,
+		})
+		return false
+	}
+	var payload downloadConfirmPayload
+	if err := c.ShouldBind(&payload); err != nil || !verifyDownloadConfirmToken(file, payload.DownloadToken) {
+		requestLogger(c).Warn("一次性下载确认令牌无效", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+		respondError(c, http.StatusForbidden, ErrCodeInvalidConfirm, translate(c, msgInvalidDownloadToken))
+		return false
+	}
+	return true
+}
+
+// claimDownloadOnce 把一次性下载文件标记为已消费并立即过期。条件更新保证并发请求中只有一个能成功
+func (h *FileHandler) claimDownloadOnce(file File) bool {
+	now := time.Now()
+	result := h.DB.Model(&File{}).Where("id = ? AND consumed_at IS NULL", file.ID).
+		Updates(map[string]interface{}{"consumed_at": now, "expires_at": now})
+	fileCache.Invalidate(file.AccessCode)
+	if result.Error != nil {
+		slog.Error("阅后即焚错误: 无法标记文件为已消费", "id", file.ID, "error", result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
 // 修改为 Handler 的方法，以便访问 h.Storage
+// handleDownloadOnce 在一次性下载完成后尽快删除文件。文件在下载开始时已被标记为过期，
+// 这里只是提前执行清理；删除失败时由 CleanupExpiredFilesTask 重试
 func (h *FileHandler) handleDownloadOnce(c *gin.Context, file File) {
-	if file.DownloadOnce && c.Writer.Status() == http.StatusOK {
-		// 使用 goroutine 异步执行，不阻塞下载响应
-		go func(f File) {
-			time.Sleep(2 * time.Second) // 等待一会确保连接关闭
-			slog.Info("阅后即焚: 文件已被下载，即将销毁", "filename", f.Filename, "key", f.StorageKey)
-			if err := h.Storage.Delete(f.StorageKey); err != nil {
-				slog.Error("阅后即焚错误: 删除存储对象失败", "key", f.StorageKey, "error", err)
-			}
-			if err := h.DB.Delete(&File{}, "id = ?", f.ID).Error; err != nil {
-				slog.Error("阅后即焚错误: 删除数据库记录失败", "id", f.ID, "error", err)
-			}
-		}(file)
+	if !file.DownloadOnce {
+		return
 	}
+	// 使用 goroutine 异步执行，不阻塞下载响应。gin.Context 在请求结束后会被复用，这里只保留 logger
+	logger := requestLogger(c)
+	go func(f File) {
+		time.Sleep(2 * time.Second) // 等待一会确保连接关闭
+		logger.Info("阅后即焚: 文件已被下载，即将销毁", "filename", f.Filename, "key", f.StorageKey)
+		if err := purgeFile(contextWithLogger(context.Background(), logger), h.DB, h.Storage, h.Quota, f); err != nil {
+			logger.Error("阅后即焚错误: 删除文件失败，将由清理任务重试", "id", f.ID, "error", err)
+		}
+	}(file)
 }
 
 func (h *FileHandler) HandlePreviewFile(c *gin.Context) {
-	code := c.Param("code")
-	var file File
-	if err := h.DB.Where("access_code = ? AND expires_at > ?", code, time.Now()).First(&file).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "文件不存在或已过期"})
+	file, ok := h.findActiveFile(c, c.Param("code"))
+	if !ok {
 		return
 	}
 	// ... (权限检查逻辑不变)
 	if file.IsEncrypted || file.ScanStatus == ScanStatusInfected {
-		c.JSON(http.StatusForbidden, gin.H{"message": "文件无法预览"})
+		respondError(c, http.StatusForbidden, ErrCodePreviewUnavailable, translate(c, msgPreviewUnavailable))
+		return
+	}
+	if !h.checkCountry(c, file) {
+		return
+	}
+	if file.PasswordProtected && !h.checkFilePassword(c, file, c.GetHeader("X-File-Password")) {
+		return
+	}
+	if notModified(c, file, "private, max-age=300") {
 		return
 	}
 
-	reader, err := h.Storage.Retrieve(file.StorageKey)
+	// 上传时已保存 Content-Type 的文件在读取存储前即可判断能否预览
+	if file.ContentType != "" {
+		if contentType, _ := previewContentType(file, nil); !previewRenderable(contentType) {
+			respondError(c, http.StatusUnsupportedMediaType, ErrCodePreviewUnavailable, translate(c, msgPreviewTypeInline))
+			return
+		}
+	}
+
+	// 压缩存储的文件在客户端接受 gzip 时 (即使更偏好 br) 直接发送存储中的 gzip 数据，不必解压后再压缩一遍。
+	// 旧记录需要先嗅探解压后的内容，不走这条路径
+	encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+	passthrough := file.Compressed && file.ContentType != "" && acceptsEncoding(c.GetHeader("Accept-Encoding"), "gzip")
+	var reader io.ReadCloser
+	var err error
+	if passthrough {
+		reader, err = h.Storage.Retrieve(c.Request.Context(), file.StorageKey)
+	} else {
+		reader, err = retrieveFile(c.Request.Context(), h.Storage, file)
+	}
 	if err != nil {
-		slog.Error("预览错误: 无法读取文件", "storageKey", file.StorageKey, "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "无法读取文件内容"})
+		requestLogger(c).Error("预览错误: 无法读取文件", "storageKey", file.StorageKey, "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeStorageError, translate(c, msgReadFailed))
 		return
 	}
 	defer reader.Close()
 
-	// 需要读取一部分来判断 Content-Type
-	buffer := make([]byte, 512)
-	n, err := reader.Read(buffer)
-	if err != nil && err != io.EOF {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "读取文件时出错"})
-		return
+	// 旧记录没有保存 Content-Type，需要读取一部分来判断
+	var buffer []byte
+	if file.ContentType == "" {
+		buffer = make([]byte, 512)
+		n, err := io.ReadFull(reader, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			respondError(c, http.StatusInternalServerError, ErrCodeStorageError, translate(c, msgReadFailed))
+			return
+		}
+		buffer = buffer[:n]
 	}
 
-	ext := filepath.Ext(file.Filename)
-	var contentType string
-
-	// Map of Office extensions to their MIME types
-	officeMimeTypes := map[string]string{
-		".ppt":  "application/vnd.ms-powerpoint",
-		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
-		".doc":  "application/msword",
-		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
-		".xls":  "application/vnd.ms-excel",
-		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	contentType, inline := previewContentType(file, buffer)
+	if !previewRenderable(contentType) {
+		respondError(c, http.StatusUnsupportedMediaType, ErrCodePreviewUnavailable, translate(c, msgPreviewTypeInline))
+		return
 	}
-
-	// Check if the file is an Office document
-	if mime, isOffice := officeMimeTypes[ext]; isOffice {
-		contentType = mime
-		// For Office documents, we do not set Content-Disposition
-	} else {
-		// For other files, detect content type and set Content-Disposition to inline
-		contentType = http.DetectContentType(buffer[:n])
+	if inline {
 		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename*=UTF-8''%s`, url.PathEscape(file.Filename)))
 	}
+	if previewNeedsSandbox(contentType) {
+		// 防止上传的 SVG/HTML 在本站源下执行脚本
+		c.Header("Content-Security-Policy", "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline'")
+	}
 
 	c.Header("Content-Type", contentType)
 	c.Header("X-Content-Type-Options", "nosniff")
-	c.Header("Content-Length", strconv.FormatInt(file.SizeBytes, 10))
+
+	// 文本类内容 (文本、JSON、SVG 等) 按 Accept-Encoding 压缩传输；图片、视频等已压缩的格式和过小的文件原样发送。
+	// 与 ResponseCompressionMiddleware 共用 ResponseCompression 的配置，这里设置了 Content-Encoding 后中间件不会再压缩
+	var out io.Writer = c.Writer
+	switch {
+	case passthrough:
+		c.Header("Vary", "Accept-Encoding")
+		c.Header("Content-Encoding", "gzip")
+		c.Header("Content-Length", strconv.FormatInt(file.SizeBytes, 10))
+	case AppConfig().ResponseCompression.Enabled && compressibleContentType(contentType) &&
+		file.contentLength() >= int64(AppConfig().ResponseCompression.MinSizeBytes):
+		c.Header("Vary", "Accept-Encoding")
+		if encoding == "" {
+			c.Header("Content-Length", strconv.FormatInt(file.contentLength(), 10))
+			break
+		}
+		// 压缩后的长度事先未知，以分块编码发送
+		c.Header("Content-Encoding", encoding)
+		encoder := newEncodingWriter(c.Writer, encoding)
+		defer encoder.Close()
+		out = encoder
+	default:
+		c.Header("Content-Length", strconv.FormatInt(file.contentLength(), 10))
+	}
 
 	// 先把已读的 buffer 写回去，再把剩下的流拷贝过去
-	c.Writer.Write(buffer[:n])
-	io.Copy(c.Writer, reader)
+	out.Write(buffer)
+	io.Copy(out, reader)
 }
 
 // 其他 Handler (HandleGetFileMeta, HandleGetPublicFiles, HandleReport, HandlePreviewDataURI, generateUniqueAccessCode) 基本不变
 // HandlePreviewDataURI 也需要修改为从 h.Storage 读取
 func (h *FileHandler) HandlePreviewDataURI(c *gin.Context) {
-	code := c.Param("code")
-	var file File
-
-	if err := h.DB.Where("access_code = ? AND expires_at > ?", code, time.Now()).First(&file).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "文件不存在或已过期"})
+	file, ok := h.findActiveFile(c, c.Param("code"))
+	if !ok {
 		return
 	}
 	if file.IsEncrypted || file.ScanStatus == ScanStatusInfected {
-		c.JSON(http.StatusForbidden, gin.H{"message": "文件无法预览"})
+		respondError(c, http.StatusForbidden, ErrCodePreviewUnavailable, translate(c, msgPreviewUnavailable))
+		return
+	}
+	if !h.checkCountry(c, file) {
+		return
+	}
+	if file.PasswordProtected && !h.checkFilePassword(c, file, c.GetHeader("X-File-Password")) {
+		return
+	}
+	// Data URI 需要把整个文件读入内存并做 base64 编码，超过上限的文件在读取前直接拒绝
+	maxBytes := AppConfig().MaxDataURISizeMB * 1024 * 1024
+	if file.contentLength() > maxBytes {
+		respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, translate(c, msgDataURITooLarge), gin.H{"maxSizeBytes": maxBytes})
 		return
 	}
 
-	reader, err := h.Storage.Retrieve(file.StorageKey)
+	reader, err := retrieveFile(c.Request.Context(), h.Storage, file)
 	if err != nil {
-		slog.Error("Data URI 预览错误: 无法读取文件", "storageKey", file.StorageKey, "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "无法读取文件内容"})
+		requestLogger(c).Error("Data URI 预览错误: 无法读取文件", "storageKey", file.StorageKey, "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeStorageError, translate(c, msgReadFailed))
 		return
 	}
 	defer reader.Close()
 
-	fileBytes, err := io.ReadAll(reader)
+	// 多读一个字节，防止数据库中的大小与实际对象不一致
+	fileBytes, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
 	if err != nil {
-		slog.Error("Data URI 预览错误: 读取流失败", "storageKey", file.StorageKey, "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "无法读取文件内容"})
+		requestLogger(c).Error("Data URI 预览错误: 读取流失败", "storageKey", file.StorageKey, "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeStorageError, translate(c, msgReadFailed))
+		return
+	}
+	if int64(len(fileBytes)) > maxBytes {
+		respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, translate(c, msgDataURITooLarge), gin.H{"maxSizeBytes": maxBytes})
 		return
 	}
 
 	base64Data := base64.StdEncoding.EncodeToString(fileBytes)
-	contentType := http.DetectContentType(fileBytes)
+	contentType, _ := previewContentType(file, fileBytes)
 	dataURI := fmt.Sprintf("data:%s;base64,%s", contentType, base64Data)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -349,26 +898,43 @@ func (h *FileHandler) HandlePreviewDataURI(c *gin.Context) {
 
 // --- 不变的 Handler 函数 ---
 func (h *FileHandler) HandleGetFileMeta(c *gin.Context) {
-	code := c.Param("code")
-	var file File
-	if err := h.DB.Where("access_code = ? AND expires_at > ?", code, time.Now()).First(&file).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "文件不存在或已过期"})
+	file, ok := h.findActiveFile(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	if file.PasswordProtected && !h.checkFilePassword(c, file, c.GetHeader("X-File-Password")) {
 		return
 	}
-	c.JSON(http.StatusOK, file)
+	if file.BurnOnView && !h.claimBurnOnView(&file) {
+		respondFileExpired(c)
+		return
+	}
+	h.recordAccess(file, statViewCount)
+	c.JSON(http.StatusOK, newFileMetaResponse(file, time.Now()))
 }
 
-func (h *FileHandler) HandleGetPublicFiles(c *gin.Context) {
-	var files []File
-	result := h.DB.Select("access_code", "filename", "size_bytes", "expires_at", "is_encrypted").
-		Where("expires_at > ? AND is_encrypted = false AND download_once = false", time.Now()).
-		Order("created_at desc").Limit(20).Find(&files)
+// claimBurnOnView 在元信息首次被读取时将文件标记为已查看，并把过期时间提前到宽限期结束，
+// 过期后由清理任务删除存储对象。条件更新保证并发请求中只有一个能成功，之后的请求都返回 false
+func (h *FileHandler) claimBurnOnView(file *File) bool {
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(AppConfig().BurnOnViewGraceSeconds) * time.Second)
+	if expiresAt.After(file.ExpiresAt) {
+		expiresAt = file.ExpiresAt
+	}
+	result := h.DB.Model(&File{}).Where("id = ? AND viewed_at IS NULL", file.ID).
+		Updates(map[string]interface{}{"viewed_at": now, "expires_at": expiresAt})
+	fileCache.Invalidate(file.AccessCode)
 	if result.Error != nil {
-		slog.Error("查询公开文件列表失败", "error", result.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "查询公开文件列表失败"})
-		return
+		slog.Error("阅后即焚(查看)错误: 无法标记文件", "id", file.ID, "error", result.Error)
+		return false
 	}
-	c.JSON(http.StatusOK, files)
+	if result.RowsAffected == 0 {
+		return false
+	}
+	slog.Info("阅后即焚(查看): 文件元信息已被读取，即将失效", "accessCode", file.AccessCode, "expiresAt", expiresAt)
+	file.ViewedAt = &now
+	file.ExpiresAt = expiresAt
+	return true
 }
 
 func (h *FileHandler) HandleReport(c *gin.Context) {
@@ -377,29 +943,68 @@ func (h *FileHandler) HandleReport(c *gin.Context) {
 		Reason     string `json:"reason"`
 	}
 	if err := c.ShouldBindJSON(&reportData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的举报请求"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidReport))
 		return
 	}
 	report := Report{AccessCode: reportData.AccessCode, Reason: reportData.Reason, ReporterIP: c.ClientIP()}
-	if err := h.DB.Create(&report).Error; err != nil {
-		slog.Error("无法提交举报到数据库", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "无法提交举报，请稍后再试"})
+	if err := h.db(c.Request.Context()).Create(&report).Error; err != nil {
+		requestLogger(c).Error("无法提交举报到数据库", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgReportFailed))
 		return
 	}
-	slog.Info("收到举报", "clientIP", c.ClientIP(), "accessCode", report.AccessCode, "reason", report.Reason)
-	c.JSON(http.StatusOK, gin.H{"message": "您的举报已收到，感谢您的帮助！我们将会尽快处理。"})
+	requestLogger(c).Info("收到举报", "clientIP", c.ClientIP(), "accessCode", report.AccessCode, "reason", report.Reason)
+	// 举报已保存，下架判断失败只记录日志，不影响举报结果
+	if _, err := applyReportTakedown(h.db(c.Request.Context()), report.AccessCode); err != nil {
+		requestLogger(c).Error("举报下架判断失败", "accessCode", report.AccessCode, "error", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": translate(c, msgReportReceived)})
 }
 
-const codeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+// 分享码字符集: safe 去除了易混淆的字符 (0/O, 1/I/L)，base62 提供更大的码空间
+const (
+	AccessCodeCharsetSafe   = "safe"
+	AccessCodeCharsetBase62 = "base62"
+
+	MinAccessCodeLength = 4
+	MaxAccessCodeLength = 32
+)
+
+var accessCodeCharsets = map[string]string{
+	AccessCodeCharsetSafe:   "ABCDEFGHJKLMNPQRSTUVWXYZ23456789",
+	AccessCodeCharsetBase62: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+}
+
+// accessCodeAlphabet 根据配置名称返回分享码字符集，空值使用 safe
+func accessCodeAlphabet(name string) (string, error) {
+	if name == "" {
+		name = AccessCodeCharsetSafe
+	}
+	chars, ok := accessCodeCharsets[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("不支持的分享码字符集: %s (可选 %s, %s)", name, AccessCodeCharsetSafe, AccessCodeCharsetBase62)
+	}
+	return chars, nil
+}
 
 func (h *FileHandler) generateUniqueAccessCode(length int) (string, error) {
+	codeChars, err := accessCodeAlphabet(AppConfig().AccessCodeCharset)
+	if err != nil {
+		return "", err
+	}
+	// 拒绝采样的上限，避免取模带来的字符分布偏差
+	maxByte := 256 - 256%len(codeChars)
 	for i := 0; i < 20; i++ {
-		buffer := make([]byte, length)
-		if _, err := rand.Read(buffer); err != nil {
-			return "", err
-		}
-		for i := 0; i < length; i++ {
-			buffer[i] = codeChars[int(buffer[i])%len(codeChars)]
+		buffer := make([]byte, 0, length)
+		random := make([]byte, length)
+		for len(buffer) < length {
+			if _, err := rand.Read(random); err != nil {
+				return "", err
+			}
+			for _, b := range random {
+				if int(b) < maxByte && len(buffer) < length {
+					buffer = append(buffer, codeChars[int(b)%len(codeChars)])
+				}
+			}
 		}
 		code := string(buffer)
 		var count int64
@@ -413,7 +1018,11 @@ func (h *FileHandler) generateUniqueAccessCode(length int) (string, error) {
 
 // App Info Handler
 func HandleGetAppInfo(c *gin.Context) {
+	cfg := AppConfig()
 	c.JSON(http.StatusOK, gin.H{
-		"publicHost": AppConfig.PublicHost,
+		"publicHost":       cfg.PublicHost,
+		"accessCodeLength": cfg.AccessCodeLength,
+		"publicGallery":    cfg.EnablePublicGallery,
+		"maintenance":      cfg.MaintenanceMode,
 	})
 }
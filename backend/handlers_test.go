@@ -0,0 +1,77 @@
+// backend/handlers_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHandleStreamUploadTooLarge(t *testing.T) {
+	const limit = 1024 * 1024
+	tests := []struct {
+		name string
+		body func() io.Reader
+	}{
+		// bytes.Reader 让 httptest 设置 Content-Length，在读取请求体之前就被拒绝
+		{"content length", func() io.Reader { return bytes.NewReader(make([]byte, limit+1)) }},
+		// 未知长度的请求体以分块编码发送，读取到超过限制的部分时由 MaxBytesReader 中止
+		{"chunked", func() io.Reader { return io.MultiReader(strings.NewReader("x"), bytes.NewReader(make([]byte, limit))) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTestConfig(t, func(c *Config) { c.MaxUploadSizeMB = 1; c.DefaultExpiryHours = 1 })
+			dir := t.TempDir()
+			storage, err := NewLocalStorage(StorageConfig{LocalPath: dir})
+			if err != nil {
+				t.Fatalf("NewLocalStorage: %v", err)
+			}
+			db := newTestDB(t, &File{})
+			quota, err := NewStorageQuota(db, storage, 0, false)
+			if err != nil {
+				t.Fatalf("NewStorageQuota: %v", err)
+			}
+			h := &FileHandler{DB: db, Scanner: NoopScanner{}, Storage: storage, Quota: quota}
+
+			w := httptest.NewRecorder()
+			c := newTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/upload", tt.body())
+			c.Request.Header.Set("X-File-Name", "big.bin")
+			c.Request.Header.Set("X-File-Original-Size", "1048577")
+			if tt.name == "chunked" && c.Request.ContentLength != -1 {
+				t.Fatalf("ContentLength = %d, want -1", c.Request.ContentLength)
+			}
+			h.HandleStreamUpload(c)
+
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("status = %d, want 413: %s", w.Code, w.Body.String())
+			}
+			var body struct {
+				Code         string `json:"code"`
+				Message      string `json:"message"`
+				MaxSizeBytes int64  `json:"maxSizeBytes"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("无法解析响应: %v", err)
+			}
+			if body.Code != ErrCodeFileTooLarge || body.MaxSizeBytes != limit || !strings.Contains(body.Message, "1MB") {
+				t.Fatalf("响应没有报告大小限制: %+v", body)
+			}
+
+			var count int64
+			db.Model(&File{}).Count(&count)
+			entries, _ := os.ReadDir(dir)
+			if count != 0 || len(entries) != 0 {
+				t.Fatalf("被拒绝的上传留下了记录或对象: files=%d, objects=%d", count, len(entries))
+			}
+			if quota.usedBytes != 0 || quota.ActiveFiles() != 0 {
+				t.Fatalf("配额没有释放: usedBytes=%d, activeFiles=%d", quota.usedBytes, quota.ActiveFiles())
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// backend/helpers_test.go
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// withTestConfig 以 edit 修改过的空配置替换全局配置，测试结束时恢复原配置
+func withTestConfig(t *testing.T, edit func(c *Config)) {
+	t.Helper()
+	previous := appConfig.Load()
+	cfg := &Config{MaxUploadSizeMB: 10}
+	if edit != nil {
+		edit(cfg)
+	}
+	appConfig.Store(cfg)
+	t.Cleanup(func() { appConfig.Store(previous) })
+}
+
+// newTestContext 返回写入 httptest.ResponseRecorder 的 gin.Context
+func newTestContext(w *httptest.ResponseRecorder) *gin.Context {
+	c, _ := gin.CreateTestContext(w)
+	return c
+}
+
+// newTestDB 返回临时目录中迁移好 models 的 SQLite 数据库
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("无法打开测试数据库: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("无法迁移测试数据库: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
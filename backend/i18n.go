@@ -0,0 +1,265 @@
+// backend/i18n.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// messageID 是 API 提示信息的标识，实际文本由 messageCatalogs 按语言提供
+type messageID string
+
+const (
+	msgInternalError         messageID = "internal_error"
+	msgInvalidFileName       messageID = "invalid_file_name"
+	msgInvalidEncryptedName  messageID = "invalid_encrypted_name"
+	msgInvalidManifest       messageID = "invalid_encryption_manifest"
+	msgInvalidOriginalSize   messageID = "invalid_original_size"
+	msgInvalidPasswordHash   messageID = "invalid_password_hash"
+	msgInvalidFileTags       messageID = "invalid_file_tags"
+	msgInvalidExpiryLabel    messageID = "invalid_expiry_label"
+	msgExpiryNotPreset       messageID = "expiry_not_preset"
+	msgFileTooLarge          messageID = "file_too_large"
+	msgSaveFailed            messageID = "save_failed"
+	msgSaveRecordFailed      messageID = "save_record_failed"
+	msgStorageFull           messageID = "storage_full"
+	msgFileLimitReached      messageID = "file_limit_reached"
+	msgAccessCodeFailed      messageID = "access_code_failed"
+	msgInvalidUploadInit     messageID = "invalid_upload_init"
+	msgUploadNotFound        messageID = "upload_not_found"
+	msgUploadInProgress      messageID = "upload_in_progress"
+	msgInvalidIdempotencyKey messageID = "invalid_idempotency_key"
+	msgBatchNeedsMultipart   messageID = "batch_needs_multipart"
+	msgBatchInvalidMultipart messageID = "batch_invalid_multipart"
+	msgBatchNoFiles          messageID = "batch_no_files"
+	msgBatchTooManyFiles     messageID = "batch_too_many_files"
+	msgFileNotFound          messageID = "file_not_found"
+	msgFileExpired           messageID = "file_expired"
+	msgFileQuarantined       messageID = "file_quarantined"
+	msgFileInfected          messageID = "file_infected"
+	msgFileMissing           messageID = "file_missing"
+	msgEncryptedNeedsPost    messageID = "encrypted_needs_post"
+	msgProtectedNeedsPost    messageID = "protected_needs_post"
+	msgInvalidVerification   messageID = "invalid_verification"
+	msgPasswordRequired      messageID = "password_required"
+	msgWrongPassword         messageID = "wrong_password"
+	msgRetrieveFailed        messageID = "retrieve_failed"
+	msgIntegrityFailed       messageID = "integrity_check_failed"
+	msgReadFailed            messageID = "read_failed"
+	msgPreviewUnavailable    messageID = "preview_unavailable"
+	msgSnippetTooLarge       messageID = "snippet_too_large"
+	msgDataURITooLarge       messageID = "data_uri_too_large"
+	msgPreviewTypeInline     messageID = "preview_type_inline"
+	msgNotTextFile           messageID = "not_text_file"
+	msgLandingNeedsClient    messageID = "landing_needs_client"
+	msgLandingExpiresAt      messageID = "landing_expires_at"
+	msgLandingDownload       messageID = "landing_download"
+	msgLandingDownloadOnce   messageID = "landing_download_once"
+	msgLinkPreviewPrivate    messageID = "link_preview_private"
+	msgPublicListFailed      messageID = "public_list_failed"
+	msgInvalidSearchQuery    messageID = "invalid_search_query"
+	msgInvalidReport         messageID = "invalid_report"
+	msgReportFailed          messageID = "report_failed"
+	msgReportReceived        messageID = "report_received"
+	msgRateLimited           messageID = "rate_limited"
+	msgServerBusy            messageID = "server_busy"
+	msgMaintenance           messageID = "maintenance"
+	msgIPForbidden           messageID = "ip_forbidden"
+	msgCountryForbidden      messageID = "country_forbidden"
+	msgInvalidCountries      messageID = "invalid_allowed_countries"
+	msgInvalidNotifyTarget   messageID = "invalid_notify_target"
+	msgInvalidManageToken    messageID = "invalid_manage_token"
+	msgInvalidSignature      messageID = "invalid_signature"
+	msgInvalidSignRequest    messageID = "invalid_sign_request"
+	msgInvalidDownloadToken  messageID = "invalid_download_token"
+	msgInvalidDescription    messageID = "invalid_description"
+	msgInvalidMetaBatch      messageID = "invalid_meta_batch"
+	msgInvalidE2EEParams     messageID = "invalid_e2ee_params"
+	msgRequestTimeout        messageID = "request_timeout"
+)
+
+// defaultLanguage 在请求没有 Accept-Language 或其中没有受支持的语言时使用，保持与旧版本一致
+const defaultLanguage = "zh"
+
+// messageCatalogs 按语言保存提示信息。新增语言只需添加一个 map，缺失的条目回退到默认语言
+var messageCatalogs = map[string]map[messageID]string{
+	"zh": {
+		msgInternalError:         "服务器内部错误",
+		msgInvalidFileName:       "无效或缺失的文件名 (X-File-Name)",
+		msgInvalidEncryptedName:  "无效的加密文件名 (X-File-Encrypted-Name)，最多 %d 个可打印 ASCII 字符",
+		msgInvalidManifest:       "无效的加密清单 (X-File-Encryption-Manifest)，需要不超过 %d 字节的 JSON",
+		msgInvalidOriginalSize:   "无效或缺失的原始文件大小 (X-File-Original-Size)",
+		msgInvalidPasswordHash:   "无效的密码哈希 (X-File-Password-Hash)，需要 bcrypt 或 argon2id 格式",
+		msgInvalidExpiryLabel:    "无效的有效期描述 (X-File-Expiry-Label)，最多 %d 个字符且不能包含控制字符",
+		msgExpiryNotPreset:       "有效期 (X-File-Expires-In) 必须是以下预设之一: %s",
+		msgInvalidFileTags:       "无效的文件标签 (X-File-Tags)，需要最多 %d 个键值均为字符串的 JSON 对象，键最长 %d 个字符 (字母、数字和 _ . -)，值最长 %d 字节",
+		msgFileTooLarge:          "文件超过 %dMB 大小限制",
+		msgSaveFailed:            "无法保存文件",
+		msgSaveRecordFailed:      "无法保存文件记录",
+		msgStorageFull:           "服务器存储空间已满，请稍后再试",
+		msgFileLimitReached:      "服务器上的分享数量已达到上限 (%d 个)，请等待旧文件过期后再试",
+		msgAccessCodeFailed:      "无法生成分享码",
+		msgInvalidUploadInit:     "无效的上传初始化请求",
+		msgUploadNotFound:        "上传会话不存在、已过期或已被使用",
+		msgUploadInProgress:      "使用相同 Idempotency-Key 的上传仍在进行中，请稍后重试",
+		msgInvalidIdempotencyKey: "无效的 Idempotency-Key，最长 %d 个字符",
+		msgBatchNeedsMultipart:   "批量上传需要 multipart/form-data 请求体",
+		msgBatchInvalidMultipart: "无效的 multipart 请求体",
+		msgBatchNoFiles:          "请求中没有任何文件",
+		msgBatchTooManyFiles:     "超过单批最多 %d 个文件的限制",
+		msgFileNotFound:          "文件不存在或已过期",
+		msgFileExpired:           "文件已过期",
+		msgFileInfected:          "该文件被检测到含有病毒，已被隔离",
+		msgFileQuarantined:       "该文件因被多次举报已暂时下架，等待审核",
+		msgFileMissing:           "物理文件丢失",
+		msgEncryptedNeedsPost:    "下载加密文件需要使用 POST 方法",
+		msgProtectedNeedsPost:    "下载受密码保护的文件需要使用 POST 方法",
+		msgInvalidVerification:   "无效的验证请求",
+		msgPasswordRequired:      "该文件受密码保护",
+		msgWrongPassword:         "密码错误",
+		msgRetrieveFailed:        "无法获取文件",
+		msgIntegrityFailed:       "文件完整性校验失败，存储中的文件可能已损坏",
+		msgReadFailed:            "无法读取文件内容",
+		msgPreviewUnavailable:    "文件无法预览",
+		msgSnippetTooLarge:       "文件过大，无法以文本方式查看，请直接下载",
+		msgDataURITooLarge:       "文件过大，无法生成 Data URI 预览，请直接下载",
+		msgPreviewTypeInline:     "该类型的文件无法在线预览，请直接下载",
+		msgNotTextFile:           "该文件不是文本文件",
+		msgLandingNeedsClient:    "该文件已加密或受保护，请在 TempShare 网页端打开此链接",
+		msgLandingExpiresAt:      "过期时间",
+		msgLandingDownload:       "下载文件",
+		msgLandingDownloadOnce:   "该文件只能下载一次，下载后将被删除",
+		msgLinkPreviewPrivate:    "有人通过 TempShare 与你分享了一个文件，打开链接查看",
+		msgPublicListFailed:      "查询公开文件列表失败",
+		msgInvalidSearchQuery:    "搜索关键词不能为空，且不能超过 %d 个字符",
+		msgInvalidReport:         "无效的举报请求",
+		msgReportFailed:          "无法提交举报，请稍后再试",
+		msgReportReceived:        "您的举报已收到，感谢您的帮助！我们将会尽快处理。",
+		msgRateLimited:           "请求过于频繁，请稍后再试。",
+		msgServerBusy:            "服务器繁忙，请稍后再试。",
+		msgMaintenance:           "服务正在维护，暂时无法上传，已有文件仍可下载。请稍后再试。",
+		msgIPForbidden:           "您的 IP 地址无权访问此功能",
+		msgCountryForbidden:      "该文件不允许在您所在的国家或地区下载",
+		msgInvalidCountries:      "无效的国家代码列表 (X-File-Allowed-Countries)，需要以逗号分隔的两位国家代码，最多 %d 个；服务器未配置国家来源时不可设置",
+		msgInvalidNotifyTarget:   "无效的下载通知目标 (X-File-Notify)，需要 http(s) Webhook 地址或邮箱 (需服务器配置 SMTP)，最长 %d 个字符；服务器未启用下载通知时不可设置",
+		msgInvalidManageToken:    "管理令牌 (X-Manage-Token) 缺失或无效",
+		msgInvalidSignature:      "下载链接的签名无效或已过期",
+		msgInvalidSignRequest:    "无效的签名请求，expiresInSeconds 必须是正整数",
+		msgInvalidDownloadToken:  "下载确认令牌无效或已过期，请重新打开下载链接获取",
+		msgInvalidDescription:    "无效的文件说明 (X-File-Description)，最多 %d 个字符且除换行外不能包含控制字符",
+		msgInvalidMetaBatch:      "无效的批量查询请求，accessCodes 需要包含 1 到 %d 个分享码",
+		msgRequestTimeout:        "请求处理超时，请稍后再试",
+		msgInvalidE2EEParams:     "无效的端到端加密参数: X-File-Verification-Hash 需要 %d 位十六进制字符，X-File-Salt 需要解码后至少 %d 字节的 base64",
+	},
+	"en": {
+		msgInternalError:         "Internal server error",
+		msgInvalidFileName:       "Invalid or missing file name (X-File-Name)",
+		msgInvalidEncryptedName:  "Invalid encrypted file name (X-File-Encrypted-Name); at most %d printable ASCII characters",
+		msgInvalidManifest:       "Invalid encryption manifest (X-File-Encryption-Manifest); JSON of at most %d bytes is required",
+		msgInvalidOriginalSize:   "Invalid or missing original file size (X-File-Original-Size)",
+		msgInvalidPasswordHash:   "Invalid password hash (X-File-Password-Hash); bcrypt or argon2id is required",
+		msgInvalidExpiryLabel:    "Invalid expiry label (X-File-Expiry-Label); at most %d characters and no control characters",
+		msgExpiryNotPreset:       "Expiry (X-File-Expires-In) must be one of the presets: %s",
+		msgInvalidFileTags:       "Invalid file tags (X-File-Tags); a JSON object of at most %d string values is required, keys up to %d characters (letters, digits, _ . -) and values up to %d bytes",
+		msgFileTooLarge:          "File exceeds the %dMB size limit",
+		msgSaveFailed:            "Could not save the file",
+		msgSaveRecordFailed:      "Could not save the file record",
+		msgStorageFull:           "Server storage is full, please try again later",
+		msgFileLimitReached:      "The server has reached its limit of %d active shares; please try again after older files expire",
+		msgAccessCodeFailed:      "Could not generate an access code",
+		msgInvalidUploadInit:     "Invalid upload init request",
+		msgUploadNotFound:        "Upload session not found, expired or already used",
+		msgUploadInProgress:      "An upload with the same Idempotency-Key is still in progress, please retry later",
+		msgInvalidIdempotencyKey: "Invalid Idempotency-Key, at most %d characters",
+		msgBatchNeedsMultipart:   "Batch upload requires a multipart/form-data body",
+		msgBatchInvalidMultipart: "Invalid multipart body",
+		msgBatchNoFiles:          "The request contains no files",
+		msgBatchTooManyFiles:     "A batch may contain at most %d files",
+		msgFileNotFound:          "File not found or expired",
+		msgFileExpired:           "File has expired",
+		msgFileInfected:          "This file was detected as infected and has been quarantined",
+		msgFileQuarantined:       "This file has been taken down pending review after multiple reports",
+		msgFileMissing:           "The stored file is missing",
+		msgEncryptedNeedsPost:    "Encrypted files must be downloaded with POST",
+		msgProtectedNeedsPost:    "Password-protected files must be downloaded with POST",
+		msgInvalidVerification:   "Invalid verification request",
+		msgPasswordRequired:      "This file is password protected",
+		msgWrongPassword:         "Wrong password",
+		msgRetrieveFailed:        "Could not retrieve the file",
+		msgIntegrityFailed:       "Integrity check failed; the stored file may be corrupted",
+		msgReadFailed:            "Could not read the file content",
+		msgPreviewUnavailable:    "This file cannot be previewed",
+		msgSnippetTooLarge:       "File is too large to view as text, please download it",
+		msgDataURITooLarge:       "File is too large for a data URI preview, please download it",
+		msgPreviewTypeInline:     "This file type cannot be previewed inline, please download it",
+		msgNotTextFile:           "This file is not a text file",
+		msgLandingNeedsClient:    "This file is encrypted or protected, please open this link in the TempShare web app",
+		msgLandingExpiresAt:      "Expires",
+		msgLandingDownload:       "Download",
+		msgLandingDownloadOnce:   "This file can only be downloaded once and will be deleted afterwards",
+		msgLinkPreviewPrivate:    "A file has been shared with you via TempShare; open the link to view it",
+		msgPublicListFailed:      "Could not load the public file list",
+		msgInvalidSearchQuery:    "The search query must be non-empty and at most %d characters",
+		msgInvalidReport:         "Invalid report request",
+		msgReportFailed:          "Could not submit the report, please try again later",
+		msgReportReceived:        "Your report has been received. Thank you, we will look into it as soon as possible.",
+		msgRateLimited:           "Too many requests, please try again later.",
+		msgServerBusy:            "Server is busy, please try again later.",
+		msgMaintenance:           "The service is under maintenance. Uploads are temporarily disabled; existing files can still be downloaded.",
+		msgIPForbidden:           "Your IP address is not allowed to use this feature",
+		msgCountryForbidden:      "This file is not available in your country or region",
+		msgInvalidCountries:      "Invalid country list (X-File-Allowed-Countries); comma-separated two-letter country codes, at most %d; not available when the server has no country source configured",
+		msgInvalidNotifyTarget:   "Invalid download notification target (X-File-Notify); expected an http(s) webhook URL or an email address (requires SMTP on the server), at most %d characters; not available when download notifications are disabled",
+		msgInvalidManageToken:    "Missing or invalid management token (X-Manage-Token)",
+		msgInvalidSignature:      "The download link signature is invalid or has expired",
+		msgInvalidSignRequest:    "Invalid sign request; expiresInSeconds must be a positive integer",
+		msgInvalidDownloadToken:  "The download confirmation token is invalid or has expired; open the download link again to get a new one",
+		msgInvalidDescription:    "Invalid file description (X-File-Description); at most %d characters and no control characters other than line breaks",
+		msgInvalidMetaBatch:      "Invalid batch request; accessCodes must contain between 1 and %d access codes",
+		msgRequestTimeout:        "The request timed out, please try again later",
+		msgInvalidE2EEParams:     "Invalid end-to-end encryption parameters; X-File-Verification-Hash must be %d hex characters and X-File-Salt must be base64 decoding to at least %d bytes",
+	},
+}
+
+// requestLanguage 按 Accept-Language 的权重选择第一个受支持的语言，只比较主语言标签 (zh-CN -> zh)
+func requestLanguage(c *gin.Context) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := messageCatalogs[base]; ok && q > 0 {
+			candidates = append(candidates, candidate{base, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return defaultLanguage
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
+
+// translate 返回请求语言下的提示信息，args 用于填充其中的格式化占位符
+func translate(c *gin.Context, id messageID, args ...interface{}) string {
+	text, ok := messageCatalogs[requestLanguage(c)][id]
+	if !ok {
+		text = messageCatalogs[defaultLanguage][id]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
@@ -0,0 +1,171 @@
+// backend/idempotency.go
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// MaxIdempotencyKeyLength 是 Idempotency-Key 的最大长度
+	MaxIdempotencyKeyLength = 255
+	// idempotencyAbandonAfter 是进行中的幂等记录被视为已中断的时间 (与上传会话的保留时间一致)。
+	// 进程在上传过程中崩溃时记录不会被删除，超过该时间后同一个键可以被重新占用，而不是在整个 TTL 内返回 409
+	idempotencyAbandonAfter = uploadSessionTTL
+)
+
+// UploadIdempotencyKey 记录带 Idempotency-Key 的上传结果，同一客户端在 IdempotencyKeyTTLHours 内
+// 用相同的键重试时直接返回第一次上传的分享码，不会重复存储。AccessCode 为空表示该上传仍在进行中。
+// 重放时需要把管理令牌返回给没有收到第一次响应的客户端，令牌以服务器密钥加密后保存 (见 sealManageToken)，
+// 数据库泄露时无法直接得到可用的管理令牌
+type UploadIdempotencyKey struct {
+	ID                uint   `gorm:"primarykey"`
+	ClientIP          string `gorm:"size:64;uniqueIndex:idx_upload_idempotency"`
+	IdempotencyKey    string `gorm:"size:255;uniqueIndex:idx_upload_idempotency"`
+	AccessCode        string `gorm:"size:32"`
+	SealedManageToken string `gorm:"size:128"`
+	CreatedAt         time.Time
+	ExpiresAt         time.Time `gorm:"index"`
+}
+
+// manageTokenSealKey 从下载签名密钥派生加密幂等记录中管理令牌的 AES-256 密钥。
+// 未配置 DownloadSigningSecret 时签名密钥在重启后改变，此前保存的令牌无法解密，重放时不再返回管理令牌
+func manageTokenSealKey() []byte {
+	mac := hmac.New(sha256.New, downloadSigningKey)
+	mac.Write([]byte("idempotency manage token"))
+	return mac.Sum(nil)
+}
+
+// sealManageToken 用 AES-GCM 加密管理令牌，返回 base64 编码的 nonce+密文
+func sealManageToken(token string) (string, error) {
+	block, err := aes.NewCipher(manageTokenSealKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(token), nil)), nil
+}
+
+// openManageToken 解密 sealManageToken 的结果，密钥已改变或数据被篡改时返回错误
+func openManageToken(sealed string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(manageTokenSealKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("加密的管理令牌长度无效")
+	}
+	token, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	return string(token), err
+}
+
+// beginIdempotentUpload 按 (客户端 IP, Idempotency-Key) 占用一条记录。返回 done 为 true 时响应已写入：
+// 键无效时返回 400，相同的键已有上传在进行中时返回 409，已完成时重放第一次的响应。
+// 进行中超过 idempotencyAbandonAfter 的记录视为已中断，由本次请求重新占用。
+// 请求未携带该请求头或未启用时返回 nil，上传照常进行
+func (h *FileHandler) beginIdempotentUpload(c *gin.Context) (record *UploadIdempotencyKey, done bool) {
+	key := strings.TrimSpace(c.GetHeader(idempotencyKeyHeader))
+	if key == "" || AppConfig().IdempotencyKeyTTLHours <= 0 {
+		return nil, false
+	}
+	if len(key) > MaxIdempotencyKeyLength {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidIdempotencyKey, MaxIdempotencyKeyLength))
+		return nil, true
+	}
+
+	now := time.Now()
+	clientIP := c.ClientIP()
+	db := h.db(c.Request.Context())
+	// 过期的记录可能还没被清理任务删除，先删掉它，让这个键可以重新使用
+	db.Where("client_ip = ? AND idempotency_key = ? AND expires_at <= ?", clientIP, key, now).Delete(&UploadIdempotencyKey{})
+
+	var existing UploadIdempotencyKey
+	for attempt := 0; attempt < 2; attempt++ {
+		record = &UploadIdempotencyKey{
+			ClientIP:       clientIP,
+			IdempotencyKey: key,
+			ExpiresAt:      now.Add(time.Duration(AppConfig().IdempotencyKeyTTLHours) * time.Hour),
+		}
+		// 依靠唯一索引保证并发的重复请求中只有一个能占用该键
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			requestLogger(c).Error("上传错误: 无法写入幂等记录", "clientIP", clientIP, "error", result.Error)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgInternalError))
+			return nil, true
+		}
+		if result.RowsAffected > 0 {
+			return record, false
+		}
+
+		existing = UploadIdempotencyKey{}
+		err := db.Where("client_ip = ? AND idempotency_key = ?", clientIP, key).First(&existing).Error
+		if err != nil || existing.AccessCode != "" || now.Sub(existing.CreatedAt) < idempotencyAbandonAfter {
+			break
+		}
+		// 占用该键的上传已中断 (例如进程崩溃)，按 ID 和空 AccessCode 条件删除，并发的重试中只有一个会真正删除它
+		requestLogger(c).Warn("幂等上传: 释放已中断的上传记录", "clientIP", clientIP, "createdAt", existing.CreatedAt)
+		db.Where("id = ? AND access_code = ?", existing.ID, "").Delete(&UploadIdempotencyKey{})
+	}
+	if existing.AccessCode == "" {
+		// 查询失败说明占用该键的上传刚刚失败并释放了记录，同样让客户端稍后重试
+		respondError(c, http.StatusConflict, ErrCodeUploadInProgress, translate(c, msgUploadInProgress))
+		return nil, true
+	}
+	response := gin.H{"accessCode": existing.AccessCode, "urlPath": downloadURLPath(existing.AccessCode)}
+	if token, err := openManageToken(existing.SealedManageToken); err == nil {
+		response["manageToken"] = token
+	} else {
+		requestLogger(c).Warn("幂等上传: 无法解密管理令牌，重放响应中不包含管理令牌", "accessCode", existing.AccessCode, "error", err)
+	}
+	requestLogger(c).Info("幂等上传: 返回已完成的上传结果", "clientIP", clientIP, "accessCode", existing.AccessCode)
+	c.Header("Idempotent-Replayed", "true")
+	c.JSON(http.StatusCreated, response)
+	return nil, true
+}
+
+// finishIdempotentUpload 在上传成功时保存结果供之后重放；失败时删除记录，客户端可以用同一个键重试
+func (h *FileHandler) finishIdempotentUpload(record *UploadIdempotencyKey, file File, succeeded bool) {
+	if record == nil {
+		return
+	}
+	var err error
+	if succeeded {
+		var sealed string
+		if sealed, err = sealManageToken(file.ManageToken); err == nil {
+			err = h.DB.Model(record).Updates(map[string]interface{}{"access_code": file.AccessCode, "sealed_manage_token": sealed}).Error
+		}
+	} else {
+		err = h.DB.Delete(record).Error
+	}
+	if err != nil {
+		slog.Error("上传错误: 无法更新幂等记录", "id", record.ID, "error", err)
+	}
+}
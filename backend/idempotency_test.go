@@ -0,0 +1,124 @@
+// backend/idempotency_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newIdempotencyTestHandler 返回使用测试数据库的 FileHandler
+func newIdempotencyTestHandler(t *testing.T) *FileHandler {
+	t.Helper()
+	return &FileHandler{DB: newTestDB(t, &UploadIdempotencyKey{})}
+}
+
+// newIdempotentRequest 返回携带 Idempotency-Key 的上传请求上下文
+func newIdempotentRequest(key string) (*httptest.ResponseRecorder, *gin.Context) {
+	w := httptest.NewRecorder()
+	c := newTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/upload", nil)
+	c.Request.Header.Set(idempotencyKeyHeader, key)
+	return w, c
+}
+
+func TestManageTokenSealing(t *testing.T) {
+	previous := downloadSigningKey
+	t.Cleanup(func() { downloadSigningKey = previous })
+	initDownloadSigningKey("test-secret")
+
+	sealed, err := sealManageToken("manage-token")
+	if err != nil {
+		t.Fatalf("sealManageToken: %v", err)
+	}
+	if strings.Contains(sealed, "manage-token") {
+		t.Fatalf("加密结果中包含明文令牌: %q", sealed)
+	}
+	if token, err := openManageToken(sealed); err != nil || token != "manage-token" {
+		t.Fatalf("openManageToken = %q, %v", token, err)
+	}
+
+	initDownloadSigningKey("other-secret")
+	if _, err := openManageToken(sealed); err == nil {
+		t.Fatal("密钥改变后仍能解密管理令牌")
+	}
+	if _, err := openManageToken("bad"); err == nil {
+		t.Fatal("无效的密文没有返回错误")
+	}
+}
+
+func TestIdempotentUploadReplay(t *testing.T) {
+	withTestConfig(t, func(c *Config) { c.IdempotencyKeyTTLHours = 24 })
+	previous := downloadSigningKey
+	t.Cleanup(func() { downloadSigningKey = previous })
+	initDownloadSigningKey("test-secret")
+	h := newIdempotencyTestHandler(t)
+
+	_, c := newIdempotentRequest("key-1")
+	record, done := h.beginIdempotentUpload(c)
+	if done || record == nil {
+		t.Fatalf("第一次请求未能占用键: done=%v", done)
+	}
+
+	w, c := newIdempotentRequest("key-1")
+	if _, done := h.beginIdempotentUpload(c); !done || w.Code != http.StatusConflict {
+		t.Fatalf("进行中的上传应返回 409, got done=%v code=%d", done, w.Code)
+	}
+
+	h.finishIdempotentUpload(record, File{AccessCode: "ABC123", ManageToken: "secret-token"}, true)
+	var stored UploadIdempotencyKey
+	h.DB.First(&stored, record.ID)
+	if stored.SealedManageToken == "" || strings.Contains(stored.SealedManageToken, "secret-token") {
+		t.Fatalf("管理令牌没有加密保存: %q", stored.SealedManageToken)
+	}
+
+	w, c = newIdempotentRequest("key-1")
+	if _, done := h.beginIdempotentUpload(c); !done || w.Code != http.StatusCreated {
+		t.Fatalf("已完成的上传应重放 201, got done=%v code=%d", done, w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("无法解析重放响应: %v", err)
+	}
+	if body["accessCode"] != "ABC123" || body["manageToken"] != "secret-token" {
+		t.Fatalf("重放响应不正确: %v", body)
+	}
+}
+
+func TestIdempotentUploadReclaimsAbandonedRecord(t *testing.T) {
+	withTestConfig(t, func(c *Config) { c.IdempotencyKeyTTLHours = 24 })
+	h := newIdempotencyTestHandler(t)
+
+	tests := []struct {
+		name      string
+		age       time.Duration
+		wantClaim bool
+	}{
+		{"recent", time.Minute, false},
+		{"abandoned", idempotencyAbandonAfter + time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			h.DB.Create(&UploadIdempotencyKey{
+				ClientIP:       "192.0.2.1",
+				IdempotencyKey: tt.name,
+				CreatedAt:      now.Add(-tt.age),
+				ExpiresAt:      now.Add(time.Hour),
+			})
+			w, c := newIdempotentRequest(tt.name)
+			record, done := h.beginIdempotentUpload(c)
+			if claimed := !done && record != nil; claimed != tt.wantClaim {
+				t.Fatalf("claimed = %v, want %v (code %d)", claimed, tt.wantClaim, w.Code)
+			}
+			if !tt.wantClaim && w.Code != http.StatusConflict {
+				t.Fatalf("code = %d, want 409", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// backend/initconfig.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// runInit 实现 `tempshare init [--output config.json] [--force]`: 校验当前配置 (config.json、环境变量和默认值合并后的结果)，
+// 把它连同 Initialized=true 写入配置文件，下次启动无需再设置 TEMPSHARE_INITIALIZED。
+// 该命令在初始化检查之前执行，未初始化时也可以运行；配置无效时 main 中的 Config.Validate 会先报错退出，不会写入文件
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	output := fs.String("output", "config.json", "写入的配置文件路径")
+	force := fs.Bool("force", false, "覆盖已存在的配置文件")
+	fs.Parse(args)
+
+	cfg := *AppConfig()
+	cfg.Initialized = true
+	data, err := json.MarshalIndent(configToMap(reflect.ValueOf(cfg)), "", "    ")
+	if err != nil {
+		return err
+	}
+	// 配置中可能包含数据库密码、S3 密钥等敏感信息，只允许属主读写
+	if err := writeFileAtomic(*output, append(data, '\n'), 0o600, *force); err != nil {
+		return err
+	}
+	fmt.Printf("已写入配置文件 %s，现在可以直接启动服务。\n", *output)
+	if *output != "config.json" {
+		fmt.Println("注意: 服务启动时只读取当前目录下的 config.json。")
+	}
+	return nil
+}
+
+// configToMap 按 mapstructure 标签把配置结构体转换为 map，写出的 JSON 键与 viper 读取时使用的键一致
+func configToMap(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		m := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key := field.Tag.Get("mapstructure")
+			if !field.IsExported() || key == "" || key == "-" {
+				continue
+			}
+			m[key] = configToMap(v.Field(i))
+		}
+		return m
+	case reflect.Slice:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = configToMap(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if v.IsNil() {
+			return map[string]interface{}{}
+		}
+		return v.Interface()
+	default:
+		return v.Interface()
+	}
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再放到 path，中途失败不会留下写了一半的配置文件。
+// overwrite 为 false 时用硬链接放置，目标已存在则失败，不会覆盖在检查之后才出现的文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode, overwrite bool) error {
+	if !overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s 已存在，如需覆盖请使用 --force", path)
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("设置文件权限失败: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+
+	if overwrite {
+		err = os.Rename(tmp.Name(), path)
+	} else {
+		err = os.Link(tmp.Name(), path)
+	}
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s 已存在，如需覆盖请使用 --force", path)
+	}
+	if err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// backend/integrity.go
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// errIntegrityCheckFailed 表示存储对象与上传时记录的大小或哈希不一致，通常意味着存储损坏或写入不完整
+var errIntegrityCheckFailed = errors.New("存储对象完整性校验失败")
+
+// hashingStorage 在写入时计算实际写入底层存储的字节 (压缩存储时为压缩后的数据) 的 SHA-256，
+// 结果记录在 File.ContentHash 中，下载时由 verifyingStorage 校验
+type hashingStorage struct {
+	FileStorage
+	hash hash.Hash
+}
+
+func newHashingStorage(storage FileStorage) hashingStorage {
+	return hashingStorage{FileStorage: storage, hash: sha256.New()}
+}
+
+func (s hashingStorage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	return s.FileStorage.Save(ctx, key, io.TeeReader(reader, s.hash))
+}
+
+// sum 返回已写入数据的十六进制 SHA-256
+func (s hashingStorage) sum() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// verifyingStorage 读取时计算存储对象的 SHA-256，读到末尾时与 expected 比较。
+// 不一致时 Read 返回 errIntegrityCheckFailed 而不是 io.EOF；此时数据已经发送给客户端，只能中断传输并记录错误
+type verifyingStorage struct {
+	FileStorage
+	expected string
+	logger   *slog.Logger
+}
+
+func (s verifyingStorage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := s.FileStorage.Retrieve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReadCloser{ReadCloser: rc, hash: sha256.New(), storage: s, key: key}, nil
+}
+
+type verifyingReadCloser struct {
+	io.ReadCloser
+	hash    hash.Hash
+	storage verifyingStorage
+	key     string
+}
+
+func (v *verifyingReadCloser) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := hex.EncodeToString(v.hash.Sum(nil)); actual != v.storage.expected {
+			v.storage.logger.Error("存储对象完整性校验失败: 内容哈希与上传时不一致，存储可能已损坏", "key", v.key, "expected", v.storage.expected, "actual", actual)
+			return n, errIntegrityCheckFailed
+		}
+	}
+	return n, err
+}
+
+// retrieveVerifiedFile 与 retrieveFile 相同，开启 IntegrityCheck.VerifyHash 且记录有内容哈希时校验读取的数据
+func retrieveVerifiedFile(ctx context.Context, storage FileStorage, file File) (io.ReadCloser, error) {
+	if AppConfig().IntegrityCheck.VerifyHash && file.ContentHash != "" {
+		storage = verifyingStorage{FileStorage: storage, expected: file.ContentHash, logger: loggerFromContext(ctx)}
+	}
+	return retrieveFile(ctx, storage, file)
+}
+
+// checkStoredSize 在开启 IntegrityCheck.VerifySize 时比较存储对象的实际大小与记录的 SizeBytes。
+// 对象不存在时返回 gorm.ErrRecordNotFound，大小不一致时返回 errIntegrityCheckFailed；
+// 查询失败 (例如主端点暂时不可用) 时只记录警告，交给 Retrieve 的重试和故障转移处理
+func checkStoredSize(ctx context.Context, storage FileStorage, file File) error {
+	if !AppConfig().IntegrityCheck.VerifySize {
+		return nil
+	}
+	size, err := storage.Size(ctx, file.StorageKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		loggerFromContext(ctx).Warn("无法查询存储对象大小，跳过完整性检查", "key", file.StorageKey, "error", err)
+		return nil
+	}
+	if size != file.SizeBytes {
+		loggerFromContext(ctx).Error("存储对象完整性校验失败: 对象大小与上传时不一致，存储可能已损坏或写入不完整", "key", file.StorageKey, "expected", file.SizeBytes, "actual", size)
+		return errIntegrityCheckFailed
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// backend/ipfs.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// --- IPFS Storage Implementation ---
+
+// IPFSStorage 通过 Kubo (go-ipfs) 的 HTTP RPC API 把文件写入节点的 MFS (Mutable File System)。
+// MFS 中的文件不会被垃圾回收，效果等同于 pin，同时可以按路径寻址，因此 StorageKey 仍是本服务生成的键，
+// 唯一约束、隔离区 (quarantine/) 和存储迁移都保持原样；内容对应的 CID 可用 `ipfs files stat <MFSRoot>/<key>` 查看。
+// 相同内容在节点上只存储一份，删除其中一个键不会影响其他引用相同内容的键
+type IPFSStorage struct {
+	apiURL string
+	root   string
+	prefix string
+	http   *http.Client
+}
+
+// ipfsError 是 Kubo RPC 出错时返回的 JSON
+type ipfsError struct {
+	Message string
+}
+
+// ipfsLsEntry 是 files/ls 返回的目录项，Type 为 1 表示目录
+type ipfsLsEntry struct {
+	Name string
+	Type int
+}
+
+func NewIPFSStorage(config StorageConfig) (*IPFSStorage, error) {
+	root := "/" + strings.Trim(config.IPFS.MFSRoot, "/")
+	s := &IPFSStorage{
+		apiURL: strings.TrimRight(config.IPFS.APIURL, "/"),
+		root:   root,
+		prefix: config.KeyPrefix,
+		http:   &http.Client{},
+	}
+	// 检查节点是否可用，同时确认 MFS 根目录存在
+	resp, err := s.call(context.Background(), "files/mkdir", url.Values{"arg": {root}, "parents": {"true"}}, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("IPFS 节点连接失败 at %s: %w", config.IPFS.APIURL, err)
+	}
+	resp.Body.Close()
+	slog.Info("使用 IPFS 存储", "apiURL", s.apiURL, "mfsRoot", root, "keyPrefix", config.KeyPrefix)
+	return s, nil
+}
+
+func (s *IPFSStorage) mfsPath(key string) string {
+	return path.Join(s.root, s.prefix+key)
+}
+
+// call 以 POST 调用 Kubo RPC (所有 RPC 都只接受 POST)。非 200 响应转换为错误，错误信息取自响应体的 Message
+func (s *IPFSStorage) call(ctx context.Context, command string, args url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+"/api/v0/"+command+"?"+args.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var rpcErr ipfsError
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&rpcErr)
+		if rpcErr.Message == "" {
+			rpcErr.Message = fmt.Sprintf("服务器返回 %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%s: %s", command, rpcErr.Message)
+	}
+	return resp, nil
+}
+
+// isIPFSNotExist 判断 MFS 操作是否因为路径不存在而失败，Kubo 没有专门的错误码，只能匹配错误信息
+func isIPFSNotExist(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "does not exist")
+}
+
+// Save 以 multipart 流式写入 MFS (files/write)，不在内存中缓冲整个文件
+func (s *IPFSStorage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	body := &countingReader{r: reader}
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", path.Base(key))
+		if err == nil {
+			_, err = io.Copy(part, body)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	args := url.Values{
+		"arg":         {s.mfsPath(key)},
+		"create":      {"true"},
+		"parents":     {"true"},
+		"truncate":    {"true"},
+		"cid-version": {"1"},
+		"raw-leaves":  {"true"},
+	}
+	resp, err := s.call(ctx, "files/write", args, pr, mw.FormDataContentType())
+	pr.Close() // 请求提前失败时让写入协程退出
+	if err != nil {
+		return 0, fmt.Errorf("IPFS 存储写入失败: %w", err)
+	}
+	resp.Body.Close()
+	return body.n, nil
+}
+
+func (s *IPFSStorage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.call(ctx, "files/read", url.Values{"arg": {s.mfsPath(key)}}, nil, "")
+	if err != nil {
+		if isIPFSNotExist(err) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("IPFS 存储读取流失败: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// Delete 从 MFS 中移除文件，内容不再被引用后由节点的垃圾回收释放
+func (s *IPFSStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.call(ctx, "files/rm", url.Values{"arg": {s.mfsPath(key)}, "force": {"true"}}, nil, "")
+	if err != nil {
+		if isIPFSNotExist(err) {
+			return nil // 文件本就不存在，任务完成
+		}
+		return fmt.Errorf("IPFS 存储删除文件失败: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *IPFSStorage) Exists(key string) bool {
+	resp, err := s.call(context.Background(), "files/stat", url.Values{"arg": {s.mfsPath(key)}}, nil, "")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+func (s *IPFSStorage) Size(ctx context.Context, key string) (int64, error) {
+	resp, err := s.call(ctx, "files/stat", url.Values{"arg": {s.mfsPath(key)}}, nil, "")
+	if err != nil {
+		if isIPFSNotExist(err) {
+			return 0, gorm.ErrRecordNotFound
+		}
+		return 0, fmt.Errorf("IPFS 存储读取文件信息失败: %w", err)
+	}
+	defer resp.Body.Close()
+	var stat struct {
+		Size int64
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stat); err != nil {
+		return 0, fmt.Errorf("IPFS 存储读取文件信息失败: %w", err)
+	}
+	return stat.Size, nil
+}
+
+// Walk 从 prefix 所在的目录开始逐层调用 files/ls，与 WebDAV 一样每个目录的列表会一次性返回
+func (s *IPFSStorage) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	start := keyDir(prefix)
+	return s.walkDir(ctx, start, start, prefix, fn)
+}
+
+func (s *IPFSStorage) walkDir(ctx context.Context, start, dir, prefix string, fn func(key string) error) error {
+	resp, err := s.call(ctx, "files/ls", url.Values{"arg": {s.mfsPath(dir)}, "long": {"true"}}, nil, "")
+	if err != nil {
+		if dir == start && isIPFSNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("IPFS 存储列出目录失败: %w", err)
+	}
+	var listing struct {
+		Entries []ipfsLsEntry
+	}
+	err = json.NewDecoder(resp.Body).Decode(&listing)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("IPFS 存储列出目录失败: %w", err)
+	}
+	for _, entry := range listing.Entries {
+		key := dir + entry.Name
+		switch {
+		case entry.Type == 1:
+			err = s.walkDir(ctx, start, key+"/", prefix, fn)
+		case strings.HasPrefix(key, prefix):
+			err = fn(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
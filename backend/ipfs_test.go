@@ -0,0 +1,123 @@
+// backend/ipfs_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeKubo 是只实现 files/* RPC 的内存 MFS，files 以完整的 MFS 路径为键
+type fakeKubo struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newFakeKubo(t *testing.T) (*fakeKubo, *httptest.Server) {
+	k := &fakeKubo{files: make(map[string][]byte)}
+	notExist := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ipfsError{Message: "file does not exist"})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/files/mkdir", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/api/v0/files/write", func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("files/write: %v", err)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		k.mu.Lock()
+		k.files[r.URL.Query().Get("arg")] = data
+		k.mu.Unlock()
+	})
+	mux.HandleFunc("/api/v0/files/ls", func(w http.ResponseWriter, r *http.Request) {
+		dir := strings.TrimSuffix(r.URL.Query().Get("arg"), "/") + "/"
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		seen := make(map[string]bool)
+		var listing struct{ Entries []ipfsLsEntry }
+		for p := range k.files {
+			if !strings.HasPrefix(p, dir) {
+				continue
+			}
+			name, rest, isDir := strings.Cut(strings.TrimPrefix(p, dir), "/")
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			entry := ipfsLsEntry{Name: name}
+			if isDir && rest != "" {
+				entry.Type = 1
+			}
+			listing.Entries = append(listing.Entries, entry)
+		}
+		if len(listing.Entries) == 0 {
+			notExist(w)
+			return
+		}
+		json.NewEncoder(w).Encode(listing)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return k, server
+}
+
+func TestIPFSWalkWithKeyPrefix(t *testing.T) {
+	kubo, server := newFakeKubo(t)
+	// 配置中的前缀没有结尾的 /，由 NewFileStorage 规范化
+	storage, err := NewFileStorage(StorageConfig{Type: "ipfs", KeyPrefix: "tenant/a", IPFS: IPFSConfig{APIURL: server.URL, MFSRoot: "tempshare"}})
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	keys := []string{"abc123", "abd456", "quarantine/def789", backupKeyPrefix + "tempshare-1.jsonl.gz"}
+	for _, key := range keys {
+		if _, err := storage.Save(context.Background(), key, strings.NewReader(key)); err != nil {
+			t.Fatalf("Save(%s): %v", key, err)
+		}
+	}
+	// 前缀之外的对象不属于本服务
+	kubo.files["/tempshare/tenant/other"] = []byte("other")
+	kubo.files["/tempshare/tenant/ab999"] = []byte("other")
+
+	for _, key := range keys {
+		if _, ok := kubo.files[path.Join("/tempshare/tenant/a", key)]; !ok {
+			t.Fatalf("%s 没有写入 KeyPrefix 下: %v", key, kubo.files)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", keys},
+		{"ab", []string{"abc123", "abd456"}},
+		{"quarantine/", []string{"quarantine/def789"}},
+		{backupKeyPrefix, []string{backupKeyPrefix + "tempshare-1.jsonl.gz"}},
+		{"missing/", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		if err := storage.Walk(context.Background(), tt.prefix, func(key string) error {
+			got = append(got, key)
+			return nil
+		}); err != nil {
+			t.Fatalf("Walk(%q): %v", tt.prefix, err)
+		}
+		sort.Strings(got)
+		want := append([]string(nil), tt.want...)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Walk(%q) = %v, want %v", tt.prefix, got, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// backend/landing.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadURLCodePlaceholder 是 DownloadURLTemplate 中分享码的占位符
+const downloadURLCodePlaceholder = "{code}"
+
+var errInvalidDownloadURLTemplate = errors.New("DownloadURLTemplate 必须包含 {code} 占位符")
+
+// downloadURLPath 按 DownloadURLTemplate 生成上传响应中的 urlPath
+func downloadURLPath(code string) string {
+	return strings.ReplaceAll(AppConfig().DownloadURLTemplate, downloadURLCodePlaceholder, url.PathEscape(code))
+}
+
+// downloadLandingRoute 将 DownloadURLTemplate 转换为 gin 路由 (例如 /download/{code} -> /download/:code)。
+// 只有以 / 开头的相对路径才能由本服务提供落地页，且 {code} 必须独占一个路径段
+func downloadLandingRoute(tmpl string) (string, error) {
+	if !strings.HasPrefix(tmpl, "/") || strings.HasPrefix(tmpl, "//") {
+		return "", fmt.Errorf("启用 DownloadLandingPage 时 DownloadURLTemplate 必须是以 / 开头的路径: %q", tmpl)
+	}
+	segments := strings.Split(tmpl, "/")
+	var placeholders int
+	for i, segment := range segments {
+		if segment == downloadURLCodePlaceholder {
+			segments[i] = ":code"
+			placeholders++
+		} else if strings.Contains(segment, downloadURLCodePlaceholder) {
+			return "", fmt.Errorf("DownloadURLTemplate 中的 {code} 必须独占一个路径段: %q", tmpl)
+		}
+	}
+	if placeholders != 1 {
+		return "", fmt.Errorf("DownloadURLTemplate 中只能有一个 {code}: %q", tmpl)
+	}
+	route := strings.Join(segments, "/")
+	for _, reserved := range []string{"/api/", "/data/", "/health", "/metrics"} {
+		if strings.HasPrefix(route, reserved) {
+			return "", fmt.Errorf("DownloadURLTemplate 与内置路由 %s 冲突: %q", reserved, tmpl)
+		}
+	}
+	return route, nil
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}} - TempShare</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:32rem;margin:4rem auto;padding:0 1rem;color:#222}
+.card{border:1px solid #ddd;border-radius:8px;padding:1.5rem}
+.name{font-size:1.2rem;font-weight:600;word-break:break-all}
+.meta{color:#666;margin:.5rem 0 1.5rem}
+.description{white-space:pre-wrap;word-break:break-word;margin:0 0 1.5rem}
+.button{display:inline-block;background:#2563eb;color:#fff;padding:.6rem 1.2rem;border:0;border-radius:6px;font:inherit;text-decoration:none;cursor:pointer}
+</style>
+</head>
+<body>
+<div class="card">
+{{if .Filename}}<div class="name">{{.Filename}}</div>
+<div class="meta">{{.Size}} · {{.ExpiresLabel}} {{.ExpiresAt}}</div>{{end}}
+{{if .Description}}<p class="description">{{.Description}}</p>{{end}}
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .DownloadToken}}<form method="post" action="{{.DownloadURL}}"><input type="hidden" name="downloadToken" value="{{.DownloadToken}}"><button class="button" type="submit">{{.DownloadLabel}}</button></form>
+{{else if .DownloadURL}}<a class="button" href="{{.DownloadURL}}">{{.DownloadLabel}}</a>{{end}}
+</div>
+</body>
+</html>
+`))
+
+type landingPage struct {
+	Lang          string
+	Title         string
+	Filename      string
+	Size          string
+	ExpiresLabel  string
+	ExpiresAt     string
+	Description   string
+	Message       string
+	DownloadURL   string
+	DownloadLabel string
+	// DownloadToken 非空时以表单 POST 提交确认令牌下载，见 confirmDownloadOnce
+	DownloadToken string
+}
+
+// formatBytes 以 1024 为进制把字节数格式化为便于阅读的字符串
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// HandleDownloadLanding 在 DownloadURLTemplate 对应的路径上提供一个最小的 HTML 落地页，
+// 使上传响应中的 urlPath 在没有部署前端时也能打开。
+// 加密、受密码保护或阅后即焚的文件需要前端完成解密或校验，落地页不展示文件信息也不提供直链，
+// 阅后即焚文件也不会因访问落地页而被标记为已读。链接预览爬虫得到的是 HandleLinkPreview 生成的元信息页面
+func (h *FileHandler) HandleDownloadLanding(c *gin.Context) {
+	if isLinkPreviewBot(c.GetHeader("User-Agent")) {
+		h.HandleLinkPreview(c)
+		return
+	}
+	page := landingPage{Lang: requestLanguage(c)}
+	c.Header("Cache-Control", "no-store")
+
+	var file File
+	if err := h.db(c.Request.Context()).Where("access_code = ?", c.Param("code")).First(&file).Error; err != nil || !time.Now().Before(file.ExpiresAt) {
+		page.Title, page.Message = translate(c, msgFileNotFound), translate(c, msgFileNotFound)
+		renderLanding(c, http.StatusNotFound, page)
+		return
+	}
+	if file.ScanStatus == ScanStatusInfected {
+		page.Title, page.Message = translate(c, msgFileInfected), translate(c, msgFileInfected)
+		renderLanding(c, http.StatusForbidden, page)
+		return
+	}
+	if file.Quarantined {
+		page.Title, page.Message = translate(c, msgFileQuarantined), translate(c, msgFileQuarantined)
+		renderLanding(c, http.StatusUnavailableForLegalReasons, page)
+		return
+	}
+	if file.IsEncrypted || file.PasswordProtected || file.BurnOnView {
+		page.Title, page.Message = translate(c, msgLandingNeedsClient), translate(c, msgLandingNeedsClient)
+		renderLanding(c, http.StatusOK, page)
+		return
+	}
+
+	page.Title = file.Filename
+	page.Filename = file.Filename
+	page.Size = formatBytes(file.contentLength())
+	page.ExpiresLabel = translate(c, msgLandingExpiresAt)
+	page.ExpiresAt = file.ExpiresAt.Format("2006-01-02 15:04 MST")
+	page.Description = file.Description
+	page.DownloadURL = "/data/" + url.PathEscape(file.AccessCode)
+	page.DownloadLabel = translate(c, msgLandingDownload)
+	if file.DownloadOnce {
+		page.Message = translate(c, msgLandingDownloadOnce)
+		page.DownloadToken, _ = issueDownloadConfirmToken(file)
+		c.Header("Cache-Control", "no-store")
+	}
+	renderLanding(c, http.StatusOK, page)
+}
+
+func renderLanding(c *gin.Context, status int, page landingPage) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(status)
+	if err := landingTemplate.Execute(c.Writer, page); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,126 @@
+// backend/linkpreview.go
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// linkPreviewBots 是聊天软件和社交网站抓取链接预览时使用的 User-Agent 片段 (小写)
+var linkPreviewBots = []string{
+	"slackbot", "slack-imgproxy", "discordbot", "telegrambot", "twitterbot", "facebookexternalhit",
+	"whatsapp", "linkedinbot", "skypeuripreview", "mattermost", "rocket.chat", "iframely", "embedly",
+}
+
+// isLinkPreviewBot 根据 User-Agent 判断请求是否来自链接预览爬虫
+func isLinkPreviewBot(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, bot := range linkPreviewBots {
+		if strings.Contains(userAgent, bot) {
+			return true
+		}
+	}
+	return false
+}
+
+var linkPreviewTemplate = template.Must(template.New("link-preview").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<meta property="og:site_name" content="TempShare">
+<meta property="og:type" content="website">
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:description" content="{{.Description}}">
+<meta name="description" content="{{.Description}}">
+{{if .URL}}<meta property="og:url" content="{{.URL}}">
+{{end}}{{if .Image}}<meta property="og:image" content="{{.Image}}">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.Image}}">
+{{else}}<meta name="twitter:card" content="summary">
+{{end}}<meta name="twitter:title" content="{{.Title}}">
+<meta name="twitter:description" content="{{.Description}}">
+</head>
+<body>
+{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{end}}
+</body>
+</html>
+`))
+
+type linkPreview struct {
+	Lang        string
+	Title       string
+	Description string
+	URL         string
+	Image       string
+}
+
+// requestBaseURL 返回当前请求的 scheme://host，用于生成链接预览中需要的绝对地址
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// shareURL 返回分享码的完整分享链接。DownloadURLTemplate 是相对路径时优先拼接 PublicHost
+func shareURL(c *gin.Context, code string) string {
+	path := downloadURLPath(code)
+	if u, err := url.Parse(path); err == nil && u.IsAbs() {
+		return path
+	}
+	if host := strings.TrimRight(AppConfig().PublicHost, "/"); host != "" {
+		return host + path
+	}
+	return requestBaseURL(c) + path
+}
+
+// HandleLinkPreview 返回只包含 Open Graph / Twitter Card 元信息的 HTML，供 Slack、Discord、Telegram 等展开分享链接。
+// 前端托管分享链接时，可在反向代理中把 isLinkPreviewBot 识别的 User-Agent 转发到 /api/v1/link-preview/:code；
+// 启用 DownloadLandingPage 时落地页会直接为这些爬虫返回该页面。
+// 只有可以出现在公开列表中的文件 (见 publicFiles) 才展示文件名、大小和缩略图，其余文件只显示通用标题，不泄露任何文件信息
+func (h *FileHandler) HandleLinkPreview(c *gin.Context) {
+	code := c.Param("code")
+	page := linkPreview{Lang: requestLanguage(c), Title: "TempShare"}
+	c.Header("Cache-Control", "no-store")
+
+	var file File
+	if err := h.db(c.Request.Context()).Where("access_code = ?", code).First(&file).Error; err != nil || !time.Now().Before(file.ExpiresAt) {
+		page.Description = translate(c, msgFileNotFound)
+		renderLinkPreview(c, http.StatusNotFound, page)
+		return
+	}
+	page.URL = shareURL(c, file.AccessCode)
+
+	// 限制下载国家的文件同样不公开元信息，爬虫所在地区无法判断
+	var public int64
+	if err := publicFiles(h.db(c.Request.Context())).Where("id = ? AND allowed_countries = ?", file.ID, "").Count(&public).Error; err != nil || public == 0 {
+		page.Description = translate(c, msgLinkPreviewPrivate)
+		renderLinkPreview(c, http.StatusOK, page)
+		return
+	}
+
+	page.Title = file.Filename
+	page.Description = formatBytes(file.contentLength()) + " · " + translate(c, msgLandingExpiresAt) + " " + file.ExpiresAt.Format("2006-01-02 15:04 MST")
+	// 缩略图直接使用预览接口；SVG 在预览时受沙箱限制，多数爬虫也不支持，不作为缩略图
+	if strings.HasPrefix(file.ContentType, "image/") && !strings.Contains(file.ContentType, "svg") {
+		page.Image = requestBaseURL(c) + "/api/v1/preview/" + url.PathEscape(file.AccessCode)
+	}
+	renderLinkPreview(c, http.StatusOK, page)
+}
+
+func renderLinkPreview(c *gin.Context, status int, page linkPreview) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(status)
+	if err := linkPreviewTemplate.Execute(c.Writer, page); err != nil {
+		c.Error(err)
+	}
+}
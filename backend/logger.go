@@ -2,15 +2,129 @@
 package main
 
 import (
+	"context"
+	"log"
 	"log/slog"
 	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
 )
 
-// InitLogger 初始化一个全局的 slog JSON 格式记录器
-func InitLogger() {
-	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo, // 你可以根据环境调整日志级别，例如 LevelDebug
+// logLevel 是全局 logger 的日志级别，重新加载配置 (SIGHUP) 时通过 setLogLevel 修改
+var logLevel slog.LevelVar
+
+// InitLogger 初始化全局 slog 记录器，format 为 text 时输出便于阅读的文本格式，否则输出 JSON。
+// 启动时先以默认值调用，读取配置后再按 LogLevel、LogFormat 重新初始化
+func InitLogger(level, format string) {
+	options := &slog.HandlerOptions{Level: &logLevel}
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == LogFormatText {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, options)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, options)))
+	}
+	if format != "" && format != LogFormatText && format != LogFormatJSON {
+		slog.Warn("不支持的日志格式，已使用 json", "logFormat", format)
+	}
+	setLogLevel(level)
+}
+
+// setLogLevel 按名称 (debug、info、warn、error，不区分大小写) 设置日志级别，无法识别时使用 info
+func setLogLevel(name string) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "", "info":
+		logLevel.Set(slog.LevelInfo)
+	case "warn", "warning":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	default:
+		logLevel.Set(slog.LevelInfo)
+		slog.Warn("不支持的日志级别，已使用 info", "logLevel", name)
+	}
+}
+
+// gormLogLevel 返回与当前日志级别对应的 gorm 日志级别: debug 时输出每条 SQL；
+// release 模式 (GIN_MODE=release) 下 info 只输出错误和慢查询，开发时仍输出每条 SQL 便于调试
+func gormLogLevel() logger.LogLevel {
+	switch level := logLevel.Level(); {
+	case level <= slog.LevelDebug:
+		return logger.Info
+	case level >= slog.LevelError:
+		return logger.Error
+	case level >= slog.LevelWarn || os.Getenv("GIN_MODE") == gin.ReleaseMode:
+		return logger.Warn
+	default:
+		return logger.Info
+	}
+}
+
+// newGormLogger 创建 gorm 使用的 logger，执行时间超过 slowThreshold 的查询以警告输出，0 表示不记录慢查询。
+// 查询不到记录在本项目中是正常分支 (例如分享码不存在)，不作为错误输出
+func newGormLogger(slowThreshold time.Duration) logger.Interface {
+	return logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold:             slowThreshold,
+		LogLevel:                  gormLogLevel(),
+		IgnoreRecordNotFoundError: true,
+		Colorful:                  os.Getenv("GIN_MODE") != gin.ReleaseMode,
 	})
-	logger := slog.New(handler)
-	slog.SetDefault(logger)
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID 限制沿用的上游请求 ID 的格式，防止客户端借此向日志注入任意内容
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type loggerContextKey struct{}
+
+// contextWithLogger 返回携带 logger 的 context，之后的存储、扫描等调用通过 loggerFromContext 取回
+func contextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// loggerFromContext 返回 ctx 中的请求级 logger，后台任务等没有请求的场景返回全局 logger
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestLogger 返回当前请求的 logger，每条日志都带有 requestId
+func requestLogger(c *gin.Context) *slog.Logger {
+	return loggerFromContext(c.Request.Context())
+}
+
+// RequestIDMiddleware 为每个请求分配 ID 并写入 X-Request-ID 响应头，同时把带有该 ID 的 logger 放入请求的 context，
+// 一次上传经过临时文件、扫描和存储的日志可以按 requestId 串起来。反向代理已设置格式合法的 X-Request-ID 时沿用它。
+// 启用 Tracing 时日志还带有 traceId，请求的 span 上也记录 requestId，两者可以互相查找
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Header(requestIDHeader, id)
+		logger := slog.Default().With("requestId", id)
+		if span := trace.SpanFromContext(c.Request.Context()); span.SpanContext().IsValid() {
+			span.SetAttributes(attribute.String("request.id", id))
+			logger = logger.With("traceId", span.SpanContext().TraceID().String())
+		}
+		c.Request = c.Request.WithContext(contextWithLogger(c.Request.Context(), logger))
+		c.Next()
+	}
 }
@@ -6,41 +6,105 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	InitLogger()
+	InitLogger("", "")
 
 	if err := LoadConfig("config.json"); err != nil {
 		slog.Error("加载配置时发生严重错误，程序无法启动", "error", err)
 		os.Exit(1)
 	}
+	InitLogger(AppConfig().LogLevel, AppConfig().LogFormat)
 
-	if !AppConfig.Initialized {
+	// init 用于生成配置文件，未初始化时也允许执行
+	if !AppConfig().Initialized && (len(os.Args) < 2 || os.Args[1] != "init") {
 		runInitializationGuide()
 		os.Exit(1)
 	}
 
-	storage, err := NewFileStorage(AppConfig.Storage)
+	if err := AppConfig().Validate(); err != nil {
+		// errors.Join 合并的错误每行一个问题，逐条输出便于对照修改
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			slog.Error("配置无效", "problem", problem)
+		}
+		os.Exit(1)
+	}
+
+	// 带子命令时执行维护命令后退出，不启动 HTTP 服务
+	if len(os.Args) > 1 {
+		runSubcommand(os.Args[1], os.Args[2:])
+		return
+	}
+
+	if err := InitTracing(AppConfig().Tracing); err != nil {
+		slog.Error("追踪初始化失败", "error", err)
+		os.Exit(1)
+	}
+	if err := InitGeoIP(AppConfig().GeoIP); err != nil {
+		slog.Error("GeoIP 初始化失败", "error", err)
+		os.Exit(1)
+	}
+
+	storage, err := NewFileStorage(AppConfig().Storage)
 	if err != nil {
 		slog.Error("存储后端初始化失败", "error", err)
 		os.Exit(1)
 	}
-	db, err := ConnectDatabase(AppConfig.Database)
+	db, err := ConnectDatabase(AppConfig().Database)
 	if err != nil {
 		slog.Error("数据库初始化失败", "error", err)
 		os.Exit(1)
 	}
-	clamdScanner, err := NewScanner(AppConfig.ClamdSocket)
+	if AppConfig().Tracing.Enabled {
+		storage = &tracingStorage{FileStorage: storage, backend: strings.ToLower(AppConfig().Storage.Type)}
+		if err := registerGormTracing(db); err != nil {
+			slog.Error("无法注册数据库追踪", "error", err)
+			os.Exit(1)
+		}
+	}
+	quota, err := NewStorageQuota(db, storage, AppConfig().MaxTotalStorageGB, AppConfig().EvictOldest)
 	if err != nil {
-		slog.Warn("Clamd 扫描器初始化失败，文件扫描功能将不可用。", "error", err)
+		slog.Error("存储配额初始化失败", "error", err)
+		os.Exit(1)
+	}
+	scanner, rescanner, err := NewConfiguredScanner(AppConfig())
+	if err != nil {
+		slog.Error("扫描器初始化失败", "error", err)
+		os.Exit(1)
+	}
+
+	alerts, err := NewAlertNotifier(AppConfig().AlertWebhook)
+	if err != nil {
+		slog.Error("告警配置无效", "error", err)
+		os.Exit(1)
+	}
+
+	notifier, err := NewDownloadNotifier(db, AppConfig().DownloadNotify, AppConfig().SMTP)
+	if err != nil {
+		slog.Error("下载通知配置无效", "error", err)
+		os.Exit(1)
+	}
+
+	// 清理任务按 filepath.WalkDir 生成的路径匹配 activeScanFiles，两边需要使用同样规范化的目录
+	tempScanDir = filepath.Clean(AppConfig().ScanTempDir)
+	if err := initDownloadSigningKey(AppConfig().DownloadSigningSecret); err != nil {
+		slog.Error("无法生成下载链接签名密钥", "error", err)
+		os.Exit(1)
+	}
+	fileCache = NewFileMetaCache(AppConfig().MetaCache)
+	go CleanupExpiredFilesTask(db, storage, quota)
+	go BackupTask(db, storage, AppConfig().Backup)
+	go CleanupStaleScanFilesTask(tempScanDir, time.Duration(AppConfig().ScanTempMaxAgeMinutes)*time.Minute)
+	if rescanner != nil && AppConfig().ScanRetry.Enabled {
+		go RescanFilesTask(db, storage, rescanner, alerts, AppConfig().ScanRetry)
 	}
-	go CleanupExpiredFilesTask(db, storage)
 
 	// --- Gin 路由器设置 ---
 	gin.SetMode(gin.DebugMode)
@@ -49,60 +113,118 @@ func main() {
 	}
 
 	router := gin.Default()
-	router.SetTrustedProxies(nil)
+	// 追踪中间件需要在 RequestIDMiddleware 之前，请求日志才能带上 traceId
+	if AppConfig().Tracing.Enabled {
+		router.Use(TracingMiddleware(AppConfig().Tracing.ServiceName))
+	}
+	router.Use(RequestIDMiddleware())
+	if err := configureTrustedProxies(router, AppConfig().TrustedProxies, AppConfig().TrustedHeader); err != nil {
+		slog.Error("可信代理配置无效", "error", err)
+		os.Exit(1)
+	}
+	configureTrustedPlatform(router, AppConfig().TrustedPlatform)
 
-	var allowedOrigins []string
-	if AppConfig.CORSAllowedOrigins != "" {
-		allowedOrigins = strings.Split(AppConfig.CORSAllowedOrigins, ",")
+	if !strings.Contains(AppConfig().DownloadURLTemplate, downloadURLCodePlaceholder) {
+		slog.Error("下载链接配置无效", "error", errInvalidDownloadURLTemplate, "downloadURLTemplate", AppConfig().DownloadURLTemplate)
+		os.Exit(1)
 	}
-	slog.Info("CORS Allowed Origins", "origins", allowedOrigins)
 
-	corsConfig := cors.Config{
-		AllowOrigins:     allowedOrigins,
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "X-File-Name", "X-File-Original-Size", "X-File-Encrypted", "X-File-Salt", "X-File-Expires-In", "X-File-Download-Once", "X-Requested-With", "X-File-Verification-Hash"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Disposition"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
+	corsMiddleware, err := NewCORSMiddleware(AppConfig())
+	if err != nil {
+		slog.Error("CORS 配置无效", "error", err)
+		os.Exit(1)
 	}
-	router.Use(cors.New(corsConfig))
+	cors := newSwappableHandler(corsMiddleware)
+	router.Use(cors.Handle)
 
 	fileHandler := &FileHandler{
 		DB:      db,
-		Scanner: clamdScanner,
+		Scanner: scanner,
 		Storage: storage,
+		Quota:   quota,
+		Uploads: NewUploadTracker(uploadSessionTTL),
+		Alerts:  alerts,
+		Notify:  notifier,
 	}
 
+	uploadAccessMiddleware, downloadAccessMiddleware, err := accessControlHandlers(AppConfig().AccessControl)
+	if err != nil {
+		slog.Error("IP 访问控制初始化失败", "error", err)
+		os.Exit(1)
+	}
+	uploadAccess, downloadAccess := newSwappableHandler(uploadAccessMiddleware), newSwappableHandler(downloadAccessMiddleware)
+
+	rateLimits := NewRateLimitGroups(AppConfig().RateLimit)
+	uploadLimiter := NewUploadLimiter(AppConfig().MaxConcurrentUploads)
+
+	// 收到 SIGHUP 时重新加载限流、CORS、上传大小、默认有效期、IP 黑白名单和维护模式等配置，不中断现有连接
+	reloader := &ConfigReloader{
+		path:           "config.json",
+		rateLimits:     rateLimits,
+		cors:           cors,
+		uploadAccess:   uploadAccess,
+		downloadAccess: downloadAccess,
+	}
+	reloader.WatchSignals()
+
 	router.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "ok"}) })
+	router.GET("/metrics", HandleMetrics(uploadLimiter, quota))
 	apiV1 := router.Group("/api/v1")
+	if compression := AppConfig().ResponseCompression; compression.Enabled {
+		apiV1.Use(ResponseCompressionMiddleware(compression.MinSizeBytes))
+	}
+	apiV1.Use(RequestTimeoutMiddleware())
 	{
-		if AppConfig.RateLimit.Enabled {
-			limiter := NewIPRateLimiter(AppConfig.RateLimit.Requests, AppConfig.GetRateLimitDuration())
-			uploadAndReportGroup := apiV1.Group("/")
-			uploadAndReportGroup.Use(limiter.RateLimitMiddleware())
-			{
-				uploadAndReportGroup.POST("/uploads/stream-complete", fileHandler.HandleStreamUpload)
-				uploadAndReportGroup.POST("/report", fileHandler.HandleReport)
-			}
-			slog.Info("已启用上传/举报速率限制", "requests", AppConfig.RateLimit.Requests, "durationMinutes", AppConfig.RateLimit.DurationMinutes)
-		} else {
+		uploadAndReportGroup := apiV1.Group("/")
+		uploadAndReportGroup.Use(uploadAccess.Handle, MaintenanceMiddleware())
+		if !AppConfig().RateLimit.Enabled {
 			slog.Warn("速率限制已禁用")
-			apiV1.POST("/uploads/stream-complete", fileHandler.HandleStreamUpload)
-			apiV1.POST("/report", fileHandler.HandleReport)
 		}
+		{
+			uploadAndReportGroup.POST("/uploads/stream-complete", rateLimits.Middleware(RateLimitUploads), uploadLimiter.UploadLimitMiddleware(), fileHandler.HandleStreamUpload)
+			uploadAndReportGroup.POST("/uploads/init", rateLimits.Middleware(RateLimitUploads), fileHandler.HandleInitUpload)
+			uploadAndReportGroup.POST("/uploads/batch", rateLimits.Middleware(RateLimitUploads), uploadLimiter.UploadLimitMiddleware(), fileHandler.HandleBatchUpload)
+			uploadAndReportGroup.POST("/report", rateLimits.Middleware(RateLimitReports), fileHandler.HandleReport)
+		}
+		// 上传进度查询是只读的，不受维护模式和上传 IP 访问控制的限制: 维护模式开启前已开始的上传仍可查询进度。
+		// 上传 ID 是随机的 UUID，只有发起上传的客户端知道
+		apiV1.GET("/uploads/:id/status", fileHandler.HandleGetUploadStatus)
 		apiV1.GET("/files/meta/:code", fileHandler.HandleGetFileMeta)
-		apiV1.GET("/files/public", fileHandler.HandleGetPublicFiles)
+		apiV1.POST("/files/meta/batch", rateLimits.Middleware(RateLimitPreviews), fileHandler.HandleGetFileMetaBatch)
+		apiV1.GET("/files/:code/stats", fileHandler.HandleGetFileStats)
+		apiV1.POST("/files/:code/rotate", MaintenanceMiddleware(), rateLimits.Middleware(RateLimitUploads), fileHandler.HandleRotateAccessCode)
+		apiV1.POST("/files/:code/sign", rateLimits.Middleware(RateLimitUploads), fileHandler.HandleSignDownloadLink)
+		// 公开文件列表和搜索是仅有的能发现他人文件的入口，关闭 EnablePublicGallery 时不注册这两个路由 (返回 404)
+		if AppConfig().EnablePublicGallery {
+			apiV1.GET("/files/public", fileHandler.HandleGetPublicFiles)
+			apiV1.GET("/files/search", rateLimits.Middleware(RateLimitPreviews), fileHandler.HandleSearchPublicFiles)
+		}
 		apiV1.GET("/info", HandleGetAppInfo)
-		apiV1.GET("/preview/:code", fileHandler.HandlePreviewFile)
-		apiV1.GET("/preview/data-uri/:code", fileHandler.HandlePreviewDataURI)
+		apiV1.GET("/config/expiry-presets", HandleGetExpiryPresets)
+		apiV1.GET("/link-preview/:code", rateLimits.Middleware(RateLimitPreviews), fileHandler.HandleLinkPreview)
+		apiV1.GET("/preview/:code", rateLimits.Middleware(RateLimitPreviews), fileHandler.HandlePreviewFile)
+		apiV1.GET("/preview/data-uri/:code", rateLimits.Middleware(RateLimitPreviews), fileHandler.HandlePreviewDataURI)
+		apiV1.GET("/snippet/:code", rateLimits.Middleware(RateLimitPreviews), fileHandler.HandleGetSnippet)
+	}
+	if AppConfig().DownloadLandingPage {
+		landingRoute, err := downloadLandingRoute(AppConfig().DownloadURLTemplate)
+		if err != nil {
+			slog.Error("下载落地页配置无效", "error", err)
+			os.Exit(1)
+		}
+		router.GET(landingRoute, rateLimits.Middleware(RateLimitDownloads), fileHandler.HandleDownloadLanding)
+		slog.Info("已启用下载落地页", "route", landingRoute)
 	}
 	dataGroup := router.Group("/data/:code")
+	dataGroup.Use(downloadAccess.Handle)
+	dataGroup.Use(rateLimits.Middleware(RateLimitDownloads))
 	{
 		dataGroup.GET("", fileHandler.HandleDownloadFile)
 		dataGroup.POST("", fileHandler.HandleDownloadFile)
+		dataGroup.HEAD("", fileHandler.HandleDownloadHead)
 	}
 
-	serverAddr := ":" + AppConfig.ServerPort
+	serverAddr := ":" + AppConfig().ServerPort
 
 	// ✨✨✨ 核心修复点: 区分本地开发 (HTTPS) 和生产 (HTTP) 启动方式 ✨✨✨
 	certFile := "cert.pem"
@@ -127,6 +249,89 @@ func main() {
 	}
 }
 
+// configureTrustedProxies 决定 c.ClientIP() 如何解析真实客户端地址，速率限制、IP 访问控制和日志都依赖它。
+//
+// 安全说明: 只有当请求的直接来源 (RemoteAddr) 属于 proxies 中的 CIDR 时，才会读取 header 中的地址；
+// 否则任何客户端都可以伪造 X-Forwarded-For 来绕过限流或访问控制。因此 proxies 必须只包含
+// 你自己控制的反向代理 (例如 nginx 所在的 Docker 网段或 Cloudflare 的出口网段)，切勿填写 0.0.0.0/0。
+// 未配置 proxies 时不信任任何代理，ClientIP() 直接使用 TCP 连接的对端地址。
+func configureTrustedProxies(router *gin.Engine, proxies []string, header string) error {
+	var cidrs []string
+	for _, proxy := range proxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			cidrs = append(cidrs, proxy)
+		}
+	}
+	if len(cidrs) == 0 {
+		return router.SetTrustedProxies(nil)
+	}
+	if err := router.SetTrustedProxies(cidrs); err != nil {
+		return err
+	}
+	if header = strings.TrimSpace(header); header != "" {
+		// 只读取指定的一个头，例如 Cloudflare 的 CF-Connecting-IP，避免其他头被用来伪造地址
+		router.RemoteIPHeaders = []string{header}
+	}
+	slog.Info("已启用可信代理", "trustedProxies", cidrs, "trustedHeader", router.RemoteIPHeaders)
+	return nil
+}
+
+// trustedPlatforms 是 TrustedPlatform 可使用的平台名称及其写入真实客户端 IP 的请求头
+var trustedPlatforms = map[string]string{
+	"cloudflare": gin.PlatformCloudflare,
+	"appengine":  gin.PlatformGoogleAppEngine,
+	"flyio":      gin.PlatformFlyIO,
+}
+
+// configureTrustedPlatform 让 c.ClientIP() 优先使用托管平台写入的请求头。platform 可以是 trustedPlatforms 中的名称，
+// 也可以直接是请求头名称。
+//
+// 安全说明: 与 TrustedProxies 不同，平台请求头不检查直接来源，任何能直连本服务的客户端都可以伪造它。
+// 只应在源站只能经由该平台访问时使用 (例如只放行 Cloudflare 网段的防火墙或 Cloudflare Tunnel)；
+// 代理地址固定时，应优先使用 TrustedProxies 加 TrustedHeader
+func configureTrustedPlatform(router *gin.Engine, platform string) {
+	platform = strings.TrimSpace(platform)
+	if platform == "" {
+		return
+	}
+	header, ok := trustedPlatforms[strings.ToLower(platform)]
+	if !ok {
+		header = platform
+	}
+	router.TrustedPlatform = header
+	slog.Warn("已启用可信平台，将从平台请求头读取客户端 IP。请确保源站只能经由该平台访问，否则客户端可以伪造 IP 绕过限流",
+		"trustedPlatform", platform, "header", header)
+}
+
+// subcommands 是可通过 `tempshare <命令> [参数]` 运行的维护命令
+var subcommands = map[string]func(args []string) error{
+	"migrate": runMigrate,
+	"fsck":    runFsck,
+	"files":   runListFiles,
+	"backup":  runBackupCommand,
+	"restore": runRestore,
+	"reports": runReports,
+	"feature": runFeature,
+	"init":    runInit,
+}
+
+func runSubcommand(name string, args []string) {
+	cmd, ok := subcommands[name]
+	if !ok {
+		names := make([]string, 0, len(subcommands))
+		for n := range subcommands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "未知命令: %s (可用命令: %s)\n", name, strings.Join(names, ", "))
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		slog.Error("命令执行失败", "command", name, "error", err)
+		os.Exit(1)
+	}
+}
+
 func runInitializationGuide() {
 	fmt.Println("--- 闪传驿站 | TempShare 未初始化 ---")
 	fmt.Println("检测到这是首次运行或配置尚未完成。")
@@ -144,7 +349,22 @@ func runInitializationGuide() {
 	fmt.Println("## 本地存储 (默认)")
 	fmt.Println("TEMPSHARE_STORAGE_TYPE=local")
 	fmt.Println("TEMPSHARE_STORAGE_LOCALPATH=data/files     # 推荐放在持久化卷中")
+	fmt.Println("## S3 兼容存储 (AWS S3、MinIO、R2 等)")
+	fmt.Println("# TEMPSHARE_STORAGE_TYPE=s3")
+	fmt.Println("# TEMPSHARE_STORAGE_S3_ENDPOINT=http://minio:9000   # 使用 AWS S3 时留空")
+	fmt.Println("# TEMPSHARE_STORAGE_S3_REGION=us-east-1")
+	fmt.Println("# TEMPSHARE_STORAGE_S3_BUCKET=tempshare")
+	fmt.Println("# TEMPSHARE_STORAGE_S3_ACCESSKEYID=your_access_key")
+	fmt.Println("# TEMPSHARE_STORAGE_S3_SECRETACCESSKEY=your_secret_key")
+	fmt.Println("# TEMPSHARE_STORAGE_S3_USEPATHSTYLE=true          # MinIO 等自建服务通常需要")
+	fmt.Println("# TEMPSHARE_STORAGE_S3_CREATEBUCKETIFMISSING=true # 桶不存在时在启动时自动创建")
+	fmt.Println("## WebDAV")
+	fmt.Println("# TEMPSHARE_STORAGE_TYPE=webdav")
+	fmt.Println("# TEMPSHARE_STORAGE_WEBDAV_URL=https://your-webdav-server.com/remote.php/dav/files/username/")
+	fmt.Println("# TEMPSHARE_STORAGE_WEBDAV_USERNAME=your_webdav_user")
+	fmt.Println("# TEMPSHARE_STORAGE_WEBDAV_PASSWORD=your_webdav_password")
 	fmt.Println("\n# (可选) ... 其他配置项 ...")
 	fmt.Println("-----------------------------------------------------------------")
 	fmt.Println("\n配置完成后，请确保 TEMPSHARE_INITIALIZED=true，然后重新启动服务。")
+	fmt.Println("也可以在设置好上述变量后运行 `tempshare init`，把校验后的配置写入 config.json，之后直接启动即可。")
 }
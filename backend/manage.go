@@ -0,0 +1,92 @@
+// backend/manage.go
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// manageTokenHeader 是管理接口 (轮换分享码等) 携带管理令牌的请求头
+const manageTokenHeader = "X-Manage-Token"
+
+// newManageToken 生成上传时返回给上传者的管理令牌 (256 位随机数)，以及入库的 SHA-256 摘要。
+// 令牌本身足够随机，不需要 argon2 这类慢哈希
+func newManageToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashManageToken(token), nil
+}
+
+func hashManageToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authorizeManage 按分享码查找文件并校验 X-Manage-Token。
+// 失败时已写入错误响应；没有管理令牌的旧记录无法通过校验
+func (h *FileHandler) authorizeManage(c *gin.Context) (File, bool) {
+	// 管理操作 (统计、轮换) 总是读取最新的记录，缓存中的访问计数可能已经过时
+	fileCache.Invalidate(c.Param("code"))
+	file, ok := h.findActiveFile(c, c.Param("code"))
+	if !ok {
+		return File{}, false
+	}
+	token := c.GetHeader(manageTokenHeader)
+	if token == "" || file.ManageTokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hashManageToken(token)), []byte(file.ManageTokenHash)) != 1 {
+		requestLogger(c).Warn("管理令牌校验失败", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+		respondError(c, http.StatusForbidden, ErrCodeInvalidManageToken, translate(c, msgInvalidManageToken))
+		return File{}, false
+	}
+	return file, true
+}
+
+// HandleRotateAccessCode 为文件生成新的分享码，旧分享码立即失效。存储对象和 StorageKey 保持不变，
+// 举报记录随文件一起迁移到新分享码，轮换不会清零举报计数
+func (h *FileHandler) HandleRotateAccessCode(c *gin.Context) {
+	file, ok := h.authorizeManage(c)
+	if !ok {
+		return
+	}
+	newCode, err := h.generateUniqueAccessCode(AppConfig().AccessCodeLength)
+	if err != nil {
+		requestLogger(c).Error("无法生成分享码", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgAccessCodeFailed))
+		return
+	}
+
+	err = h.db(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// 以旧分享码作为条件，并发轮换时只有一个请求生效
+		result := tx.Model(&File{}).Where("id = ? AND access_code = ?", file.ID, file.AccessCode).Update("access_code", newCode)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&Report{}).Where("access_code = ?", file.AccessCode).Update("access_code", newCode).Error
+	})
+	fileCache.Invalidate(file.AccessCode)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusNotFound, ErrCodeFileNotFound, translate(c, msgFileNotFound))
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("轮换分享码失败", "accessCode", file.AccessCode, "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgInternalError))
+		return
+	}
+	requestLogger(c).Info("分享码已轮换", "clientIP", c.ClientIP(), "oldAccessCode", file.AccessCode, "accessCode", newCode)
+	c.JSON(http.StatusOK, gin.H{"accessCode": newCode, "urlPath": downloadURLPath(newCode)})
+}
@@ -0,0 +1,121 @@
+// backend/meta.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// expiringSoonThreshold 内即将过期的文件在元信息中标记 isExpiringSoon
+	expiringSoonThreshold = time.Hour
+	// maxMetaBatchSize 是批量元信息查询一次最多接受的分享码数量
+	maxMetaBatchSize = 50
+)
+
+// FileMetaResponse 是 /api/v1/files/meta/:code 的响应结构。与 File 模型解耦，
+// 只暴露前端需要的字段，并附带在请求时计算的剩余时间，客户端无需自行实现倒计时换算
+type FileMetaResponse struct {
+	AccessCode         string            `json:"accessCode"`
+	Filename           string            `json:"filename"`
+	EncryptedFilename  string            `json:"encryptedFilename,omitempty"`
+	SizeBytes          int64             `json:"sizeBytes"`
+	OriginalSizeBytes  int64             `json:"originalSizeBytes"`
+	IsEncrypted        bool              `json:"isEncrypted"`
+	EncryptionSalt     string            `json:"encryptionSalt"`
+	EncryptionManifest json.RawMessage   `json:"encryptionManifest,omitempty"`
+	DownloadOnce       bool              `json:"downloadOnce"`
+	BurnOnView         bool              `json:"burnOnView"`
+	PasswordProtected  bool              `json:"passwordProtected"`
+	CreatedAt          time.Time         `json:"createdAt"`
+	ExpiresAt          time.Time         `json:"expiresAt"`
+	ExpiryLabel        string            `json:"expiryLabel"`
+	ExpiresInSeconds   int64             `json:"expiresInSeconds"`
+	IsExpiringSoon     bool              `json:"isExpiringSoon"`
+	ScanStatus         string            `json:"scanStatus"`
+	ScanResult         string            `json:"scanResult"`
+	Tags               map[string]string `json:"tags,omitempty"`
+	Description        string            `json:"description,omitempty"`
+}
+
+// newFileMetaResponse 根据文件记录和当前时间构建元信息响应。压缩存储的文件对外展示解压后的大小
+func newFileMetaResponse(file File, now time.Time) FileMetaResponse {
+	remaining := file.ExpiresAt.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	// 加密清单原样输出为 JSON 值而不是字符串
+	var manifest json.RawMessage
+	if file.EncryptionManifest != "" {
+		manifest = json.RawMessage(file.EncryptionManifest)
+	}
+	return FileMetaResponse{
+		AccessCode:         file.AccessCode,
+		Filename:           file.Filename,
+		EncryptedFilename:  file.EncryptedFilename,
+		SizeBytes:          file.contentLength(),
+		OriginalSizeBytes:  file.OriginalSizeBytes,
+		IsEncrypted:        file.IsEncrypted,
+		EncryptionSalt:     file.EncryptionSalt,
+		EncryptionManifest: manifest,
+		DownloadOnce:       file.DownloadOnce,
+		BurnOnView:         file.BurnOnView,
+		PasswordProtected:  file.PasswordProtected,
+		CreatedAt:          file.CreatedAt,
+		ExpiresAt:          file.ExpiresAt,
+		ExpiryLabel:        fileExpiryLabel(file),
+		ExpiresInSeconds:   int64(remaining / time.Second),
+		IsExpiringSoon:     remaining < expiringSoonThreshold,
+		ScanStatus:         file.ScanStatus,
+		ScanResult:         file.ScanResult,
+		Tags:               file.tags(),
+		Description:        file.Description,
+	}
+}
+
+// restrictedFileMeta 是批量查询中受密码保护或阅后即焚文件的元信息。这类文件的详情只能通过单个查询获取
+// (需要密码，或会被标记为已查看)，批量查询只告知文件存在以及需要的操作
+type restrictedFileMeta struct {
+	AccessCode        string `json:"accessCode"`
+	PasswordProtected bool   `json:"passwordProtected"`
+	BurnOnView        bool   `json:"burnOnView"`
+	Restricted        bool   `json:"restricted"`
+}
+
+type batchMetaPayload struct {
+	AccessCodes []string `json:"accessCodes" binding:"required"`
+}
+
+// HandleGetFileMetaBatch 用一次数据库查询返回多个分享码的元信息，请求体为 {"accessCodes": [...]}，最多 maxMetaBatchSize 个。
+// 响应是 分享码 -> 元信息 的对象，不存在、已过期或已被下架的分享码对应 null。
+// 受密码保护或阅后即焚的文件只返回 restrictedFileMeta，批量查询不会触发阅后即焚，也不计入查看次数
+func (h *FileHandler) HandleGetFileMetaBatch(c *gin.Context) {
+	var payload batchMetaPayload
+	if err := c.ShouldBindJSON(&payload); err != nil || len(payload.AccessCodes) == 0 || len(payload.AccessCodes) > maxMetaBatchSize {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidMetaBatch, maxMetaBatchSize))
+		return
+	}
+	result := make(map[string]interface{}, len(payload.AccessCodes))
+	for _, code := range payload.AccessCodes {
+		result[code] = nil
+	}
+
+	now := time.Now()
+	var files []File
+	if err := h.db(c.Request.Context()).Where("access_code IN ? AND expires_at > ? AND quarantined = false", payload.AccessCodes, now).Find(&files).Error; err != nil {
+		requestLogger(c).Error("批量查询文件元信息失败", "count", len(payload.AccessCodes), "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgInternalError))
+		return
+	}
+	for _, file := range files {
+		if file.PasswordProtected || file.BurnOnView {
+			result[file.AccessCode] = restrictedFileMeta{AccessCode: file.AccessCode, PasswordProtected: file.PasswordProtected, BurnOnView: file.BurnOnView, Restricted: true}
+			continue
+		}
+		result[file.AccessCode] = newFileMetaResponse(file, now)
+	}
+	c.JSON(http.StatusOK, result)
+}
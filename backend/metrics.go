@@ -0,0 +1,29 @@
+// backend/metrics.go
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleMetrics 以 Prometheus 文本格式输出运行时指标
+func HandleMetrics(uploads *UploadLimiter, quota *StorageQuota) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.String(http.StatusOK,
+			"# HELP tempshare_active_uploads 当前正在进行的上传数量\n"+
+				"# TYPE tempshare_active_uploads gauge\n"+
+				"tempshare_active_uploads %d\n"+
+				"# HELP tempshare_max_concurrent_uploads 并发上传上限，0 表示不限制\n"+
+				"# TYPE tempshare_max_concurrent_uploads gauge\n"+
+				"tempshare_max_concurrent_uploads %d\n"+
+				"# HELP tempshare_active_files 未过期的文件数量 (最多延迟 30 秒)\n"+
+				"# TYPE tempshare_active_files gauge\n"+
+				"tempshare_active_files %d\n"+
+				"# HELP tempshare_max_active_files 未过期文件数量上限，0 表示不限制\n"+
+				"# TYPE tempshare_max_active_files gauge\n"+
+				"tempshare_max_active_files %d\n",
+			uploads.Active(), uploads.Max(), quota.ActiveFiles(), AppConfig().MaxActiveFiles)
+	}
+}
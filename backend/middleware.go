@@ -2,75 +2,394 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 )
 
+// 速率限制的接口类别，每个类别拥有独立的配额
+const (
+	RateLimitUploads   = "uploads"
+	RateLimitDownloads = "downloads"
+	RateLimitReports   = "reports"
+	RateLimitPreviews  = "previews"
+)
+
+// rateLimitEntry 是单个 IP 的限制器及其最近一次请求时间
+type rateLimitEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
 // IPRateLimiter 存储每个IP地址的速率限制器
 type IPRateLimiter struct {
-	ips      map[string]*rate.Limiter
+	name     string
+	ips      map[string]*rateLimitEntry
 	mu       sync.Mutex
 	requests int
+	burst    int
 	duration time.Duration
+	stop     chan struct{}
 }
 
-// NewIPRateLimiter 创建一个新的速率限制器实例
-func NewIPRateLimiter(r int, d time.Duration) *IPRateLimiter {
-	return &IPRateLimiter{
-		ips:      make(map[string]*rate.Limiter),
+// NewIPRateLimiter 创建一个名为 name 的速率限制器实例: 在 d 内允许 r 次请求，突发上限为 burst (0 表示等于 r)。
+// 同时启动一个清理协程，定期移除空闲超过 d 的 IP。
+func NewIPRateLimiter(name string, r int, d time.Duration, burst int) *IPRateLimiter {
+	if burst <= 0 {
+		burst = r
+	}
+	i := &IPRateLimiter{
+		name:     name,
+		ips:      make(map[string]*rateLimitEntry),
 		requests: r,
+		burst:    burst,
 		duration: d,
+		stop:     make(chan struct{}),
 	}
+	go i.janitor()
+	return i
 }
 
-// addIP 创建一个新的速率限制器并添加到IP映射中
-func (i *IPRateLimiter) addIP(ip string) *rate.Limiter {
-	i.mu.Lock()
-	defer i.mu.Unlock()
-
-	// 使用 rate.NewLimiter(每秒事件数, 桶的大小)
-	// 我们希望在 'duration' 内允许 'requests' 次请求
-	// 所以速率是 requests / duration_in_seconds
-	limiter := rate.NewLimiter(rate.Limit(float64(i.requests)/i.duration.Seconds()), i.requests)
-	i.ips[ip] = limiter
+// Stop 结束清理协程，限制器被重新加载的配置替换后调用
+func (i *IPRateLimiter) Stop() {
+	close(i.stop)
+}
 
-	// 启动一个goroutine，在持续时间后从map中删除此IP，以防止内存泄漏
-	go func() {
-		time.Sleep(i.duration)
-		i.mu.Lock()
-		delete(i.ips, ip)
-		i.mu.Unlock()
-	}()
+// janitor 定期清扫空闲的 IP。空闲时间足以让令牌桶完全回满的 IP 被删除后重建不会改变限流结果，
+// 而仍在活跃的 IP 会保留原有状态。
+func (i *IPRateLimiter) janitor() {
+	idleTTL := i.duration
+	if i.burst > i.requests {
+		idleTTL = i.duration * time.Duration(i.burst) / time.Duration(i.requests)
+	}
+	interval := i.duration
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	return limiter
+	for {
+		select {
+		case <-i.stop:
+			return
+		case now := <-ticker.C:
+			i.mu.Lock()
+			for ip, entry := range i.ips {
+				if now.Sub(entry.lastSeen) > idleTTL {
+					delete(i.ips, ip)
+				}
+			}
+			i.mu.Unlock()
+		}
+	}
 }
 
-// getLimiter 从map中获取一个IP的速率限制器，如果不存在则创建一个
+// getLimiter 从map中获取一个IP的速率限制器，如果不存在则创建一个，并刷新其最近访问时间
 func (i *IPRateLimiter) getLimiter(ip string) *rate.Limiter {
 	i.mu.Lock()
-	limiter, exists := i.ips[ip]
-	i.mu.Unlock()
+	defer i.mu.Unlock()
 
+	entry, exists := i.ips[ip]
 	if !exists {
-		// 使用双重检查锁定模式来避免不必要的锁定
-		return i.addIP(ip)
+		// 使用 rate.NewLimiter(每秒事件数, 桶的大小)
+		// 我们希望在 'duration' 内允许 'requests' 次请求
+		// 所以速率是 requests / duration_in_seconds
+		entry = &rateLimitEntry{limiter: rate.NewLimiter(rate.Limit(float64(i.requests)/i.duration.Seconds()), i.burst)}
+		i.ips[ip] = entry
 	}
-
-	return limiter
+	entry.lastSeen = time.Now()
+	return entry.limiter
 }
 
 // RateLimitMiddleware 是 Gin 中间件函数
 func (i *IPRateLimiter) RateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		limiter := i.getLimiter(c.ClientIP())
-		if !limiter.Allow() {
-			slog.Warn("速率限制触发", "clientIP", c.ClientIP())
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "请求过于频繁，请稍后再试。"})
+		if !i.allow(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// allow 消耗客户端 IP 的一个令牌，超出限制时写入 429 并返回 false，
+// 同时通过 Retry-After 告知客户端令牌桶补充下一个令牌还需等待多久
+func (i *IPRateLimiter) allow(c *gin.Context) bool {
+	reservation := i.getLimiter(c.ClientIP()).Reserve()
+	if delay := reservation.Delay(); !reservation.OK() || delay > 0 {
+		reservation.Cancel() // 被拒绝的请求不消耗令牌
+		if reservation.OK() {
+			setRetryAfter(c, delay)
+		}
+		requestLogger(c).Warn("速率限制触发", "group", i.name, "clientIP", c.ClientIP())
+		abortWithError(c, http.StatusTooManyRequests, ErrCodeRateLimited, translate(c, msgRateLimited))
+		return false
+	}
+	return true
+}
+
+// RateLimitGroups 按接口类别持有相互独立的速率限制器，避免下载洪峰耗尽上传配额，反之亦然。
+// 限制器集合可以在运行时通过 Reload 整体替换
+type RateLimitGroups struct {
+	limiters atomic.Pointer[map[string]*IPRateLimiter]
+}
+
+// NewRateLimitGroups 根据配置为每个类别创建限制器。
+// 上传和举报未单独配置时沿用顶层的 Requests/DurationMinutes；下载和预览未配置时不限制。
+func NewRateLimitGroups(config RateLimitConfig) *RateLimitGroups {
+	g := &RateLimitGroups{}
+	limiters := buildRateLimiters(config, nil)
+	g.limiters.Store(&limiters)
+	return g
+}
+
+// Reload 按新的配置替换限制器。规则未变化的类别沿用原来的限制器，各 IP 已消耗的配额不会被重置；
+// 其余旧限制器停止清理协程后丢弃
+func (g *RateLimitGroups) Reload(config RateLimitConfig) {
+	old := *g.limiters.Load()
+	limiters := buildRateLimiters(config, old)
+	g.limiters.Store(&limiters)
+	for name, limiter := range old {
+		if limiters[name] != limiter {
+			limiter.Stop()
+		}
+	}
+}
+
+// buildRateLimiters 创建各类别的限制器，existing 中规则相同的限制器直接复用
+func buildRateLimiters(config RateLimitConfig, existing map[string]*IPRateLimiter) map[string]*IPRateLimiter {
+	limiters := make(map[string]*IPRateLimiter)
+	if !config.Enabled {
+		return limiters
+	}
+	fallback := RateLimitRule{Requests: config.Requests, DurationMinutes: config.DurationMinutes}
+	rules := map[string]RateLimitRule{
+		RateLimitUploads:   config.Uploads.orDefault(fallback),
+		RateLimitReports:   config.Reports.orDefault(fallback),
+		RateLimitDownloads: config.Downloads,
+		RateLimitPreviews:  config.Previews,
+	}
+	for name, rule := range rules {
+		if rule.Requests <= 0 || rule.DurationMinutes <= 0 {
+			continue
+		}
+		duration := time.Duration(rule.DurationMinutes) * time.Minute
+		burst := rule.Burst
+		if burst <= 0 {
+			burst = rule.Requests
+		}
+		if limiter, ok := existing[name]; ok && limiter.requests == rule.Requests && limiter.duration == duration && limiter.burst == burst {
+			limiters[name] = limiter
+			continue
+		}
+		limiters[name] = NewIPRateLimiter(name, rule.Requests, duration, rule.Burst)
+		slog.Info("已启用速率限制", "group", name, "requests", rule.Requests, "durationMinutes", rule.DurationMinutes, "burst", limiters[name].burst)
+	}
+	return limiters
+}
+
+// Middleware 返回指定类别的限流中间件，每个请求都使用当前生效的限制器，该类别未启用限流时直接放行
+func (g *RateLimitGroups) Middleware(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter, ok := (*g.limiters.Load())[name]; ok && !limiter.allow(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// UploadLimiter 限制全局同时进行的上传数量，保护内存和磁盘不被突发的大文件上传耗尽。
+// 与按 IP 的速率限制相互独立。
+type UploadLimiter struct {
+	slots  chan struct{} // nil 表示不限制
+	active atomic.Int64
+}
+
+// setRetryAfter 以整数秒设置 Retry-After 响应头，不足一秒的部分向上取整，且至少为 1 秒
+func setRetryAfter(c *gin.Context, d time.Duration) {
+	seconds := max(int64((d+time.Second-1)/time.Second), 1)
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// uploadRetryAfterSeconds 是上传并发已满时建议客户端等待的秒数
+const uploadRetryAfterSeconds = 10
+
+// NewUploadLimiter 创建并发上传限制器，max 为 0 表示不限制
+func NewUploadLimiter(max int) *UploadLimiter {
+	l := &UploadLimiter{}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+	return l
+}
+
+// Active 返回当前正在进行的上传数量
+func (l *UploadLimiter) Active() int64 { return l.active.Load() }
+
+// Max 返回并发上限，0 表示不限制
+func (l *UploadLimiter) Max() int { return cap(l.slots) }
+
+// UploadLimitMiddleware 在读取请求体之前占用一个上传名额，名额已满时立即返回 503
+func (l *UploadLimiter) UploadLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.slots != nil {
+			select {
+			case l.slots <- struct{}{}:
+				defer func() { <-l.slots }()
+			default:
+				requestLogger(c).Warn("并发上传数已达上限", "clientIP", c.ClientIP(), "max", cap(l.slots))
+				c.Header("Retry-After", strconv.Itoa(uploadRetryAfterSeconds))
+				abortWithError(c, http.StatusServiceUnavailable, ErrCodeServerBusy, translate(c, msgServerBusy))
+				return
+			}
+		}
+		l.active.Add(1)
+		defer l.active.Add(-1)
+		c.Next()
+	}
+}
+
+// MaintenanceMiddleware 在 MaintenanceMode 开启时以 503 拒绝上传、举报等写操作，下载和预览不受影响。
+// 每个请求读取当前配置，可以通过 SIGHUP 重新加载配置来开启或关闭维护模式
+func MaintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if AppConfig().MaintenanceMode {
+			c.Header("Retry-After", strconv.Itoa(uploadRetryAfterSeconds))
+			abortWithError(c, http.StatusServiceUnavailable, ErrCodeMaintenance, translate(c, msgMaintenance))
+			return
+		}
+		c.Next()
+	}
+}
+
+// requestTimeoutKey 标记请求的 context 带有 RequestTimeoutMiddleware 设置的截止时间，见 respondError
+const requestTimeoutKey = "requestTimeout"
+
+// longRunningRoutes 是不受 RequestTimeoutSeconds 限制的路由: 上传和流式预览的耗时取决于文件大小和客户端网速，
+// 由 Storage 的 SaveTimeoutSeconds / RetrieveTimeoutSeconds 限制。/data 下载不在 /api/v1 中，同样不受影响
+var longRunningRoutes = map[string]bool{
+	"/api/v1/uploads/stream-complete": true,
+	"/api/v1/uploads/batch":           true,
+	"/api/v1/preview/:code":           true,
+}
+
+// RequestTimeoutMiddleware 在 RequestTimeoutSeconds 后取消请求的 context，存储等支持 context 的操作随之中止，
+// 此时处理函数的错误响应由 respondError 改为 504 REQUEST_TIMEOUT。每个请求读取当前配置，0 表示不限制
+func RequestTimeoutMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		seconds := AppConfig().RequestTimeoutSeconds
+		if seconds <= 0 || longRunningRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(seconds)*time.Second)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(requestTimeoutKey, true)
+		c.Next()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			requestLogger(c).Warn("请求处理超时", "route", c.FullPath(), "timeoutSeconds", seconds, "responded", c.Writer.Written())
+			if !c.Writer.Written() {
+				respondError(c, http.StatusGatewayTimeout, ErrCodeRequestTimeout, translate(c, msgRequestTimeout))
+			}
+		}
+	}
+}
+
+// requestTimedOut 判断请求是否因 RequestTimeoutMiddleware 的截止时间而被取消 (客户端断开时为 Canceled，不在此列)
+func requestTimedOut(c *gin.Context) bool {
+	return c.GetBool(requestTimeoutKey) && errors.Is(c.Request.Context().Err(), context.DeadlineExceeded)
+}
+
+// IPAccessControl 根据 CIDR 白名单/黑名单限制客户端 IP
+type IPAccessControl struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// NewIPAccessControl 解析配置中的 CIDR 列表，空列表表示不做限制
+func NewIPAccessControl(config AccessControlConfig) (*IPAccessControl, error) {
+	allow, err := parsePrefixes(config.AllowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 AllowCIDRs: %w", err)
+	}
+	deny, err := parsePrefixes(config.DenyCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 DenyCIDRs: %w", err)
+	}
+	return &IPAccessControl{allow: allow, deny: deny}, nil
+}
+
+// parsePrefixes 将 CIDR 字符串解析为 netip.Prefix，也接受不带掩码的单个 IP
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Enabled 报告是否配置了任何规则
+func (a *IPAccessControl) Enabled() bool {
+	return len(a.allow) > 0 || len(a.deny) > 0
+}
+
+// Allowed 判断 IP 是否被允许: 命中黑名单即拒绝；配置了白名单时必须命中白名单
+func (a *IPAccessControl) Allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range a.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, p := range a.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessControlMiddleware 是 Gin 中间件函数
+func (a *IPAccessControl) AccessControlMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Allowed(c.ClientIP()) {
+			requestLogger(c).Warn("IP 访问控制拒绝请求", "clientIP", c.ClientIP(), "path", c.FullPath())
+			abortWithError(c, http.StatusForbidden, ErrCodeIPForbidden, translate(c, msgIPForbidden))
 			return
 		}
 		c.Next()
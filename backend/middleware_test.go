@@ -0,0 +1,53 @@
+// backend/middleware_test.go
+package main
+
+import "testing"
+
+func TestIPAccessControlAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		ip    string
+		want  bool
+	}{
+		{"no rules", nil, nil, "203.0.113.7", true},
+		{"allow match", []string{"10.0.0.0/8"}, nil, "10.1.2.3", true},
+		{"allow miss", []string{"10.0.0.0/8"}, nil, "11.0.0.1", false},
+		{"allow unmasked prefix", []string{"192.168.1.77/24"}, nil, "192.168.1.200", true},
+		{"allow single ip", []string{"198.51.100.5"}, nil, "198.51.100.5", true},
+		{"allow single ip miss", []string{"198.51.100.5"}, nil, "198.51.100.6", false},
+		{"deny match", nil, []string{"203.0.113.0/24"}, "203.0.113.9", false},
+		{"deny miss", nil, []string{"203.0.113.0/24"}, "203.0.114.9", true},
+		{"deny wins over allow", []string{"10.0.0.0/8"}, []string{"10.0.5.0/24"}, "10.0.5.1", false},
+		{"allowed outside denied subnet", []string{"10.0.0.0/8"}, []string{"10.0.5.0/24"}, "10.0.6.1", true},
+		{"ipv4-mapped ipv6", []string{"10.0.0.0/8"}, nil, "::ffff:10.0.0.1", true},
+		{"ipv6 match", []string{"2001:db8::/32"}, nil, "2001:db8:1::1", true},
+		{"ipv6 miss", []string{"2001:db8::/32"}, nil, "2001:db9::1", false},
+		{"ipv4 rule does not match ipv6", []string{"0.0.0.0/0"}, nil, "2001:db8::1", false},
+		{"blank entries ignored", []string{" ", "10.0.0.0/8"}, nil, "10.0.0.1", true},
+		{"invalid client ip", nil, nil, "not-an-ip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewIPAccessControl(AccessControlConfig{AllowCIDRs: tt.allow, DenyCIDRs: tt.deny})
+			if err != nil {
+				t.Fatalf("NewIPAccessControl: %v", err)
+			}
+			if got := a.Allowed(tt.ip); got != tt.want {
+				t.Fatalf("Allowed(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewIPAccessControlRejectsInvalidCIDR(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/33", "10.0.0", "example.com"} {
+		if _, err := NewIPAccessControl(AccessControlConfig{AllowCIDRs: []string{cidr}}); err == nil {
+			t.Errorf("AllowCIDRs %q 应返回错误", cidr)
+		}
+		if _, err := NewIPAccessControl(AccessControlConfig{DenyCIDRs: []string{cidr}}); err == nil {
+			t.Errorf("DenyCIDRs %q 应返回错误", cidr)
+		}
+	}
+}
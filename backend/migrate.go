@@ -0,0 +1,200 @@
+// backend/migrate.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// migrateBatchSize 是每次从数据库读取的文件记录数，避免一次性加载全部记录
+const migrateBatchSize = 100
+
+// migrateStats 汇总一次迁移的结果
+type migrateStats struct {
+	Copied  int
+	Skipped int // 目标端已存在且大小一致
+	Missing int // 源端对象丢失
+	Failed  int
+}
+
+// runMigrate 实现 `tempshare migrate --from local --to s3`: 将所有文件记录对应的对象从一种存储后端复制到另一种，
+// StorageKey 保持不变，因此分享码无需改动。两端都使用配置中的 Storage 段 (LocalPath/S3/WebDAV/KeyPrefix)，
+// 只是 Type 分别替换为 --from 和 --to。目标端已存在且大小一致的对象会被跳过，因此中断后重新运行即可继续。
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "", "源存储类型 (local/s3/webdav/ipfs/b2)")
+	to := fs.String("to", "", "目标存储类型 (local/s3/webdav/ipfs/b2)")
+	updateConfig := fs.Bool("update-config", true, "全部迁移成功后把 config.json 中的 Storage.Type 改为目标类型")
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		return errors.New("必须同时指定 --from 和 --to")
+	}
+	if strings.EqualFold(*from, *to) {
+		return errors.New("--from 和 --to 不能是同一种存储类型")
+	}
+
+	srcConfig, dstConfig := AppConfig().Storage, AppConfig().Storage
+	srcConfig.Type, dstConfig.Type = *from, *to
+	src, err := NewFileStorage(srcConfig)
+	if err != nil {
+		return fmt.Errorf("源存储初始化失败: %w", err)
+	}
+	dst, err := NewFileStorage(dstConfig)
+	if err != nil {
+		return fmt.Errorf("目标存储初始化失败: %w", err)
+	}
+	db, err := ConnectDatabase(AppConfig().Database)
+	if err != nil {
+		return fmt.Errorf("数据库初始化失败: %w", err)
+	}
+
+	slog.Info("开始迁移存储", "from", *from, "to", *to)
+	stats, err := migrateFiles(context.Background(), db, src, dst)
+	slog.Info("存储迁移结束", "copied", stats.Copied, "skipped", stats.Skipped, "missing", stats.Missing, "failed", stats.Failed)
+	if err != nil {
+		return err
+	}
+	if stats.Failed > 0 {
+		return fmt.Errorf("%d 个对象迁移失败，请检查日志后重新运行 (已完成的对象会被跳过)", stats.Failed)
+	}
+
+	if *updateConfig {
+		return switchStorageType("config.json", *to)
+	}
+	return nil
+}
+
+// migrateFiles 按 ID 顺序分批遍历文件记录，逐个复制对象
+func migrateFiles(ctx context.Context, db *gorm.DB, src, dst FileStorage) (migrateStats, error) {
+	var stats migrateStats
+	var batch []File
+	result := db.Select("id", "storage_key", "size_bytes").FindInBatches(&batch, migrateBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, file := range batch {
+			if migratedAlready(ctx, dst, file) {
+				stats.Skipped++
+				continue
+			}
+			err := copyObject(ctx, src, dst, file)
+			switch {
+			case err == nil:
+				stats.Copied++
+				slog.Debug("对象已迁移", "key", file.StorageKey, "size", file.SizeBytes)
+			case !src.Exists(file.StorageKey):
+				stats.Missing++
+				slog.Warn("源存储中缺少对象，已跳过", "key", file.StorageKey, "fileID", file.ID)
+			default:
+				stats.Failed++
+				slog.Error("对象迁移失败", "key", file.StorageKey, "fileID", file.ID, "error", err)
+			}
+		}
+		slog.Info("迁移进度", "copied", stats.Copied, "skipped", stats.Skipped, "missing", stats.Missing, "failed", stats.Failed)
+		return nil
+	})
+	return stats, result.Error
+}
+
+// migratedAlready 判断目标端是否已有完整的对象。只比较大小，上次中断时写了一半的对象会被重新复制
+func migratedAlready(ctx context.Context, dst FileStorage, file File) bool {
+	if !dst.Exists(file.StorageKey) {
+		return false
+	}
+	rc, err := dst.Retrieve(ctx, file.StorageKey)
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+	n, err := io.Copy(io.Discard, rc)
+	return err == nil && n == file.SizeBytes
+}
+
+// copyObject 复制单个对象，并从目标端读回比较 SHA-256 以确认内容一致
+func copyObject(ctx context.Context, src, dst FileStorage, file File) error {
+	rc, err := src.Retrieve(ctx, file.StorageKey)
+	if err != nil {
+		return fmt.Errorf("读取源对象失败: %w", err)
+	}
+	defer rc.Close()
+
+	srcHash := sha256.New()
+	written, err := dst.Save(ctx, file.StorageKey, io.TeeReader(rc, srcHash))
+	if err != nil {
+		return fmt.Errorf("写入目标对象失败: %w", err)
+	}
+
+	copied, err := dst.Retrieve(ctx, file.StorageKey)
+	if err != nil {
+		return fmt.Errorf("读回目标对象失败: %w", err)
+	}
+	defer copied.Close()
+	dstHash := sha256.New()
+	if _, err := io.Copy(dstHash, copied); err != nil {
+		return fmt.Errorf("读回目标对象失败: %w", err)
+	}
+	if !bytes.Equal(srcHash.Sum(nil), dstHash.Sum(nil)) {
+		return fmt.Errorf("校验失败: 目标对象内容与源对象不一致 (写入 %d 字节)", written)
+	}
+	return nil
+}
+
+// switchStorageType 把 config.json 中的 Storage.Type 改为 storageType，其余配置原样保留 (键的顺序可能变化)。
+// 配置文件不存在时 (例如 Docker 部署只用环境变量) 仅提示需要手动修改的环境变量
+func switchStorageType(path, storageType string) error {
+	hint := fmt.Sprintf("请将 TEMPSHARE_STORAGE_TYPE 设置为 %s 后重启服务", storageType)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("未找到配置文件，未自动修改配置。" + hint)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	// viper 的键不区分大小写，沿用文件中已有的写法
+	storageKey := "Storage"
+	for k := range raw {
+		if strings.EqualFold(k, "Storage") {
+			storageKey = k
+		}
+	}
+	storage, _ := raw[storageKey].(map[string]interface{})
+	if storage == nil {
+		storage = map[string]interface{}{}
+	}
+	typeKey := "Type"
+	for k := range storage {
+		if strings.EqualFold(k, "Type") {
+			typeKey = k
+		}
+	}
+	storage[typeKey] = storageType
+	raw[storageKey] = storage
+
+	data, err = json.MarshalIndent(raw, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	slog.Info("已更新配置文件中的存储类型", "path", path, "type", storageType)
+	if _, ok := os.LookupEnv("TEMPSHARE_STORAGE_TYPE"); ok {
+		slog.Warn("环境变量 TEMPSHARE_STORAGE_TYPE 会覆盖配置文件。" + hint)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// backend/notify.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxNotifyTargetLength 是 X-File-Notify 的最大长度
+	MaxNotifyTargetLength = 512
+	// notifyMailtoPrefix 标记邮件通知目标，其余目标都是 Webhook URL
+	notifyMailtoPrefix = "mailto:"
+	// notifyQueueSize 是等待发送的下载通知数量上限，队列满时丢弃新通知而不是阻塞下载
+	notifyQueueSize = 100
+)
+
+var errInvalidNotifyTarget = errors.New("无效的下载通知目标 (X-File-Notify)")
+
+// parseNotifyTarget 解析上传时提供的下载通知目标: http(s) Webhook URL 或邮箱地址 (可带 mailto: 前缀)。
+// 邮箱地址规范化为 "mailto:地址"；未启用下载通知时不接受任何目标，未配置 SMTP 时不接受邮箱地址。返回空字符串表示不通知
+func parseNotifyTarget(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if !AppConfig().DownloadNotify.Enabled || len(raw) > MaxNotifyTargetLength {
+		return "", errInvalidNotifyTarget
+	}
+	lower := strings.ToLower(raw)
+	if strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || u.User != nil {
+			return "", errInvalidNotifyTarget
+		}
+		return u.String(), nil
+	}
+	if !AppConfig().DownloadNotify.Enabled || AppConfig().SMTP.Host == "" {
+		return "", errInvalidNotifyTarget
+	}
+	if strings.HasPrefix(lower, notifyMailtoPrefix) {
+		raw = raw[len(notifyMailtoPrefix):]
+	}
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || addr.Name != "" {
+		return "", errInvalidNotifyTarget
+	}
+	return notifyMailtoPrefix + addr.Address, nil
+}
+
+// DownloadNotification 描述一次下载，作为 Webhook 的 JSON 请求体
+type DownloadNotification struct {
+	AccessCode   string    `json:"accessCode"`
+	Filename     string    `json:"filename"`
+	ClientIP     string    `json:"clientIp"`
+	DownloadedAt time.Time `json:"downloadedAt"`
+	target       string
+}
+
+// DownloadNotifier 在后台协程中把下载通知发送给上传者指定的 Webhook 或邮箱。
+// nil 表示未启用下载通知，此时 NotifyDownload 不做任何处理
+type DownloadNotifier struct {
+	db     *gorm.DB
+	client *http.Client
+	smtp   SMTPConfig
+	queue  chan DownloadNotification
+}
+
+// NewDownloadNotifier 根据配置创建下载通知发送器，未启用时返回 nil
+func NewDownloadNotifier(db *gorm.DB, config DownloadNotifyConfig, smtpConfig SMTPConfig) (*DownloadNotifier, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if smtpConfig.Host != "" {
+		if _, err := mail.ParseAddress(smtpConfig.From); err != nil {
+			return nil, fmt.Errorf("配置 SMTP.Host 时必须设置有效的 SMTP.From: %w", err)
+		}
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if !config.AllowPrivateTargets {
+		client.Transport = &http.Transport{DialContext: publicOnlyDialer().DialContext}
+		// 重定向同样经过受限的拨号器，这里只限制次数
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		}
+	}
+	n := &DownloadNotifier{
+		db:     db,
+		client: client,
+		smtp:   smtpConfig,
+		queue:  make(chan DownloadNotification, notifyQueueSize),
+	}
+	go n.run()
+	slog.Info("已启用下载通知", "smtp", smtpConfig.Host != "")
+	return n, nil
+}
+
+// publicOnlyDialer 拒绝连接回环、内网、链路本地等地址。Webhook URL 由上传者提供，
+// 不加限制时可以借服务器之手访问内网服务 (SSRF)。在建立连接时检查解析后的地址，DNS 重绑定也无法绕过
+func publicOnlyDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return fmt.Errorf("拒绝连接非公网地址 %s", host)
+			}
+			return nil
+		},
+	}
+}
+
+// NotifyDownload 在文件被下载时调用。未设置通知目标的文件直接返回；只通知首次下载的文件
+// 用条件更新 notified_at 保证并发下载时只发送一次。通知放入队列后立即返回，不会阻塞下载
+func (n *DownloadNotifier) NotifyDownload(file File, clientIP string) {
+	if n == nil || file.NotifyTarget == "" {
+		return
+	}
+	now := time.Now()
+	query := n.db.Model(&File{}).Where("id = ?", file.ID)
+	if !file.NotifyEvery {
+		query = query.Where("notified_at IS NULL")
+	}
+	result := query.Update("notified_at", now)
+	if result.Error != nil {
+		slog.Error("下载通知错误: 无法更新通知时间", "id", file.ID, "error", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	notification := DownloadNotification{
+		AccessCode:   file.AccessCode,
+		Filename:     file.Filename,
+		ClientIP:     clientIP,
+		DownloadedAt: now,
+		target:       file.NotifyTarget,
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		slog.Warn("下载通知队列已满，丢弃通知", "accessCode", file.AccessCode)
+	}
+}
+
+func (n *DownloadNotifier) run() {
+	for notification := range n.queue {
+		var err error
+		if strings.HasPrefix(notification.target, notifyMailtoPrefix) {
+			err = n.sendMail(notification)
+		} else {
+			err = n.sendWebhook(notification)
+		}
+		if err != nil {
+			slog.Error("发送下载通知失败", "accessCode", notification.AccessCode, "error", err)
+		}
+	}
+}
+
+func (n *DownloadNotifier) sendWebhook(notification DownloadNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notification.target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook 返回 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendMail 通过配置的 SMTP 服务器发送纯文本邮件。服务器支持 STARTTLS 时 net/smtp 会自动启用
+func (n *DownloadNotifier) sendMail(notification DownloadNotification) error {
+	to := strings.TrimPrefix(notification.target, notifyMailtoPrefix)
+	var auth smtp.Auth
+	if n.smtp.Username != "" {
+		auth = smtp.PlainAuth("", n.smtp.Username, n.smtp.Password, n.smtp.Host)
+	}
+	subject := fmt.Sprintf("[TempShare] 您分享的文件 %s 已被下载", notification.AccessCode)
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.smtp.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "分享码: %s\r\n文件名: %s\r\n客户端 IP: %s\r\n时间: %s\r\n",
+		notification.AccessCode, notification.Filename, notification.ClientIP, notification.DownloadedAt.Format(time.RFC3339))
+	addr := net.JoinHostPort(n.smtp.Host, strconv.Itoa(n.smtp.Port))
+	return smtp.SendMail(addr, auth, n.smtp.From, []string{to}, []byte(msg.String()))
+}
@@ -0,0 +1,143 @@
+// backend/password.go
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidPasswordHash 表示上传者提供的密码哈希既不是 bcrypt 也不是 argon2 格式
+var ErrInvalidPasswordHash = errors.New("无效的密码哈希，需要 bcrypt 或 argon2id 格式")
+
+// 上传者提供的密码哈希的参数上限。每次下载、预览或读取元信息时都要用这些参数重新计算哈希，
+// 不加限制时一个 m=4294967295 的 argon2id 或 cost=31 的 bcrypt 哈希就能耗尽服务器内存或 CPU
+const (
+	maxArgon2MemoryKB  = 256 * 1024
+	maxArgon2Time      = 10
+	maxArgon2Threads   = 16
+	minArgon2KeyLength = 16
+	maxArgon2KeyLength = 64
+	minBcryptCost      = 10
+	maxBcryptCost      = 14
+)
+
+// argon2Params 是 PHC 格式 argon2id 哈希中解析出的参数
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2Hash 解析形如 $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash> 的哈希
+func parseArgon2Hash(encoded string) (*argon2Params, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrInvalidPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrInvalidPasswordHash
+	}
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, ErrInvalidPasswordHash
+	}
+	if p.time == 0 || p.threads == 0 {
+		return nil, ErrInvalidPasswordHash
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrInvalidPasswordHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return nil, ErrInvalidPasswordHash
+	}
+	return p, nil
+}
+
+// ValidatePasswordHash 检查上传时提供的哈希是否为受支持的格式，且计算参数在上限之内 (见 maxArgon2MemoryKB 等)
+func ValidatePasswordHash(hash string) error {
+	if strings.HasPrefix(hash, "$argon2") {
+		p, err := parseArgon2Hash(hash)
+		if err != nil {
+			return err
+		}
+		if p.memory > maxArgon2MemoryKB || p.time > maxArgon2Time || p.threads > maxArgon2Threads ||
+			len(p.key) < minArgon2KeyLength || len(p.key) > maxArgon2KeyLength {
+			return ErrInvalidPasswordHash
+		}
+		return nil
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil || cost < minBcryptCost || cost > maxBcryptCost {
+		return ErrInvalidPasswordHash
+	}
+	return nil
+}
+
+// VerifyPassword 使用上传者提供的 bcrypt/argon2id 哈希校验明文密码。参数超出上限的哈希 (上限生效前保存的旧记录)
+// 一律校验失败，不会用这些参数计算哈希
+func VerifyPassword(hash, password string) bool {
+	return ValidatePasswordHash(hash) == nil && verifyHash(hash, password)
+}
+
+// verifyHash 按哈希中记录的参数校验明文，不检查参数上限，只用于服务器自己生成的哈希和已校验过的上传者哈希
+func verifyHash(hash, password string) bool {
+	if strings.HasPrefix(hash, "$argon2") {
+		p, err := parseArgon2Hash(hash)
+		if err != nil {
+			return false
+		}
+		key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		return subtle.ConstantTimeCompare(key, p.key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// verificationHashV1Prefix 标记服务器端再次哈希过的验证值: "v1:" + argon2id PHC 字符串。
+// 没有版本前缀的旧记录保存的是客户端提交的原始验证哈希。
+const verificationHashV1Prefix = "v1:"
+
+// HashVerificationToken 对客户端提交的验证哈希再做一次 argon2id 哈希后再入库，
+// 数据库泄露时无法直接用存储值通过验证，也难以离线爆破
+func HashVerificationToken(token string) (string, error) {
+	params := VerificationHashConfig{MemoryKB: 19 * 1024, Iterations: 2, Parallelism: 1}
+	if AppConfig() != nil && AppConfig().VerificationHash.MemoryKB > 0 && AppConfig().VerificationHash.Iterations > 0 && AppConfig().VerificationHash.Parallelism > 0 {
+		params = AppConfig().VerificationHash
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(token), salt, params.Iterations, params.MemoryKB, params.Parallelism, 32)
+	return fmt.Sprintf("%s$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", verificationHashV1Prefix, argon2.Version,
+		params.MemoryKB, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyVerificationToken 校验客户端提交的验证哈希。参数从存储值中读取，
+// 因此修改 VerificationHash 配置不影响已有记录；无版本前缀的旧记录按原值做常量时间比较
+func VerifyVerificationToken(stored, token string) bool {
+	if encoded, ok := strings.CutPrefix(stored, verificationHashV1Prefix); ok {
+		return verifyHash(encoded, token)
+	}
+	return secureCompare(stored, token)
+}
+
+// secureCompare 以常量时间比较两个字符串。subtle.ConstantTimeCompare 在长度不同时会立即返回，
+// 因此先对两边做 SHA-256，使比较耗时与输入长度是否一致无关
+func secureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
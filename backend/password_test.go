@@ -0,0 +1,150 @@
+// backend/password_test.go
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2Hash 按给定参数生成 PHC 格式的 argon2id 哈希，keyLen 为 0 时只拼接字符串而不计算 (用于超大参数)
+func argon2Hash(password string, memory, time uint32, threads uint8, keyLen int) string {
+	salt := []byte("0123456789abcdef")
+	key := make([]byte, keyLen)
+	if memory <= maxArgon2MemoryKB && time <= maxArgon2Time {
+		key = argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(keyLen))
+	}
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, time, threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// withBcryptCost 把 bcrypt 哈希中的 cost 字段替换为 cost，bcrypt.Cost 只解析前缀，无需真的以该 cost 计算
+func withBcryptCost(hash string, cost int) string {
+	return hash[:4] + fmt.Sprintf("%02d", cost) + hash[6:]
+}
+
+func TestParseArgon2Hash(t *testing.T) {
+	valid := argon2Hash("secret", 64, 1, 1, 32)
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"argon2i", strings.Replace(valid, "argon2id", "argon2i", 1), true},
+		{"wrong version", strings.Replace(valid, "v=19", "v=16", 1), true},
+		{"missing params", strings.Replace(valid, "m=64,t=1,p=1", "m=64", 1), true},
+		{"zero time", strings.Replace(valid, "t=1", "t=0", 1), true},
+		{"zero threads", strings.Replace(valid, "p=1", "p=0", 1), true},
+		{"bad salt", strings.Replace(valid, "$MDEy", "$!!!!", 1), true},
+		{"empty key", valid[:strings.LastIndex(valid, "$")+1], true},
+		{"too few parts", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseArgon2Hash(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgon2Hash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (p.memory != 64 || p.time != 1 || p.threads != 1 || len(p.key) != 32) {
+				t.Errorf("parseArgon2Hash() = %+v", p)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), minBcryptCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{"argon2id within bounds", argon2Hash("secret", 64, 1, 1, 32), false},
+		{"argon2id max bounds", argon2Hash("secret", maxArgon2MemoryKB, 1, maxArgon2Threads, maxArgon2KeyLength), false},
+		{"argon2id memory too large", argon2Hash("secret", 4294967295, 1, 1, 32), true},
+		{"argon2id memory just over", argon2Hash("secret", maxArgon2MemoryKB+1, 1, 1, 32), true},
+		{"argon2id time too large", argon2Hash("secret", 64, maxArgon2Time+1, 1, 32), true},
+		{"argon2id threads too large", argon2Hash("secret", 64, 1, maxArgon2Threads+1, 32), true},
+		{"argon2id key too short", argon2Hash("secret", 64, 1, 1, minArgon2KeyLength-1), true},
+		{"argon2id key too long", argon2Hash("secret", 64, 1, 1, maxArgon2KeyLength+1), true},
+		{"bcrypt min cost", string(bcryptHash), false},
+		{"bcrypt max cost", withBcryptCost(string(bcryptHash), maxBcryptCost), false},
+		{"bcrypt cost too low", withBcryptCost(string(bcryptHash), minBcryptCost-1), true},
+		{"bcrypt cost 31", withBcryptCost(string(bcryptHash), 31), true},
+		{"plaintext", "secret", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePasswordHash(tt.hash); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePasswordHash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hash := argon2Hash("secret", 64, 1, 1, 32)
+	if !VerifyPassword(hash, "secret") {
+		t.Error("VerifyPassword() rejected the correct password")
+	}
+	if VerifyPassword(hash, "wrong") {
+		t.Error("VerifyPassword() accepted a wrong password")
+	}
+	// 上限生效前保存的超大参数哈希直接校验失败，不会用这些参数计算
+	if VerifyPassword(argon2Hash("secret", 4294967295, 1, 1, 32), "secret") {
+		t.Error("VerifyPassword() accepted a hash with oversized parameters")
+	}
+}
+
+func TestVerifyVerificationTokenLegacy(t *testing.T) {
+	// 没有 v1: 前缀的旧记录保存的是客户端提交的原始验证哈希，按原值做常量时间比较
+	const stored = "3f2a9c7e1b"
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"equal", stored, true},
+		{"unequal", "3f2a9c7e1c", false},
+		{"shorter", stored[:len(stored)-1], false},
+		{"longer", stored + "0", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyVerificationToken(stored, tt.token); got != tt.want {
+				t.Errorf("VerifyVerificationToken(%q, %q) = %v, want %v", stored, tt.token, got, tt.want)
+			}
+			if got := secureCompare(stored, tt.token); got != tt.want {
+				t.Errorf("secureCompare(%q, %q) = %v, want %v", stored, tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamUploadRejectsOversizedPasswordHash(t *testing.T) {
+	withTestConfig(t, nil)
+	for _, hash := range []string{argon2Hash("secret", 4294967295, 1, 1, 32), "$2a$31$" + strings.Repeat("a", 53)} {
+		rec := httptest.NewRecorder()
+		c := newTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/uploads/stream-complete", strings.NewReader("hi"))
+		c.Request.Header.Set("X-File-Name", "a.txt")
+		c.Request.Header.Set("X-File-Original-Size", "2")
+		c.Request.Header.Set("X-File-Password-Hash", hash)
+		(&FileHandler{}).HandleStreamUpload(c)
+		want := messageCatalogs[defaultLanguage][msgInvalidPasswordHash]
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("hash %q: status = %d, body %s; want 400 with %q", hash, rec.Code, rec.Body, want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// backend/preview.go
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// officeMimeTypes 中的类型交给浏览器或 Office 在线查看器处理，预览时不设置 Content-Disposition
+var officeMimeTypes = map[string]string{
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// defaultPreviewMimeTypes 是 http.DetectContentType 容易识别错误的常见格式，可被 PreviewMimeTypes 配置覆盖
+var defaultPreviewMimeTypes = map[string]string{
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".ico":  "image/x-icon",
+	".md":   "text/markdown; charset=utf-8",
+	".txt":  "text/plain; charset=utf-8",
+	".log":  "text/plain; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".json": "application/json",
+	".yaml": "text/yaml; charset=utf-8",
+	".yml":  "text/yaml; charset=utf-8",
+	".xml":  "text/xml; charset=utf-8",
+	".css":  "text/css; charset=utf-8",
+	".js":   "text/javascript; charset=utf-8",
+	".pdf":  "application/pdf",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+}
+
+// previewMimeOverride 依次查找配置中的 PreviewMimeTypes 和内置默认表。
+// 配置的键可以带或不带前导点 (viper 会把键中的点当作层级分隔符，因此推荐不带点)。
+func previewMimeOverride(ext string) (string, bool) {
+	ext = strings.ToLower(ext)
+	if AppConfig() != nil {
+		for key, mime := range AppConfig().PreviewMimeTypes {
+			if "."+strings.TrimPrefix(strings.ToLower(key), ".") == ext && mime != "" {
+				return mime, true
+			}
+		}
+	}
+	mime, ok := defaultPreviewMimeTypes[ext]
+	return mime, ok
+}
+
+// genericContentTypes 是 http.DetectContentType 对多种格式共用的结果，例如 docx/xlsx/jar 都被识别为 zip，
+// json/csv/md 都被识别为纯文本，此时扩展名能给出更准确的类型
+var genericContentTypes = map[string]bool{
+	"application/octet-stream":  true,
+	"application/zip":           true,
+	"text/plain; charset=utf-8": true,
+}
+
+// detectContentType 在上传时根据文件头部内容检测 MIME 类型。嗅探结果过于笼统时 (见 genericContentTypes)，
+// 依次按扩展名查 Office 类型、预览覆盖表和系统 MIME 表，都没有则保留嗅探结果
+func detectContentType(filename string, head []byte) string {
+	contentType := http.DetectContentType(head)
+	if !genericContentTypes[contentType] {
+		return contentType
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if byExt, ok := officeMimeTypes[ext]; ok {
+		return byExt
+	}
+	if byExt, ok := previewMimeOverride(ext); ok {
+		return byExt
+	}
+	if byExt := mime.TypeByExtension(ext); byExt != "" {
+		return byExt
+	}
+	return contentType
+}
+
+// previewContentType 返回预览时使用的 Content-Type，以及是否需要设置 inline 的 Content-Disposition。
+// Office 文档不设置 Content-Disposition；其余格式先查覆盖表，再使用上传时保存的类型。
+// 旧记录没有保存类型，此时才对 head 做内容嗅探
+func previewContentType(file File, head []byte) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if mime, isOffice := officeMimeTypes[ext]; isOffice {
+		return mime, false
+	}
+	if mime, ok := previewMimeOverride(ext); ok {
+		return mime, true
+	}
+	if file.ContentType != "" {
+		return file.ContentType, true
+	}
+	return http.DetectContentType(head), true
+}
+
+// previewNeedsSandbox 报告该类型在同源内联显示时是否可能执行脚本 (SVG/HTML)，需要用 CSP 沙箱隔离
+func previewNeedsSandbox(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/svg+xml") || strings.HasPrefix(contentType, "text/html") ||
+		strings.HasPrefix(contentType, "application/xhtml+xml")
+}
+
+// inlineDownloadAllowed 报告下载接口能否按 ?disposition=inline 内联返回该类型。
+// 可能执行脚本的类型 (见 previewNeedsSandbox，以及可以嵌入 XHTML 的 XML) 始终以附件形式下载
+func inlineDownloadAllowed(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	if mediaType == "" || previewNeedsSandbox(mediaType) {
+		return false
+	}
+	return mediaType != "text/xml" && mediaType != "application/xml" && !strings.HasSuffix(mediaType, "+xml")
+}
+
+// previewRenderable 报告浏览器能否内联显示该类型。其他类型 (压缩包、可执行文件等) 内联预览没有意义，
+// 预览接口直接拒绝，避免把整个文件白白传输一遍
+func previewRenderable(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch {
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/pdf", mediaType == "application/json", mediaType == "application/xml":
+		return true
+	}
+	for _, office := range officeMimeTypes {
+		if mediaType == office {
+			return true
+		}
+	}
+	return false
+}
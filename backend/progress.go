@@ -0,0 +1,220 @@
+// backend/progress.go
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 上传会话的状态。上传结束 (无论成功或失败) 后会话立即被移除，查询返回 404，
+// 上传结果以上传请求本身的响应为准
+const (
+	UploadStatePending    = "pending"    // 已初始化，尚未开始上传
+	UploadStateUploading  = "uploading"  // 正在接收请求体
+	UploadStateProcessing = "processing" // 请求体已接收完毕，正在扫描或写入记录
+)
+
+// uploadSessionTTL 是上传会话在最后一次活动后保留的时间，超时后查询会返回 404
+const uploadSessionTTL = time.Hour
+
+// uploadSession 记录一次上传已接收的字节数和状态。received/lastActive 在读取请求体时频繁更新，
+// 使用原子变量避免每次 Read 都争用 UploadTracker 的锁；其余字段由 UploadTracker.mu 保护
+type uploadSession struct {
+	received   atomic.Int64
+	lastActive atomic.Int64 // UnixNano
+	id         string
+	expected   int64 // -1 表示未知
+	state      string
+}
+
+func (s *uploadSession) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+// UploadStatusResponse 是 GET /api/v1/uploads/:id/status 的响应体
+type UploadStatusResponse struct {
+	UploadID      string `json:"uploadId"`
+	State         string `json:"state"`
+	ReceivedBytes int64  `json:"receivedBytes"`
+	ExpectedBytes int64  `json:"expectedBytes"` // -1 表示未知
+}
+
+// UploadTracker 在内存中保存上传会话，供客户端轮询服务器已接收的字节数。
+// 会话只存在于当前进程，多实例部署时轮询请求需要落到同一实例上
+type UploadTracker struct {
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+	ttl      time.Duration
+}
+
+// NewUploadTracker 创建上传会话存储，并启动清理协程定期移除空闲超过 ttl 的会话
+func NewUploadTracker(ttl time.Duration) *UploadTracker {
+	t := &UploadTracker{
+		sessions: make(map[string]*uploadSession),
+		ttl:      ttl,
+	}
+	go t.janitor()
+	return t
+}
+
+func (t *UploadTracker) janitor() {
+	interval := t.ttl
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		t.mu.Lock()
+		for id, s := range t.sessions {
+			if now.Sub(time.Unix(0, s.lastActive.Load())) > t.ttl {
+				delete(t.sessions, id)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Create 创建一个新的上传会话并返回其 ID，expected 为客户端预告的总字节数 (<=0 表示未知)
+func (t *UploadTracker) Create(expected int64) string {
+	if expected <= 0 {
+		expected = -1
+	}
+	id := uuid.NewString()
+	s := &uploadSession{id: id, expected: expected, state: UploadStatePending}
+	s.touch()
+
+	t.mu.Lock()
+	t.sessions[id] = s
+	t.mu.Unlock()
+	return id
+}
+
+// Begin 将会话切换为上传中并返回包装后的请求体，读取时会累加已接收字节数。
+// 会话不存在、已过期或已被使用过时返回 false，同一个 ID 不能用于多次上传
+func (t *UploadTracker) Begin(id string, body io.ReadCloser, contentLength int64) (*uploadSession, io.ReadCloser, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[id]
+	if !ok || s.state != UploadStatePending {
+		return nil, nil, false
+	}
+	s.state = UploadStateUploading
+	if s.expected < 0 && contentLength > 0 {
+		s.expected = contentLength
+	}
+	s.touch()
+	return s, &progressReader{r: body, tracker: t, session: s}, true
+}
+
+// Finish 在上传结束后移除会话，之后的状态查询返回 404。session 为 nil 时不做任何处理
+func (t *UploadTracker) Finish(s *uploadSession) {
+	if s == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sessions, s.id)
+}
+
+// Status 返回会话的当前进度
+func (t *UploadTracker) Status(id string) (UploadStatusResponse, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[id]
+	if !ok {
+		return UploadStatusResponse{}, false
+	}
+	return UploadStatusResponse{
+		UploadID:      id,
+		State:         s.state,
+		ReceivedBytes: s.received.Load(),
+		ExpectedBytes: s.expected,
+	}, true
+}
+
+// markProcessing 在请求体读取完毕后调用，只有仍处于上传中的会话会被切换
+func (t *UploadTracker) markProcessing(s *uploadSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s.state == UploadStateUploading {
+		s.state = UploadStateProcessing
+	}
+}
+
+// progressReader 统计经过的字节数并写入上传会话
+type progressReader struct {
+	r       io.ReadCloser
+	tracker *UploadTracker
+	session *uploadSession
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.session.received.Add(int64(n))
+		p.session.touch()
+	}
+	if err == io.EOF {
+		p.tracker.markProcessing(p.session)
+	}
+	return n, err
+}
+
+func (p *progressReader) Close() error {
+	return p.r.Close()
+}
+
+// beginTrackedUpload 在请求带有 X-Upload-ID 时开始跟踪进度，返回应读取的请求体。
+// 未带该头时返回 nil 会话和原始请求体；ID 无效时写入 404 响应并返回 false
+func (h *FileHandler) beginTrackedUpload(c *gin.Context) (*uploadSession, io.ReadCloser, bool) {
+	uploadID := c.GetHeader("X-Upload-ID")
+	if uploadID == "" {
+		return nil, c.Request.Body, true
+	}
+	session, body, ok := h.Uploads.Begin(uploadID, c.Request.Body, c.Request.ContentLength)
+	if !ok {
+		respondError(c, http.StatusNotFound, ErrCodeUploadNotFound, translate(c, msgUploadNotFound))
+		return nil, nil, false
+	}
+	return session, body, true
+}
+
+type initUploadPayload struct {
+	ExpectedBytes int64 `json:"expectedBytes"`
+}
+
+// HandleInitUpload 创建上传会话并返回 uploadId，客户端随后在上传请求中通过 X-Upload-ID 头传入，
+// 并可轮询 /api/v1/uploads/:id/status 查询进度。请求体可选，可预告总字节数
+func (h *FileHandler) HandleInitUpload(c *gin.Context) {
+	var payload initUploadPayload
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidUploadInit))
+			return
+		}
+	}
+	uploadID := h.Uploads.Create(payload.ExpectedBytes)
+	requestLogger(c).Debug("创建上传会话", "uploadId", uploadID, "expectedBytes", payload.ExpectedBytes, "clientIP", c.ClientIP())
+	c.JSON(http.StatusCreated, gin.H{"uploadId": uploadID, "expiresInSeconds": int64(h.Uploads.ttl.Seconds())})
+}
+
+// HandleGetUploadStatus 返回进行中的上传会话已接收的字节数和状态。
+// 未知、已过期和已结束 (成功或失败) 的会话都返回 404 UPLOAD_NOT_FOUND
+func (h *FileHandler) HandleGetUploadStatus(c *gin.Context) {
+	status, ok := h.Uploads.Status(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, ErrCodeUploadNotFound, translate(c, msgUploadNotFound))
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
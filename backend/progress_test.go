@@ -0,0 +1,51 @@
+// backend/progress_test.go
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func uploadStatusCode(t *testing.T, h *FileHandler, id string) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c := newTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/uploads/"+id+"/status", nil)
+	c.Params = gin.Params{{Key: "id", Value: id}}
+	h.HandleGetUploadStatus(c)
+	return rec.Code
+}
+
+func TestUploadStatusLifecycle(t *testing.T) {
+	h := &FileHandler{Uploads: NewUploadTracker(uploadSessionTTL)}
+	id := h.Uploads.Create(5)
+	if code := uploadStatusCode(t, h, id); code != http.StatusOK {
+		t.Fatalf("pending session: status = %d, want 200", code)
+	}
+
+	session, body, ok := h.Uploads.Begin(id, io.NopCloser(strings.NewReader("hello")), 5)
+	if !ok {
+		t.Fatal("Begin() rejected a pending session")
+	}
+	io.ReadAll(body)
+	status, _ := h.Uploads.Status(id)
+	if status.State != UploadStateProcessing || status.ReceivedBytes != 5 || status.ExpectedBytes != 5 {
+		t.Errorf("Status() = %+v", status)
+	}
+
+	h.Uploads.Finish(session)
+	if code := uploadStatusCode(t, h, id); code != http.StatusNotFound {
+		t.Errorf("finished session: status = %d, want 404", code)
+	}
+	if _, _, ok := h.Uploads.Begin(id, io.NopCloser(strings.NewReader("")), 0); ok {
+		t.Error("Begin() accepted a finished session")
+	}
+	if code := uploadStatusCode(t, h, "unknown"); code != http.StatusNotFound {
+		t.Errorf("unknown session: status = %d, want 404", code)
+	}
+}
@@ -0,0 +1,206 @@
+// backend/public.go
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPublicPageSize = 20
+	maxPublicPageSize     = 100
+	// maxSearchQueryLength 限制搜索词长度，过长的模式匹配没有意义且浪费数据库资源
+	maxSearchQueryLength = 100
+	// maxFeaturedFiles 是公开列表第一页最多附带的置顶文件数，置顶文件不占用 pageSize
+	maxFeaturedFiles = 20
+)
+
+// publicFileColumns 是公开列表中返回的字段
+var publicFileColumns = []string{"access_code", "filename", "size_bytes", "original_size_bytes", "compressed", "expires_at", "created_at", "is_encrypted", "is_featured", "description"}
+
+// publicFiles 限定为可以公开展示的文件: 上传者选择公开 (旧记录 is_public 为 NULL，视为公开)、未过期、未加密、
+// 非阅后即焚、无密码保护、未被检测为感染且未被举报下架。即使上传时设置了 X-File-Public，后面这些条件仍然生效
+func publicFiles(db *gorm.DB) *gorm.DB {
+	return db.Model(&File{}).
+		Where("is_public = true OR is_public IS NULL").
+		Where("expires_at > ? AND is_encrypted = false AND download_once = false AND burn_on_view = false AND password_protected = false", time.Now()).
+		Where("scan_status <> ? AND quarantined = false", ScanStatusInfected)
+}
+
+// parsePage 解析 page 和 pageSize 查询参数，非法值回退到默认值，pageSize 不超过 maxPublicPageSize
+func parsePage(c *gin.Context) (page, pageSize int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err = strconv.Atoi(c.Query("pageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPublicPageSize
+	}
+	if pageSize > maxPublicPageSize {
+		pageSize = maxPublicPageSize
+	}
+	return page, pageSize
+}
+
+// writePage 按分页查询 query 并返回文件数组，pinned 中的文件排在最前且不计入分页。为兼容旧客户端，响应体仍是数组，
+// 总数和是否还有下一页通过 X-Total-Count / X-Has-More / X-Page / X-Page-Size 响应头返回
+func writePage(c *gin.Context, query *gorm.DB, pinned []File) {
+	page, pageSize := parsePage(c)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		requestLogger(c).Error("查询公开文件列表失败", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgPublicListFailed))
+		return
+	}
+	files := []File{}
+	if err := query.Select(publicFileColumns).Order("created_at desc").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&files).Error; err != nil {
+		requestLogger(c).Error("查询公开文件列表失败", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgPublicListFailed))
+		return
+	}
+	if len(pinned) > 0 {
+		files = append(pinned, files...)
+	}
+	for i := range files {
+		files[i].SizeBytes = files[i].contentLength()
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.Header("X-Has-More", strconv.FormatBool(int64(page*pageSize) < total))
+	c.Header("X-Page", strconv.Itoa(page))
+	c.Header("X-Page-Size", strconv.Itoa(pageSize))
+	c.JSON(http.StatusOK, files)
+}
+
+// HandleGetPublicFiles 返回公开文件列表，支持 page/pageSize 分页，默认为最新的 20 个。
+// 第一页先按 FeaturedOrder 列出置顶文件 (最多 maxFeaturedFiles 个，数量见 X-Featured-Count)，再列出最新的非置顶文件；
+// 分页和 X-Total-Count 只统计非置顶文件。format=csv 时忽略分页，以 CSV 流式导出全部公开文件，便于运维盘点
+func (h *FileHandler) HandleGetPublicFiles(c *gin.Context) {
+	if c.Query("format") == "csv" {
+		h.exportPublicFilesCSV(c)
+		return
+	}
+	var featured []File
+	if page, _ := parsePage(c); page == 1 {
+		err := publicFiles(h.db(c.Request.Context())).Where("is_featured = true").Select(publicFileColumns).
+			Order("featured_order asc").Order("created_at desc").Limit(maxFeaturedFiles).Find(&featured).Error
+		if err != nil {
+			requestLogger(c).Error("查询置顶文件失败", "error", err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgPublicListFailed))
+			return
+		}
+	}
+	c.Header("X-Featured-Count", strconv.Itoa(len(featured)))
+	writePage(c, publicFiles(h.db(c.Request.Context())).Where("is_featured = false"), featured)
+}
+
+// exportPublicFilesCSV 逐行读取数据库并写出 CSV，不在内存中缓存整个列表
+func (h *FileHandler) exportPublicFilesCSV(c *gin.Context) {
+	rows, err := publicFiles(h.db(c.Request.Context())).Select(publicFileColumns).Order("created_at desc").Rows()
+	if err != nil {
+		requestLogger(c).Error("导出公开文件列表失败", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, translate(c, msgPublicListFailed))
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="tempshare-public-files.csv"`)
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"accessCode", "filename", "sizeBytes", "createdAt", "expiresAt"})
+	var count int
+	for rows.Next() {
+		var file File
+		if err := h.DB.ScanRows(rows, &file); err != nil {
+			requestLogger(c).Error("导出公开文件列表失败: 读取行出错", "error", err)
+			break
+		}
+		w.Write([]string{
+			file.AccessCode,
+			csvSafe(file.Filename),
+			strconv.FormatInt(file.contentLength(), 10),
+			file.CreatedAt.UTC().Format(time.RFC3339),
+			file.ExpiresAt.UTC().Format(time.RFC3339),
+		})
+		// 定期刷新，让数据边查询边发送
+		if count++; count%100 == 0 {
+			w.Flush()
+		}
+	}
+	w.Flush()
+	requestLogger(c).Info("已导出公开文件列表", "clientIP", c.ClientIP(), "count", count)
+}
+
+// csvSafe 防止以 = + - @ 开头的文件名在电子表格中被当作公式执行
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@') {
+		return "'" + value
+	}
+	return value
+}
+
+// likeEscaper 转义 LIKE 模式中的通配符，使用户输入按字面匹配。
+// 使用 ! 作为转义符: 反斜杠在 MySQL 字符串字面量中本身需要转义，而在 PostgreSQL 中不需要，无法统一
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// HandleSearchPublicFiles 按文件名对公开文件做不区分大小写的子串匹配，分页方式与公开列表相同。
+// 子串匹配 (LIKE '%q%') 无法使用 filename 上的索引，会扫描所有公开文件；
+// 临时分享的文件数量通常不大，这里选择更符合直觉的子串匹配而非前缀匹配
+func (h *FileHandler) HandleSearchPublicFiles(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxSearchQueryLength {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidSearchQuery, maxSearchQueryLength))
+		return
+	}
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(q)) + "%"
+	writePage(c, publicFiles(h.db(c.Request.Context())).Where("LOWER(filename) LIKE ? ESCAPE '!'", pattern), nil)
+}
+
+// runFeature 实现 `tempshare feature CODE [--order N] [--off]`: 置顶或取消置顶公开列表中的文件。
+// 置顶文件仍需满足公开条件 (见 publicFiles)，过期或被下架后自动从列表中消失
+func runFeature(args []string) error {
+	fs := flag.NewFlagSet("feature", flag.ExitOnError)
+	order := fs.Int("order", 0, "置顶顺序，数值小的排在前面")
+	off := fs.Bool("off", false, "取消置顶")
+	// 分享码前后都可以带参数: flag 包在第一个非参数处停止解析，因此取出分享码后再解析一次
+	fs.Parse(args)
+	code := fs.Arg(0)
+	if fs.NArg() > 0 {
+		fs.Parse(fs.Args()[1:])
+	}
+	if code == "" || fs.NArg() != 0 {
+		return errors.New("用法: tempshare feature <分享码> [--order N] [--off]")
+	}
+
+	db, err := ConnectDatabase(AppConfig().Database)
+	if err != nil {
+		return fmt.Errorf("数据库初始化失败: %w", err)
+	}
+	result := db.Model(&File{}).Where("access_code = ?", code).
+		Updates(map[string]interface{}{"is_featured": !*off, "featured_order": *order})
+	if result.Error != nil {
+		return fmt.Errorf("更新置顶状态失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("分享码不存在: " + code)
+	}
+	var file File
+	if err := publicFiles(db).Where("access_code = ?", code).Select("id").First(&file).Error; err != nil && !*off {
+		slog.Warn("该文件当前不满足公开条件，置顶后也不会出现在公开列表中", "accessCode", code)
+	}
+	slog.Info("已更新置顶状态", "accessCode", code, "featured", !*off, "order", *order)
+	return nil
+}
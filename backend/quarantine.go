@@ -0,0 +1,76 @@
+// backend/quarantine.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// quarantinePrefix 是被感染文件在存储后端中的隔离前缀，隔离后的对象不会再被正常下载或预览
+const quarantinePrefix = "quarantine/"
+
+// quarantineKey 返回给定存储键在隔离区中的对应键
+func quarantineKey(key string) string {
+	if strings.HasPrefix(key, quarantinePrefix) {
+		return key
+	}
+	return quarantinePrefix + key
+}
+
+// quarantineExpiry 根据 QuarantineDeleteAfterHours 计算被感染文件的过期时间。
+// 未配置宽限期时保持原过期时间不变。
+func quarantineExpiry(expiresAt time.Time) time.Time {
+	if AppConfig().QuarantineDeleteAfterHours <= 0 {
+		return expiresAt
+	}
+	deadline := time.Now().Add(time.Duration(AppConfig().QuarantineDeleteAfterHours) * time.Hour)
+	if deadline.Before(expiresAt) {
+		return deadline
+	}
+	return expiresAt
+}
+
+// moveToQuarantine 将存储对象复制到隔离区并删除原对象，返回隔离后的存储键
+func moveToQuarantine(ctx context.Context, storage FileStorage, key string) (string, error) {
+	newKey := quarantineKey(key)
+	if newKey == key {
+		return key, nil
+	}
+	reader, err := storage.Retrieve(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("读取待隔离文件失败: %w", err)
+	}
+	_, err = storage.Save(ctx, newKey, reader)
+	reader.Close()
+	if err != nil {
+		storage.Delete(ctx, newKey)
+		return "", fmt.Errorf("写入隔离区失败: %w", err)
+	}
+	if err := storage.Delete(ctx, key); err != nil {
+		loggerFromContext(ctx).Error("隔离错误: 删除原存储对象失败", "key", key, "error", err)
+	}
+	return newKey, nil
+}
+
+// QuarantineFile 将已存储的被感染文件移动到隔离区，并更新数据库中的存储键和过期时间
+func QuarantineFile(ctx context.Context, db *gorm.DB, storage FileStorage, file File) error {
+	newKey, err := moveToQuarantine(ctx, storage, file.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	err = db.Model(&File{}).Where("id = ?", file.ID).Updates(map[string]interface{}{
+		"storage_key": newKey,
+		"expires_at":  quarantineExpiry(file.ExpiresAt),
+	}).Error
+	fileCache.Invalidate(file.AccessCode)
+	if err != nil {
+		return fmt.Errorf("更新隔离文件记录失败: %w", err)
+	}
+	loggerFromContext(ctx).Warn("被感染文件已移入隔离区", "accessCode", file.AccessCode, "key", newKey)
+	return nil
+}
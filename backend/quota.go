@@ -0,0 +1,247 @@
+// backend/quota.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrQuotaExceeded 表示存储总量已达到配置的上限
+var ErrQuotaExceeded = errors.New("存储空间已满")
+
+// ErrFileLimitReached 表示未过期文件的数量已达到 MaxActiveFiles
+var ErrFileLimitReached = errors.New("文件数量已达到上限")
+
+// activeFilesRecountInterval 是重新统计未过期文件数量的最短间隔。两次统计之间按上传增量计数，
+// 期间过期或被提前删除的文件最多延迟这么久才会让出名额
+const activeFilesRecountInterval = 30 * time.Second
+
+// maxQuotaRetryAfter 是配额不足时建议客户端等待时间的上限。文件也可能被提前删除，等待过久没有意义
+const maxQuotaRetryAfter = time.Hour
+
+// StorageQuota 跟踪当前已存储文件的总字节数，并在超出上限时拒绝或淘汰旧文件；
+// 同时跟踪未过期文件的数量，供 MaxActiveFiles 限制和 /metrics 使用
+type StorageQuota struct {
+	mu          sync.Mutex
+	db          *gorm.DB
+	storage     FileStorage
+	maxBytes    int64 // 0 表示不限制
+	evictOldest bool
+	usedBytes   int64
+	activeFiles int64
+	countedAt   time.Time
+	evicting    map[string]struct{} // 已选为淘汰对象但尚未删除的文件 ID，并发的 Reserve 不会重复选中
+}
+
+// NewStorageQuota 创建配额管理器，并从数据库重新计算当前的存储总量
+func NewStorageQuota(db *gorm.DB, storage FileStorage, maxTotalGB int64, evictOldest bool) (*StorageQuota, error) {
+	q := &StorageQuota{
+		db:          db,
+		storage:     storage,
+		maxBytes:    maxTotalGB * 1024 * 1024 * 1024,
+		evictOldest: evictOldest,
+		evicting:    make(map[string]struct{}),
+	}
+	if err := q.Recompute(); err != nil {
+		return nil, err
+	}
+	if q.maxBytes > 0 {
+		slog.Info("已启用存储总量限制", "maxTotalStorageGB", maxTotalGB, "usedBytes", q.usedBytes, "evictOldest", evictOldest)
+	}
+	return q, nil
+}
+
+// Recompute 从数据库中汇总 SizeBytes，修正内存中的计数
+func (q *StorageQuota) Recompute() error {
+	var total int64
+	if err := q.db.Model(&File{}).Select("COALESCE(SUM(size_bytes), 0)").Scan(&total).Error; err != nil {
+		return fmt.Errorf("无法统计已用存储空间: %w", err)
+	}
+	q.mu.Lock()
+	q.usedBytes = total
+	err := q.countFilesLocked()
+	q.mu.Unlock()
+	return err
+}
+
+// countFilesLocked 从数据库统计未过期的文件数量 (expires_at 有索引)。调用方需持有锁
+func (q *StorageQuota) countFilesLocked() error {
+	var count int64
+	if err := q.db.Model(&File{}).Where("expires_at > ?", time.Now()).Count(&count).Error; err != nil {
+		return fmt.Errorf("无法统计未过期文件数量: %w", err)
+	}
+	q.activeFiles = count
+	q.countedAt = time.Now()
+	return nil
+}
+
+// ReserveFile 为新上传占用一个文件名额，未过期文件已达到 MaxActiveFiles 时返回 ErrFileLimitReached。
+// 上传失败时需调用 ReleaseFile 归还名额
+func (q *StorageQuota) ReserveFile() error {
+	maxFiles := int64(AppConfig().MaxActiveFiles)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if time.Since(q.countedAt) >= activeFilesRecountInterval {
+		if err := q.countFilesLocked(); err != nil {
+			return err
+		}
+	}
+	if maxFiles > 0 && q.activeFiles >= maxFiles {
+		return ErrFileLimitReached
+	}
+	q.activeFiles++
+	return nil
+}
+
+// ReleaseFile 归还 ReserveFile 占用但最终没有创建记录的名额
+func (q *StorageQuota) ReleaseFile() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.activeFiles > 0 {
+		q.activeFiles--
+	}
+}
+
+// ActiveFiles 返回当前未过期文件的数量，统计结果过旧时先重新统计
+func (q *StorageQuota) ActiveFiles() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if time.Since(q.countedAt) >= activeFilesRecountInterval {
+		if err := q.countFilesLocked(); err != nil {
+			slog.Error("统计未过期文件数量失败", "error", err)
+		}
+	}
+	return q.activeFiles
+}
+
+// RetryAfter 估计配额最早何时释放 (fileLimit 为 true 时指 MaxActiveFiles 名额，否则指存储空间):
+// 最早过期的文件过期后，文件名额在下一次重新统计时让出，存储空间则要等清理任务删除文件后才归还。
+// 结果不超过 maxQuotaRetryAfter，查询失败或没有未过期文件时也返回该上限
+func (q *StorageQuota) RetryAfter(fileLimit bool) time.Duration {
+	var earliest File
+	if err := q.db.Select("expires_at").Where("expires_at > ?", time.Now()).Order("expires_at").Take(&earliest).Error; err != nil {
+		return maxQuotaRetryAfter
+	}
+	lag := cleanupInterval
+	if fileLimit {
+		lag = activeFilesRecountInterval
+	}
+	return min(time.Until(earliest.ExpiresAt)+lag, maxQuotaRetryAfter)
+}
+
+// Reserve 为新文件占用 size 字节。空间不足时，若启用了 EvictOldest 则先淘汰最旧的文件，
+// 否则返回 ErrQuotaExceeded。
+// 淘汰对象在持有锁时选出并立即从已用空间中扣除，存储对象和数据库记录在释放锁之后删除，
+// 删除过程不会阻塞其他上传的配额检查
+func (q *StorageQuota) Reserve(size int64) error {
+	q.mu.Lock()
+	var victims []File
+	if q.maxBytes > 0 && q.usedBytes+size > q.maxBytes {
+		if size > q.maxBytes || !q.evictOldest {
+			q.mu.Unlock()
+			return ErrQuotaExceeded
+		}
+		var err error
+		if victims, err = q.pickVictimsLocked(q.usedBytes + size - q.maxBytes); err != nil {
+			q.mu.Unlock()
+			return err
+		}
+	}
+	q.usedBytes += size
+	q.mu.Unlock()
+
+	for _, file := range victims {
+		q.evict(file)
+	}
+	return nil
+}
+
+// Adjust 把预先按上限占用的 reserved 字节修正为实际写入的 actual 字节。
+// 实际大小超出预留时 (例如压缩后反而变大) 按 Reserve 的规则占用差额，失败时原预留保持不变
+func (q *StorageQuota) Adjust(reserved, actual int64) error {
+	if actual > reserved {
+		return q.Reserve(actual - reserved)
+	}
+	q.Release(reserved - actual)
+	return nil
+}
+
+// Release 在文件被删除后归还其占用的空间
+func (q *StorageQuota) Release(size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.usedBytes -= size
+	if q.usedBytes < 0 {
+		q.usedBytes = 0
+	}
+}
+
+// pickVictimsLocked 按创建时间从旧到新选出非阅后即焚的文件，直到能释放至少 needed 字节。
+// 选中的文件记入 evicting 并从 usedBytes 中扣除，由调用方在释放锁后调用 evict 删除。调用方需持有锁。
+func (q *StorageQuota) pickVictimsLocked(needed int64) ([]File, error) {
+	const batchSize = 50
+	var victims []File
+	var freed int64
+	picked := make([]string, 0, len(q.evicting))
+	for id := range q.evicting {
+		picked = append(picked, id)
+	}
+
+	for freed < needed {
+		var candidates []File
+		query := q.db.Select("id", "storage_key", "access_code", "size_bytes").Where("download_once = ?", false)
+		if len(picked) > 0 {
+			query = query.Where("id NOT IN ?", picked)
+		}
+		if err := query.Order("created_at asc").Limit(batchSize).Find(&candidates).Error; err != nil {
+			return nil, fmt.Errorf("查询待淘汰文件失败: %w", err)
+		}
+		if len(candidates) == 0 {
+			return nil, ErrQuotaExceeded
+		}
+		for _, file := range candidates {
+			victims = append(victims, file)
+			picked = append(picked, file.ID)
+			freed += file.SizeBytes
+			if freed >= needed {
+				break
+			}
+		}
+	}
+
+	for _, file := range victims {
+		q.evicting[file.ID] = struct{}{}
+	}
+	q.usedBytes -= freed
+	return victims, nil
+}
+
+// evict 删除 pickVictimsLocked 选出的文件，调用时不持有锁。
+// 记录已被并发的清理删除 (清理时已释放过配额) 或删除失败时，把预先扣除的空间加回来
+func (q *StorageQuota) evict(file File) {
+	if err := q.storage.Delete(context.Background(), file.StorageKey); err != nil {
+		slog.Error("淘汰错误: 删除存储对象失败", "key", file.StorageKey, "error", err)
+	}
+	result := q.db.Delete(&File{}, "id = ?", file.ID)
+	fileCache.Invalidate(file.AccessCode)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.evicting, file.ID)
+	if result.Error != nil {
+		slog.Error("淘汰错误: 删除文件记录失败", "id", file.ID, "error", result.Error)
+		q.usedBytes += file.SizeBytes
+		return
+	}
+	if result.RowsAffected == 0 {
+		q.usedBytes += file.SizeBytes
+		return
+	}
+	slog.Info("存储空间不足，已淘汰最旧文件", "accessCode", file.AccessCode, "sizeBytes", file.SizeBytes)
+}
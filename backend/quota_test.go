@@ -0,0 +1,130 @@
+// backend/quota_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStorageQuotaReserveRelease(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		used     int64
+		reserve  int64
+		wantErr  error
+		wantUsed int64
+	}{
+		{"unlimited", 0, 500, 1000, nil, 1500},
+		{"fits", 1000, 400, 600, nil, 1000},
+		{"exceeds", 1000, 401, 600, ErrQuotaExceeded, 401},
+		{"larger than limit", 1000, 0, 1001, ErrQuotaExceeded, 0},
+		{"zero bytes", 1000, 1000, 0, nil, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &StorageQuota{maxBytes: tt.maxBytes, usedBytes: tt.used}
+			if err := q.Reserve(tt.reserve); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve(%d) = %v, want %v", tt.reserve, err, tt.wantErr)
+			}
+			if q.usedBytes != tt.wantUsed {
+				t.Fatalf("usedBytes = %d, want %d", q.usedBytes, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestStorageQuotaReleaseClampsAtZero(t *testing.T) {
+	q := &StorageQuota{usedBytes: 100}
+	q.Release(40)
+	if q.usedBytes != 60 {
+		t.Fatalf("usedBytes = %d, want 60", q.usedBytes)
+	}
+	q.Release(100)
+	if q.usedBytes != 0 {
+		t.Fatalf("usedBytes = %d, want 0", q.usedBytes)
+	}
+}
+
+func TestStorageQuotaAdjust(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved int64
+		actual   int64
+		wantErr  error
+		wantUsed int64
+	}{
+		{"smaller than reserved", 500, 200, nil, 200},
+		{"equal", 500, 500, nil, 500},
+		{"grows within limit", 500, 800, nil, 800},
+		{"grows past limit", 500, 1200, ErrQuotaExceeded, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &StorageQuota{maxBytes: 1000}
+			if err := q.Reserve(tt.reserved); err != nil {
+				t.Fatalf("Reserve: %v", err)
+			}
+			if err := q.Adjust(tt.reserved, tt.actual); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Adjust(%d, %d) = %v, want %v", tt.reserved, tt.actual, err, tt.wantErr)
+			}
+			if q.usedBytes != tt.wantUsed {
+				t.Fatalf("usedBytes = %d, want %d", q.usedBytes, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestStorageQuotaEvictsOldest(t *testing.T) {
+	db := newTestDB(t, &File{})
+	storage, err := NewLocalStorage(StorageConfig{LocalPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	now := time.Now()
+	files := []File{
+		{ID: "oldest", AccessCode: "AAAAAA", SizeBytes: 300, CreatedAt: now.Add(-3 * time.Hour)},
+		{ID: "once", AccessCode: "BBBBBB", SizeBytes: 300, CreatedAt: now.Add(-2 * time.Hour), DownloadOnce: true},
+		{ID: "newer", AccessCode: "CCCCCC", SizeBytes: 300, CreatedAt: now.Add(-time.Hour)},
+	}
+	for i := range files {
+		files[i].StorageKey = files[i].ID
+		files[i].ExpiresAt = now.Add(time.Hour)
+		if _, err := storage.Save(context.Background(), files[i].StorageKey, strings.NewReader("data")); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if err := db.Create(&files[i]).Error; err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	q := &StorageQuota{db: db, storage: storage, maxBytes: 1000, evictOldest: true, usedBytes: 900, evicting: make(map[string]struct{})}
+	if err := q.Reserve(200); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if q.usedBytes != 800 {
+		t.Fatalf("usedBytes = %d, want 800", q.usedBytes)
+	}
+	if len(q.evicting) != 0 {
+		t.Fatalf("evicting 未清空: %v", q.evicting)
+	}
+	var remaining []string
+	db.Model(&File{}).Order("created_at").Pluck("id", &remaining)
+	if strings.Join(remaining, ",") != "once,newer" {
+		t.Fatalf("剩余文件 = %v, want [once newer]", remaining)
+	}
+	if storage.Exists("oldest") {
+		t.Fatal("被淘汰文件的存储对象没有删除")
+	}
+
+	// 只剩阅后即焚文件和无法释放足够空间时拒绝，配额不变
+	if err := q.Reserve(600); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Reserve(600) = %v, want ErrQuotaExceeded", err)
+	}
+	if q.usedBytes != 800 {
+		t.Fatalf("usedBytes = %d, want 800", q.usedBytes)
+	}
+}
@@ -0,0 +1,164 @@
+// backend/reload.go
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reloadableConfigKeys 是收到 SIGHUP 后无需重启即可生效的顶层配置项 (mapstructure 键)。
+// 其余配置项 (存储、数据库、端口等) 在启动时用于构建依赖，修改后需要重启服务
+var reloadableConfigKeys = map[string]bool{
+	"RateLimit":                     true,
+	"CORS_ALLOWED_ORIGINS":          true,
+	"CORS_UPLOAD_ALLOWED_ORIGINS":   true,
+	"CORS_PUBLIC_ALLOWED_ORIGINS":   true,
+	"CORS_PUBLIC_ALLOW_CREDENTIALS": true,
+	"CORS_MAX_AGE_MINUTES":          true,
+	"MaxUploadSizeMB":               true,
+	"MaxBatchFiles":                 true,
+	"MaxDescriptionLength":          true,
+	"MaxActiveFiles":                true,
+	"RequestTimeoutSeconds":         true,
+	"DefaultExpiryHours":            true,
+	"ExpiryPresets":                 true,
+	"StrictExpiryPresets":           true,
+	"AccessControl":                 true,
+	"ExpiredCodeResponse":           true,
+	"MaintenanceMode":               true,
+	"LogLevel":                      true,
+	"IntegrityCheck":                true,
+	"E2EE":                          true,
+}
+
+// swappableHandler 是可以在运行时原子替换的中间件，正在处理的请求继续使用替换前的版本
+type swappableHandler struct {
+	handler atomic.Pointer[gin.HandlerFunc]
+}
+
+func newSwappableHandler(h gin.HandlerFunc) *swappableHandler {
+	s := &swappableHandler{}
+	s.Store(h)
+	return s
+}
+
+func (s *swappableHandler) Store(h gin.HandlerFunc) {
+	s.handler.Store(&h)
+}
+
+func (s *swappableHandler) Handle(c *gin.Context) {
+	(*s.handler.Load())(c)
+}
+
+// accessControlHandlers 根据配置返回上传/举报接口和下载接口使用的 IP 访问控制中间件，未启用时直接放行
+func accessControlHandlers(config AccessControlConfig) (uploads, downloads gin.HandlerFunc, err error) {
+	accessControl, err := NewIPAccessControl(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	pass := func(c *gin.Context) { c.Next() }
+	if !accessControl.Enabled() {
+		return pass, pass, nil
+	}
+	slog.Info("已启用 IP 访问控制", "allowCIDRs", config.AllowCIDRs, "denyCIDRs", config.DenyCIDRs, "applyToDownloads", config.ApplyToDownloads)
+	uploads = accessControl.AccessControlMiddleware()
+	downloads = pass
+	if config.ApplyToDownloads {
+		downloads = uploads
+	}
+	return uploads, downloads, nil
+}
+
+// ConfigReloader 在收到 SIGHUP 时重新读取配置文件，只应用 reloadableConfigKeys 中的配置项
+type ConfigReloader struct {
+	path           string
+	rateLimits     *RateLimitGroups
+	cors           *swappableHandler
+	uploadAccess   *swappableHandler
+	downloadAccess *swappableHandler
+	mu             sync.Mutex
+}
+
+// WatchSignals 启动后台协程，每收到一次 SIGHUP 重新加载一次配置
+func (r *ConfigReloader) WatchSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			r.Reload()
+		}
+	}()
+}
+
+// Reload 重新读取配置。新配置校验失败或中间件构建失败时保留当前配置；
+// 不可重新加载的配置项发生变化时记录警告并保持原值
+func (r *ConfigReloader) Reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slog.Info("收到 SIGHUP，重新加载配置", "path", r.path)
+	loaded, err := readConfig(r.path)
+	if err != nil {
+		slog.Error("重新加载配置失败，继续使用当前配置", "error", err)
+		return
+	}
+
+	current := AppConfig()
+	// 浅拷贝即可: 已发布的 Config 中的切片和 map 不会被修改
+	next := *current
+	var changed []string
+	nextValue, loadedValue, currentValue := reflect.ValueOf(&next).Elem(), reflect.ValueOf(loaded).Elem(), reflect.ValueOf(current).Elem()
+	for i := 0; i < nextValue.NumField(); i++ {
+		key := nextValue.Type().Field(i).Tag.Get("mapstructure")
+		if reflect.DeepEqual(currentValue.Field(i).Interface(), loadedValue.Field(i).Interface()) {
+			continue
+		}
+		if !reloadableConfigKeys[key] {
+			slog.Warn("该配置项需要重启服务才能生效，本次重新加载已忽略", "key", key)
+			continue
+		}
+		nextValue.Field(i).Set(loadedValue.Field(i))
+		changed = append(changed, key)
+	}
+	if len(changed) == 0 {
+		slog.Info("可重新加载的配置没有变化")
+		return
+	}
+	if err := next.Validate(); err != nil {
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			slog.Error("重新加载的配置无效，继续使用当前配置", "problem", problem)
+		}
+		return
+	}
+
+	// 先构建所有可能失败的中间件，全部成功后再替换，避免只应用了一部分配置
+	corsMiddleware, err := NewCORSMiddleware(&next)
+	if err != nil {
+		slog.Error("重新加载的 CORS 配置无效，继续使用当前配置", "error", err)
+		return
+	}
+	uploadAccess, downloadAccess, err := accessControlHandlers(next.AccessControl)
+	if err != nil {
+		slog.Error("重新加载的 IP 访问控制配置无效，继续使用当前配置", "error", err)
+		return
+	}
+
+	appConfig.Store(&next)
+	r.cors.Store(corsMiddleware)
+	r.uploadAccess.Store(uploadAccess)
+	r.downloadAccess.Store(downloadAccess)
+	r.rateLimits.Reload(next.RateLimit)
+	setLogLevel(next.LogLevel)
+	if !next.RateLimit.Enabled {
+		slog.Warn("速率限制已禁用")
+	}
+	slog.Info("配置已重新加载", "changed", changed)
+}
@@ -0,0 +1,100 @@
+// backend/reports.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// reportReporterCount 返回举报过该分享码的不同 IP 数量，同一 IP 的重复举报只计一次
+func reportReporterCount(db *gorm.DB, accessCode string) (int64, error) {
+	var count int64
+	err := db.Model(&Report{}).Where("access_code = ?", accessCode).Distinct("reporter_ip").Count(&count).Error
+	return count, err
+}
+
+// applyReportTakedown 在举报人数达到 ReportTakedownThreshold 时将文件标记为 Quarantined，
+// 被标记的文件在人工复核 (tempshare reports --release) 前无法下载或预览。返回本次是否触发了下架
+func applyReportTakedown(db *gorm.DB, accessCode string) (bool, error) {
+	threshold := AppConfig().ReportTakedownThreshold
+	if threshold <= 0 {
+		return false, nil
+	}
+	count, err := reportReporterCount(db, accessCode)
+	if err != nil || count < int64(threshold) {
+		return false, err
+	}
+	result := db.Model(&File{}).Where("access_code = ? AND quarantined = false", accessCode).Update("quarantined", true)
+	fileCache.Invalidate(accessCode)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		slog.Warn("文件举报人数达到阈值，已自动下架等待复核", "accessCode", accessCode, "reporters", count, "threshold", threshold)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// reportSummary 是按分享码汇总的举报信息
+type reportSummary struct {
+	AccessCode string
+	Reporters  int64
+	Reports    int64
+}
+
+// runReports 实现 `tempshare reports [--release CODE]`: 按举报人数从多到少列出被举报的分享码及其下架状态。
+// --release 在复核后恢复被自动下架的文件，并清除其举报记录，避免随后的一次举报再次触发下架
+func runReports(args []string) error {
+	fs := flag.NewFlagSet("reports", flag.ExitOnError)
+	release := fs.String("release", "", "恢复被自动下架的文件并清除其举报记录")
+	fs.Parse(args)
+
+	db, err := ConnectDatabase(AppConfig().Database)
+	if err != nil {
+		return fmt.Errorf("数据库初始化失败: %w", err)
+	}
+
+	if *release != "" {
+		result := db.Model(&File{}).Where("access_code = ?", *release).Update("quarantined", false)
+		if result.Error != nil {
+			return fmt.Errorf("恢复文件失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("分享码不存在: " + *release)
+		}
+		if err := db.Where("access_code = ?", *release).Delete(&Report{}).Error; err != nil {
+			return fmt.Errorf("清除举报记录失败: %w", err)
+		}
+		slog.Info("文件已恢复", "accessCode", *release)
+		return nil
+	}
+
+	var summaries []reportSummary
+	err = db.Model(&Report{}).
+		Select("access_code, COUNT(DISTINCT reporter_ip) AS reporters, COUNT(*) AS reports").
+		Group("access_code").Order("reporters desc").Scan(&summaries).Error
+	if err != nil {
+		return fmt.Errorf("查询举报记录失败: %w", err)
+	}
+	for _, s := range summaries {
+		state := "missing"
+		var file File
+		err := db.Select("quarantined", "scan_status").Where("access_code = ?", s.AccessCode).First(&file).Error
+		switch {
+		case err == nil && file.Quarantined:
+			state = "quarantined"
+		case err == nil && file.ScanStatus == ScanStatusInfected:
+			state = "infected"
+		case err == nil:
+			state = "active"
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return fmt.Errorf("查询文件记录失败: %w", err)
+		}
+		fmt.Printf("%s\t%d\t%d\t%s\n", s.AccessCode, s.Reporters, s.Reports, state)
+	}
+	return nil
+}
@@ -2,37 +2,222 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dutchcoders/go-clamd"
 )
 
+// Scanner 是病毒扫描器的通用接口，返回扫描状态 (ScanStatus*) 和结果描述
+type Scanner interface {
+	// ctx 携带请求级 logger，扫描器据此记录日志
+	ScanFile(ctx context.Context, filePath string) (string, string)
+	// ScanStream 扫描一个数据流，调用方负责在扫描后关闭它
+	ScanStream(ctx context.Context, reader io.Reader) (string, string)
+	// Available 报告扫描器当前是否可以处理请求
+	Available() bool
+}
+
+// NoopScanner 在扫描被禁用时使用，所有文件都标记为 skipped
+type NoopScanner struct{}
+
+func (NoopScanner) ScanFile(ctx context.Context, filePath string) (string, string) {
+	return ScanStatusSkipped, "扫描已禁用"
+}
+
+func (NoopScanner) ScanStream(ctx context.Context, reader io.Reader) (string, string) {
+	return ScanStatusSkipped, "扫描已禁用"
+}
+
+func (NoopScanner) Available() bool { return false }
+
+// scanningEnabled 报告扫描器是否会真正扫描文件
+func scanningEnabled(s Scanner) bool {
+	if s == nil {
+		return false
+	}
+	_, noop := s.(NoopScanner)
+	return !noop
+}
+
+// activeScanFiles 记录本进程正在使用的临时扫描文件，残留文件清理会跳过它们。
+// 大文件写入完成后交给 VirusTotal 等扫描器可能还要等待很久，期间修改时间不会更新，仅按时长判断并不可靠
+var activeScanFiles sync.Map
+
+// scanStreamViaTempFile 将数据流写入临时扫描目录后交给 ScanFile，
+// 用于只能扫描完整文件 (或需要多次读取) 的扫描器
+func scanStreamViaTempFile(ctx context.Context, s Scanner, reader io.Reader) (string, string) {
+	if err := os.MkdirAll(tempScanDir, os.ModePerm); err != nil {
+		loggerFromContext(ctx).Error("无法创建临时扫描目录", "path", tempScanDir, "error", err)
+		return ScanStatusError, "无法创建临时扫描文件"
+	}
+	tempFile, err := os.CreateTemp(tempScanDir, "stream-*")
+	if err != nil {
+		loggerFromContext(ctx).Error("无法创建临时文件", "path", tempScanDir, "error", err)
+		return ScanStatusError, "无法创建临时扫描文件"
+	}
+	activeScanFiles.Store(tempFile.Name(), struct{}{})
+	defer func() {
+		os.Remove(tempFile.Name())
+		activeScanFiles.Delete(tempFile.Name())
+	}()
+
+	_, err = io.Copy(tempFile, reader)
+	tempFile.Close()
+	if err != nil {
+		loggerFromContext(ctx).Error("写入临时扫描文件失败", "path", tempFile.Name(), "error", err)
+		return ScanStatusError, "无法创建临时扫描文件"
+	}
+	return s.ScanFile(ctx, tempFile.Name())
+}
+
+// scanFeedWriter 把上传数据转发给扫描协程。超过 limit 字节后停止转发并以 errScanLimit 结束扫描流，
+// 之后的写入全部丢弃，保证写入最终存储的一方不会被阻塞
+type scanFeedWriter struct {
+	pw      *io.PipeWriter
+	limit   int64 // 0 表示不限制
+	written int64
+	closed  bool
+}
+
+var errScanLimit = errors.New("超过扫描大小上限")
+
+func (w *scanFeedWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return len(p), nil
+	}
+	w.written += int64(len(p))
+	if w.limit > 0 && w.written > w.limit {
+		w.pw.CloseWithError(errScanLimit)
+		w.closed = true
+		return len(p), nil
+	}
+	if _, err := w.pw.Write(p); err != nil {
+		// 扫描方已停止读取，之后的数据不再转发
+		w.closed = true
+	}
+	return len(p), nil
+}
+
+// saveWhileScanning 将 body 写入存储的同时把相同的数据流交给扫描器，避免本地临时文件。
+// 超过 maxScanBytes 的部分不会发送给扫描器，此时返回的扫描结果不可信，调用方需按实际大小判断。
+func saveWhileScanning(ctx context.Context, storage FileStorage, key string, body io.Reader, scanner Scanner, maxScanBytes int64) (int64, string, string, error) {
+	pr, pw := io.Pipe()
+	feed := &scanFeedWriter{pw: pw, limit: maxScanBytes}
+
+	type verdict struct{ status, result string }
+	done := make(chan verdict, 1)
+	go func() {
+		status, result := scanner.ScanStream(ctx, pr)
+		// 扫描器提前返回时排空剩余数据，避免存储写入被阻塞
+		io.Copy(io.Discard, pr)
+		done <- verdict{status, result}
+	}()
+
+	written, err := storage.Save(ctx, key, io.TeeReader(body, feed))
+	if err != nil {
+		pw.CloseWithError(err)
+	} else {
+		pw.Close()
+	}
+	v := <-done
+	return written, v.status, v.result, err
+}
+
+// NewConfiguredScanner 根据配置创建上传时使用的扫描器和后台重扫任务使用的扫描器。
+// ScannerType 为 none 时返回 NoopScanner；auto 时根据 ClamdSocket 和 VirusTotal.APIKey 组合扫描器，
+// 没有可用扫描器时同样返回 NoopScanner。不需要重扫任务时 rescanner 为 nil。
+func NewConfiguredScanner(config *Config) (scanner Scanner, rescanner Scanner, err error) {
+	switch strings.ToLower(config.ScannerType) {
+	case "none":
+		slog.Warn("病毒扫描已禁用 (ScannerType=none)")
+		return NoopScanner{}, nil, nil
+	case "", "auto":
+	default:
+		return nil, nil, fmt.Errorf("不支持的扫描器类型: %s", config.ScannerType)
+	}
+
+	clamdScanner, err := NewScanner(config.ClamdSocket, config.ClamdMaxConcurrentScans)
+	if err != nil {
+		slog.Warn("Clamd 扫描器初始化失败，文件扫描功能将不可用。", "error", err)
+	}
+	var virusTotal *VirusTotalScanner
+	if config.VirusTotal.APIKey != "" {
+		virusTotal = NewVirusTotalScanner(config.VirusTotal)
+	}
+
+	if clamdScanner != nil && config.ClamdSocket != "" {
+		scanner = clamdScanner
+	}
+	if virusTotal != nil {
+		if config.ClamdSocket != "" && clamdScanner != nil {
+			scanner = NewChainScanner(clamdScanner, virusTotal)
+		} else {
+			scanner = virusTotal
+		}
+	}
+
+	if config.ClamdSocket != "" {
+		// 即使启动时 clamd 不可用，也为重扫任务准备扫描器，等待其恢复
+		rescanClamd := clamdScanner
+		if rescanClamd == nil {
+			rescanClamd = NewDeferredScanner(config.ClamdSocket, config.ClamdMaxConcurrentScans)
+		}
+		rescanner = rescanClamd
+		if virusTotal != nil {
+			rescanner = NewChainScanner(rescanClamd, virusTotal)
+		}
+	} else if virusTotal != nil {
+		rescanner = virusTotal
+	}
+	if scanner == nil {
+		scanner = NoopScanner{}
+	}
+	return scanner, rescanner, nil
+}
+
+// ClamdScanner 通过 clamd 扫描文件。go-clamd 的每条命令都会新建一个到 clamd 的连接，
+// slots 只用于限制同时进行的扫描数量 (ClamdMaxConcurrentScans)，为 nil 时不限制
 type ClamdScanner struct {
-	client *clamd.Clamd
+	address string
+	client  *clamd.Clamd
+	slots   chan struct{}
+}
+
+// newClamdScanner 创建最多同时进行 maxConcurrentScans 个扫描的 ClamdScanner，0 表示不限制
+func newClamdScanner(clamdAddress string, maxConcurrentScans int) *ClamdScanner {
+	s := &ClamdScanner{address: clamdAddress, client: clamd.NewClamd(clamdAddress)}
+	if maxConcurrentScans > 0 {
+		s.slots = make(chan struct{}, maxConcurrentScans)
+	}
+	return s
 }
 
 // NewScanner 创建一个新的 ClamdScanner 实例。
-// 它会尝试连接到 clamd 守护进程，并在连接失败时进行多次重试。
-func NewScanner(clamdAddress string) (*ClamdScanner, error) {
+// 它会尝试连接到 clamd 守护进程，并在连接失败时进行多次重试。maxConcurrentScans 为 0 时不限制同时进行的扫描数量。
+func NewScanner(clamdAddress string, maxConcurrentScans int) (*ClamdScanner, error) {
 	if clamdAddress == "" {
 		slog.Warn("ClamdSocket 未在 config.json 中配置，文件扫描功能将不可用。")
-		return &ClamdScanner{client: nil}, nil
+		return &ClamdScanner{}, nil
 	}
 
 	const maxRetries = 5               // 最多重试5次
 	const retryDelay = 5 * time.Second // 每次重试间隔5秒
 
-	var c *clamd.Clamd
 	var err error
 
 	for i := 1; i <= maxRetries; i++ {
-		c = clamd.NewClamd(clamdAddress)
-		err = c.Ping()
+		err = clamd.NewClamd(clamdAddress).Ping()
 		if err == nil {
-			slog.Info("成功连接到 clamd 守护进程", "address", clamdAddress, "attempt", i)
-			return &ClamdScanner{client: c}, nil
+			slog.Info("成功连接到 clamd 守护进程", "address", clamdAddress, "attempt", i, "maxConcurrentScans", maxConcurrentScans)
+			return newClamdScanner(clamdAddress, maxConcurrentScans), nil
 		}
 
 		slog.Warn("无法连接到 clamd 守护进程", "attempt", i, "maxAttempts", maxRetries, "address", clamdAddress, "error", err)
@@ -52,32 +237,165 @@ func NewScanner(clamdAddress string) (*ClamdScanner, error) {
 	return nil, err
 }
 
-func (s *ClamdScanner) ScanFile(filePath string) (string, string) {
+// acquire 占用一个扫描名额。名额全部占用时等待其他扫描结束，请求被取消或超时时返回 ctx 的错误，不会一直阻塞
+func (s *ClamdScanner) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.slots == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release 归还 acquire 占用的扫描名额
+func (s *ClamdScanner) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+func (s *ClamdScanner) ScanFile(ctx context.Context, filePath string) (string, string) {
+	return traceScan(ctx, "clamd.ScanFile", func(ctx context.Context) (string, string) { return s.scanFile(ctx, filePath) })
+}
+
+func (s *ClamdScanner) scanFile(ctx context.Context, filePath string) (string, string) {
 	if s.client == nil {
 		return ScanStatusSkipped, "扫描器未初始化"
 	}
 
-	slog.Info("开始扫描文件", "component", "clamd", "path", filePath)
+	if err := s.acquire(ctx); err != nil {
+		loggerFromContext(ctx).Error("等待 Clamd 扫描名额时请求结束", "component", "clamd", "error", err)
+		return ScanStatusError, "Clamd扫描通信失败"
+	}
+	defer s.release()
+
+	loggerFromContext(ctx).Info("开始扫描文件", "component", "clamd", "path", filePath)
 
 	response, err := s.client.ScanFile(filePath)
 	if err != nil {
-		slog.Error("Clamd 扫描通信出错", "component", "clamd", "error", err)
+		loggerFromContext(ctx).Error("Clamd 扫描通信出错", "component", "clamd", "error", err)
 		return ScanStatusError, "Clamd扫描通信失败"
 	}
+	return clamdVerdict(ctx, response, filePath)
+}
+
+// ScanStream 通过 INSTREAM 命令把数据流直接发送给 clamd 扫描，clamd 无需访问本地文件
+func (s *ClamdScanner) ScanStream(ctx context.Context, reader io.Reader) (string, string) {
+	return traceScan(ctx, "clamd.ScanStream", func(ctx context.Context) (string, string) { return s.scanStream(ctx, reader) })
+}
+
+func (s *ClamdScanner) scanStream(ctx context.Context, reader io.Reader) (string, string) {
+	if s.client == nil {
+		return ScanStatusSkipped, "扫描器未初始化"
+	}
+
+	if err := s.acquire(ctx); err != nil {
+		loggerFromContext(ctx).Error("等待 Clamd 扫描名额时请求结束", "component", "clamd", "error", err)
+		return ScanStatusError, "Clamd扫描通信失败"
+	}
+	defer s.release()
+
+	loggerFromContext(ctx).Info("开始扫描数据流", "component", "clamd")
+
+	abort := make(chan bool)
+	defer close(abort) // 关闭后 go-clamd 会释放底层连接
+	response, err := s.client.ScanStream(reader, abort)
+	if err != nil {
+		loggerFromContext(ctx).Error("Clamd 扫描通信出错", "component", "clamd", "error", err)
+		return ScanStatusError, "Clamd扫描通信失败"
+	}
+	return clamdVerdict(ctx, response, "stream")
+}
+
+// clamdVerdict 解析 clamd 的响应。提前返回时会排空剩余响应，避免 go-clamd 的读取协程阻塞
+func clamdVerdict(ctx context.Context, response chan *clamd.ScanResult, target string) (string, string) {
+	defer func() {
+		for range response {
+		}
+	}()
 
 	for result := range response {
-		slog.Debug("收到 Clamd 响应", "component", "clamd", "rawResponse", result.Raw)
+		loggerFromContext(ctx).Debug("收到 Clamd 响应", "component", "clamd", "rawResponse", result.Raw)
 		if result.Status == clamd.RES_FOUND {
 			virusName := strings.TrimSuffix(strings.TrimPrefix(result.Raw, result.Path+": "), " FOUND")
-			slog.Warn("危险! 文件发现病毒", "component", "clamd", "path", filePath, "virus", virusName)
+			loggerFromContext(ctx).Warn("危险! 文件发现病毒", "component", "clamd", "path", target, "virus", virusName)
 			return ScanStatusInfected, virusName
 		} else if result.Status == clamd.RES_ERROR {
 			errorDetails := strings.TrimSuffix(strings.TrimPrefix(result.Raw, result.Path+": "), " ERROR")
-			slog.Error("Clamd 扫描时发生错误", "component", "clamd", "details", errorDetails)
+			if strings.Contains(errorDetails, "size limit exceeded") {
+				// 文件超过了 clamd 的 StreamMaxLength，按跳过处理而不是扫描失败
+				loggerFromContext(ctx).Info("文件超过 clamd StreamMaxLength，跳过扫描", "component", "clamd", "path", target)
+				return ScanStatusSkipped, "文件超过 clamd 扫描大小上限 (StreamMaxLength)，已跳过"
+			}
+			loggerFromContext(ctx).Error("Clamd 扫描时发生错误", "component", "clamd", "details", errorDetails)
 			return ScanStatusError, errorDetails
 		}
 	}
 
-	slog.Info("扫描完成，文件安全", "component", "clamd", "path", filePath)
+	loggerFromContext(ctx).Info("扫描完成，文件安全", "component", "clamd", "path", target)
 	return ScanStatusClean, "文件安全"
 }
+
+// NewDeferredScanner 创建一个不预先检查连接的扫描器。
+// 用于启动时 clamd 不可用的情况，后台重扫任务会在 clamd 恢复后使用它。
+func NewDeferredScanner(clamdAddress string, maxConcurrentScans int) *ClamdScanner {
+	if clamdAddress == "" {
+		return nil
+	}
+	return newClamdScanner(clamdAddress, maxConcurrentScans)
+}
+
+// Available 检查 clamd 当前是否可以响应请求
+func (s *ClamdScanner) Available() bool {
+	if s == nil || s.client == nil {
+		return false
+	}
+	return s.client.Ping() == nil
+}
+
+// ChainScanner 依次运行多个扫描器 (例如先 clamd 后 VirusTotal)。
+// 任一扫描器报告感染即返回感染；否则只要有一个扫描器判定安全即视为安全。
+type ChainScanner struct {
+	scanners []Scanner
+}
+
+func NewChainScanner(scanners ...Scanner) *ChainScanner {
+	return &ChainScanner{scanners: scanners}
+}
+
+func (c *ChainScanner) ScanFile(ctx context.Context, filePath string) (string, string) {
+	status, result := ScanStatusSkipped, "没有可用的扫描器"
+	var clean bool
+	for _, scanner := range c.scanners {
+		s, r := scanner.ScanFile(ctx, filePath)
+		if s == ScanStatusInfected {
+			return s, r
+		}
+		if s == ScanStatusClean && !clean {
+			status, result, clean = s, r, true
+		} else if !clean {
+			status, result = s, r
+		}
+	}
+	return status, result
+}
+
+// ScanStream 先把数据流落盘，使每个扫描器都能完整读取
+func (c *ChainScanner) ScanStream(ctx context.Context, reader io.Reader) (string, string) {
+	return scanStreamViaTempFile(ctx, c, reader)
+}
+
+func (c *ChainScanner) Available() bool {
+	for _, scanner := range c.scanners {
+		if scanner.Available() {
+			return true
+		}
+	}
+	return false
+}
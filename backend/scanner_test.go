@@ -0,0 +1,48 @@
+// backend/scanner_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClamdScannerAcquireHonorsContext(t *testing.T) {
+	// 上限为 1 且名额已被占用
+	s := newClamdScanner("tcp://127.0.0.1:1", 1)
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire = %v, want context.DeadlineExceeded", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	status, _ := s.ScanStream(canceled, strings.NewReader("data"))
+	if status != ScanStatusError {
+		t.Fatalf("ScanStream status = %q, want %q", status, ScanStatusError)
+	}
+
+	s.release()
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("归还名额后 acquire = %v", err)
+	}
+}
+
+func TestClamdScannerUnlimitedConcurrency(t *testing.T) {
+	s := newClamdScanner("tcp://127.0.0.1:1", 0)
+	for i := 0; i < 100; i++ {
+		if err := s.acquire(context.Background()); err != nil {
+			t.Fatalf("第 %d 次 acquire = %v", i, err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		s.release()
+	}
+}
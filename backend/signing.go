@@ -0,0 +1,136 @@
+// backend/signing.go
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultSignedLinkTTL 是未指定有效期时签名链接的有效时长，最长不超过文件本身的过期时间
+	defaultSignedLinkTTL = time.Hour
+	// downloadConfirmTokenTTL 是一次性下载确认令牌的有效时长
+	downloadConfirmTokenTTL = 10 * time.Minute
+)
+
+// downloadSigningKey 是签发下载链接使用的 HMAC 密钥，见 initDownloadSigningKey
+var downloadSigningKey []byte
+
+// initDownloadSigningKey 使用配置的 DownloadSigningSecret 作为签名密钥。未配置时生成随机密钥，
+// 此时已签发的链接在重启后失效，多实例部署之间也无法互相验证
+func initDownloadSigningKey(secret string) error {
+	if secret != "" {
+		downloadSigningKey = []byte(secret)
+		return nil
+	}
+	downloadSigningKey = make([]byte, 32)
+	if _, err := rand.Read(downloadSigningKey); err != nil {
+		return err
+	}
+	slog.Warn("未配置 DownloadSigningSecret，已生成随机签名密钥，签名下载链接将在服务重启后失效")
+	return nil
+}
+
+// downloadSignature 计算签名。签名同时绑定文件 ID 和分享码，分享码轮换或被其他文件重用后旧链接都会失效
+func downloadSignature(file File, expiresAt int64) string {
+	mac := hmac.New(sha256.New, downloadSigningKey)
+	mac.Write([]byte(file.ID + "\n" + file.AccessCode + "\n" + strconv.FormatInt(expiresAt, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// downloadConfirmToken 生成一次性下载的确认令牌 ("过期时间.签名")。签名内容带有 confirm 前缀，
+// 与签名下载链接的 sig 不能互相替代。令牌本身可以重复提交，但文件在第一次下载时即被标记为已消费
+func downloadConfirmToken(file File, expiresAt int64) string {
+	mac := hmac.New(sha256.New, downloadSigningKey)
+	mac.Write([]byte("confirm\n" + file.ID + "\n" + file.AccessCode + "\n" + strconv.FormatInt(expiresAt, 10)))
+	return strconv.FormatInt(expiresAt, 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueDownloadConfirmToken 签发有效期为 downloadConfirmTokenTTL 的确认令牌，最长不超过文件本身的过期时间
+func issueDownloadConfirmToken(file File) (string, time.Time) {
+	expiresAt := time.Now().Add(downloadConfirmTokenTTL)
+	if expiresAt.After(file.ExpiresAt) {
+		expiresAt = file.ExpiresAt
+	}
+	exp := expiresAt.Unix()
+	return downloadConfirmToken(file, exp), time.Unix(exp, 0).UTC()
+}
+
+// verifyDownloadConfirmToken 校验 downloadConfirmToken 生成的令牌是否属于该文件且未过期
+func verifyDownloadConfirmToken(file File, token string) bool {
+	expPart, _, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	exp, err := strconv.ParseInt(expPart, 10, 64)
+	if err != nil || time.Now().Unix() >= exp {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(downloadConfirmToken(file, exp)))
+}
+
+type signLinkPayload struct {
+	ExpiresInSeconds int64 `json:"expiresInSeconds"`
+}
+
+// HandleSignDownloadLink 为文件签发限时的直接下载链接 (/data/:code?exp=...&sig=...)，需要管理令牌。
+// 持有链接即可下载，无需密码或 E2EE 验证哈希，适合嵌入其他系统
+func (h *FileHandler) HandleSignDownloadLink(c *gin.Context) {
+	file, ok := h.authorizeManage(c)
+	if !ok {
+		return
+	}
+	var payload signLinkPayload
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil || payload.ExpiresInSeconds < 0 {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, translate(c, msgInvalidSignRequest))
+			return
+		}
+	}
+	ttl := defaultSignedLinkTTL
+	if payload.ExpiresInSeconds > 0 {
+		ttl = time.Duration(payload.ExpiresInSeconds) * time.Second
+	}
+	expiresAt := time.Now().Add(ttl)
+	if expiresAt.After(file.ExpiresAt) {
+		expiresAt = file.ExpiresAt
+	}
+
+	exp := expiresAt.Unix()
+	sig := downloadSignature(file, exp)
+	query := url.Values{"exp": {strconv.FormatInt(exp, 10)}, "sig": {sig}}
+	requestLogger(c).Info("已签发下载链接", "clientIP", c.ClientIP(), "accessCode", file.AccessCode, "expiresAt", expiresAt)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, gin.H{
+		"urlPath":   "/data/" + url.PathEscape(file.AccessCode) + "?" + query.Encode(),
+		"signature": sig,
+		"expiresAt": time.Unix(exp, 0).UTC(),
+	})
+}
+
+// verifyDownloadSignature 校验下载请求中的 exp/sig 参数。未携带 sig 时返回 (false, true)，按常规流程验证密码；
+// 签名无效或已过期时写入 403 并返回 ok 为 false
+func verifyDownloadSignature(c *gin.Context, file File) (signed bool, ok bool) {
+	sig := c.Query("sig")
+	if sig == "" {
+		return false, true
+	}
+	exp, err := strconv.ParseInt(c.Query("exp"), 10, 64)
+	if err != nil || time.Now().Unix() >= exp ||
+		!hmac.Equal([]byte(sig), []byte(downloadSignature(file, exp))) {
+		requestLogger(c).Warn("签名下载链接无效或已过期", "clientIP", c.ClientIP(), "accessCode", file.AccessCode)
+		respondError(c, http.StatusForbidden, ErrCodeInvalidSignature, translate(c, msgInvalidSignature))
+		return false, false
+	}
+	return true, true
+}
@@ -0,0 +1,109 @@
+// backend/signing_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// withSigningKey 在测试期间使用固定的签名密钥
+func withSigningKey(t *testing.T, secret string) {
+	t.Helper()
+	previous := downloadSigningKey
+	t.Cleanup(func() { downloadSigningKey = previous })
+	initDownloadSigningKey(secret)
+}
+
+func TestVerifyDownloadConfirmToken(t *testing.T) {
+	withSigningKey(t, "test-secret")
+	file := File{ID: "file-1", AccessCode: "ABC123", ExpiresAt: time.Now().Add(time.Hour)}
+	future := time.Now().Add(time.Minute).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name  string
+		file  File
+		token string
+		want  bool
+	}{
+		{"valid", file, downloadConfirmToken(file, future), true},
+		{"expired", file, downloadConfirmToken(file, past), false},
+		{"other file", File{ID: "file-2", AccessCode: "ABC123"}, downloadConfirmToken(file, future), false},
+		{"rotated access code", File{ID: "file-1", AccessCode: "XYZ789"}, downloadConfirmToken(file, future), false},
+		{"extended expiry", file, strconv.FormatInt(future+3600, 10) + "." + downloadConfirmToken(file, future)[len(strconv.FormatInt(future, 10))+1:], false},
+		{"download signature", file, strconv.FormatInt(future, 10) + "." + downloadSignature(file, future), false},
+		{"missing separator", file, strconv.FormatInt(future, 10), false},
+		{"invalid expiry", file, "soon.abc", false},
+		{"empty", file, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyDownloadConfirmToken(tt.file, tt.token); got != tt.want {
+				t.Fatalf("verifyDownloadConfirmToken(%q) = %v, want %v", tt.token, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("other key", func(t *testing.T) {
+		token := downloadConfirmToken(file, future)
+		initDownloadSigningKey("other-secret")
+		if verifyDownloadConfirmToken(file, token) {
+			t.Fatal("其他密钥签发的令牌通过了验证")
+		}
+	})
+}
+
+func TestIssueDownloadConfirmTokenClampsToFileExpiry(t *testing.T) {
+	withSigningKey(t, "test-secret")
+	file := File{ID: "file-1", AccessCode: "ABC123", ExpiresAt: time.Now().Add(2 * time.Minute)}
+	token, expiresAt := issueDownloadConfirmToken(file)
+	if expiresAt.Unix() != file.ExpiresAt.Unix() {
+		t.Fatalf("expiresAt = %v, want %v", expiresAt, file.ExpiresAt)
+	}
+	if !verifyDownloadConfirmToken(file, token) {
+		t.Fatal("刚签发的令牌没有通过验证")
+	}
+}
+
+func TestVerifyDownloadSignature(t *testing.T) {
+	withSigningKey(t, "test-secret")
+	file := File{ID: "file-1", AccessCode: "ABC123"}
+	future := time.Now().Add(time.Minute).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+	query := func(exp int64, sig string) url.Values {
+		return url.Values{"exp": {strconv.FormatInt(exp, 10)}, "sig": {sig}}
+	}
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantSigned bool
+		wantOK     bool
+	}{
+		{"unsigned", url.Values{}, false, true},
+		{"valid", query(future, downloadSignature(file, future)), true, true},
+		{"expired", query(past, downloadSignature(file, past)), false, false},
+		{"extended expiry", query(future+3600, downloadSignature(file, future)), false, false},
+		{"other file", query(future, downloadSignature(File{ID: "file-2", AccessCode: "ABC123"}, future)), false, false},
+		{"missing exp", url.Values{"sig": {downloadSignature(file, future)}}, false, false},
+		{"tampered", query(future, downloadSignature(file, future)+"x"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c := newTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/data/ABC123?"+tt.query.Encode(), nil)
+			signed, ok := verifyDownloadSignature(c, file)
+			if signed != tt.wantSigned || ok != tt.wantOK {
+				t.Fatalf("verifyDownloadSignature = (%v, %v), want (%v, %v)", signed, ok, tt.wantSigned, tt.wantOK)
+			}
+			if !tt.wantOK && w.Code != http.StatusForbidden {
+				t.Fatalf("code = %d, want 403", w.Code)
+			}
+		})
+	}
+}
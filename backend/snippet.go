@@ -0,0 +1,104 @@
+// backend/snippet.go
+package main
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snippetLanguages 将文件扩展名映射为前端语法高亮使用的语言标识
+var snippetLanguages = map[string]string{
+	".txt": "plaintext", ".log": "plaintext", ".md": "markdown",
+	".go": "go", ".py": "python", ".js": "javascript", ".jsx": "javascript",
+	".ts": "typescript", ".tsx": "typescript", ".java": "java", ".kt": "kotlin",
+	".c": "c", ".h": "c", ".cpp": "cpp", ".hpp": "cpp", ".cs": "csharp",
+	".rs": "rust", ".rb": "ruby", ".php": "php", ".swift": "swift",
+	".sh": "bash", ".bash": "bash", ".ps1": "powershell", ".sql": "sql",
+	".html": "html", ".htm": "html", ".css": "css", ".scss": "scss",
+	".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml",
+	".xml": "xml", ".ini": "ini", ".conf": "ini", ".env": "ini",
+	".dockerfile": "dockerfile", ".lua": "lua", ".r": "r", ".diff": "diff", ".patch": "diff",
+}
+
+// snippetLanguage 根据文件名推断语言，无法识别时返回 plaintext
+func snippetLanguage(filename string) string {
+	if strings.EqualFold(filename, "Dockerfile") || strings.EqualFold(filename, "Makefile") {
+		return strings.ToLower(filename)
+	}
+	if lang, ok := snippetLanguages[strings.ToLower(filepath.Ext(filename))]; ok {
+		return lang
+	}
+	return "plaintext"
+}
+
+// HandleGetSnippet 以 JSON 形式返回小型文本文件的内容和语言提示，供前端直接高亮显示。
+// 与预览相同，过期、加密、被感染的文件不可查看；阅后即焚文件查看一次后即被销毁。
+func (h *FileHandler) HandleGetSnippet(c *gin.Context) {
+	file, ok := h.findActiveFile(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	if file.IsEncrypted || file.ScanStatus == ScanStatusInfected {
+		respondError(c, http.StatusForbidden, ErrCodePreviewUnavailable, translate(c, msgPreviewUnavailable))
+		return
+	}
+	if !h.checkCountry(c, file) {
+		return
+	}
+	if file.PasswordProtected && !h.checkFilePassword(c, file, c.GetHeader("X-File-Password")) {
+		return
+	}
+	maxBytes := AppConfig().MaxSnippetSizeKB * 1024
+	if file.contentLength() > maxBytes {
+		respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, translate(c, msgSnippetTooLarge), gin.H{"maxSizeBytes": maxBytes})
+		return
+	}
+
+	reader, err := retrieveFile(c.Request.Context(), h.Storage, file)
+	if err != nil {
+		requestLogger(c).Error("文本查看错误: 无法读取文件", "storageKey", file.StorageKey, "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeStorageError, translate(c, msgReadFailed))
+		return
+	}
+	defer reader.Close()
+
+	// 多读一个字节，防止数据库中的大小与实际对象不一致
+	content, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		requestLogger(c).Error("文本查看错误: 读取流失败", "storageKey", file.StorageKey, "error", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeStorageError, translate(c, msgReadFailed))
+		return
+	}
+	if int64(len(content)) > maxBytes {
+		respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, translate(c, msgSnippetTooLarge), gin.H{"maxSizeBytes": maxBytes})
+		return
+	}
+	if !utf8.Valid(content) || strings.ContainsRune(string(content), 0) {
+		respondError(c, http.StatusUnsupportedMediaType, ErrCodeNotTextFile, translate(c, msgNotTextFile))
+		return
+	}
+
+	// 与下载接口共用同一个原子标记，阅后即焚文件的查看和下载只能成功一次
+	if file.DownloadOnce && !h.claimDownloadOnce(file) {
+		respondFileExpired(c)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"accessCode":   file.AccessCode,
+		"filename":     file.Filename,
+		"sizeBytes":    file.contentLength(),
+		"language":     snippetLanguage(file.Filename),
+		"content":      string(content),
+		"expiresAt":    file.ExpiresAt,
+		"downloadOnce": file.DownloadOnce,
+	})
+
+	h.handleDownloadOnce(c, file)
+}
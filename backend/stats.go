@@ -0,0 +1,56 @@
+// backend/stats.go
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 访问计数对应的列名
+const (
+	statViewCount     = "view_count"
+	statDownloadCount = "download_count"
+)
+
+// FileStatsResponse 是 /api/v1/files/:code/stats 的响应结构
+type FileStatsResponse struct {
+	AccessCode     string     `json:"accessCode"`
+	ViewCount      int64      `json:"viewCount"`
+	DownloadCount  int64      `json:"downloadCount"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+}
+
+// recordAccess 在数据库中原子地把计数列加一并更新最后访问时间，并发请求不会丢失计数。
+// 统计失败只记录日志，不影响本次访问
+func (h *FileHandler) recordAccess(file File, column string) {
+	err := h.DB.Model(&File{}).Where("id = ?", file.ID).UpdateColumns(map[string]interface{}{
+		column:             gorm.Expr(column + " + 1"),
+		"last_accessed_at": time.Now(),
+	}).Error
+	if err != nil {
+		slog.Error("更新访问统计失败", "accessCode", file.AccessCode, "column", column, "error", err)
+	}
+}
+
+// HandleGetFileStats 返回文件的元信息查看次数、下载次数和最后访问时间，需要上传时返回的管理令牌
+func (h *FileHandler) HandleGetFileStats(c *gin.Context) {
+	file, ok := h.authorizeManage(c)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, FileStatsResponse{
+		AccessCode:     file.AccessCode,
+		ViewCount:      file.ViewCount,
+		DownloadCount:  file.DownloadCount,
+		LastAccessedAt: file.LastAccessedAt,
+		CreatedAt:      file.CreatedAt,
+		ExpiresAt:      file.ExpiresAt,
+	})
+}
@@ -7,11 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -22,70 +30,260 @@ import (
 	"gorm.io/gorm"
 )
 
-// FileStorage 定义了所有存储后端必须实现的接口
+// FileStorage 定义了所有存储后端必须实现的接口。
+// ctx 取消 (例如客户端断开) 时，进行中的传输应尽快中止；Retrieve 返回的流同样受 ctx 约束。
 type FileStorage interface {
-	Save(key string, reader io.Reader) (int64, error)
-	Retrieve(key string) (io.ReadCloser, error)
-	Delete(key string) error
+	Save(ctx context.Context, key string, reader io.Reader) (int64, error)
+	Retrieve(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
 	Exists(key string) bool
+	// Size 返回对象实际占用的字节数，对象不存在时返回 gorm.ErrRecordNotFound
+	Size(ctx context.Context, key string) (int64, error)
+	// Walk 逐个列出以 prefix 开头的对象键 (已去掉 KeyPrefix 和分片目录，与 File.StorageKey 一致)，
+	// prefix 为空时列出全部对象。以回调形式逐个返回，不会把所有键加载到内存；fn 返回错误时停止遍历并返回该错误
+	Walk(ctx context.Context, prefix string, fn func(key string) error) error
+}
+
+// contextReader 在 ctx 取消后让读取立即失败，用于不支持 context 的写入路径
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// contextReadCloser 在 ctx 取消时关闭底层流以中断阻塞中的读取，Close 时释放 ctx 关联的资源
+type contextReadCloser struct {
+	io.Reader
+	rc     io.ReadCloser
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newContextReadCloser(ctx context.Context, rc io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	crc := &contextReadCloser{Reader: &contextReader{ctx: ctx, r: rc}, rc: rc, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.Close()
+		case <-crc.done:
+		}
+	}()
+	return crc
+}
+
+func (crc *contextReadCloser) Close() error {
+	var err error
+	crc.once.Do(func() {
+		close(crc.done)
+		err = crc.rc.Close()
+		if crc.cancel != nil {
+			crc.cancel()
+		}
+	})
+	return err
+}
+
+// --- Key Prefix / Sharding ---
+// normalizeKeyPrefix 将 KeyPrefix 规范为 "a/b/" 形式，空字符串表示不使用前缀
+func normalizeKeyPrefix(prefix string) (string, error) {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return "", nil
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("无效的存储键前缀 (Storage.KeyPrefix): %q", prefix)
+		}
+	}
+	return prefix + "/", nil
+}
+
+// shardKey 按文件名的前两个字符把键分散到子目录，例如 quarantine/ab12... -> quarantine/ab/ab12...
+func shardKey(key string) string {
+	dir, name := path.Split(key)
+	if len(name) < 2 {
+		return key
+	}
+	return dir + name[:2] + "/" + name
+}
+
+// unshardKey 是 shardKey 的逆操作，不在分片目录中的键原样返回
+func unshardKey(key string) string {
+	dir, name := path.Split(key)
+	if len(name) < 2 {
+		return key
+	}
+	shard := name[:2] + "/"
+	if dir == shard || strings.HasSuffix(dir, "/"+shard) {
+		return dir[:len(dir)-len(shard)] + name
+	}
+	return key
 }
 
 // --- Local Storage Implementation ---
-type LocalStorage struct{ basePath string }
+// 开启 LocalShard 后新文件写入分片目录；读取和删除时仍会回退到未分片的旧路径，
+// 因此可以在已有数据上直接开启
+type LocalStorage struct {
+	basePath string
+	prefix   string
+	shard    bool
+}
 
 func NewLocalStorage(config StorageConfig) (*LocalStorage, error) {
 	if err := os.MkdirAll(config.LocalPath, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("无法创建本地存储目录 %s: %w", config.LocalPath, err)
 	}
-	slog.Info("使用本地文件存储", "path", config.LocalPath)
-	return &LocalStorage{basePath: config.LocalPath}, nil
+	slog.Info("使用本地文件存储", "path", config.LocalPath, "keyPrefix", config.KeyPrefix, "shard", config.LocalShard)
+	return &LocalStorage{basePath: config.LocalPath, prefix: config.KeyPrefix, shard: config.LocalShard}, nil
 }
-func (l *LocalStorage) fullPath(key string) string { return filepath.Join(l.basePath, key) }
-func (l *LocalStorage) Save(key string, reader io.Reader) (int64, error) {
+
+// legacyPath 是未分片时的路径
+func (l *LocalStorage) legacyPath(key string) string {
+	return filepath.Join(l.basePath, filepath.FromSlash(l.prefix+key))
+}
+func (l *LocalStorage) fullPath(key string) string {
+	if l.shard {
+		return filepath.Join(l.basePath, filepath.FromSlash(l.prefix+shardKey(key)))
+	}
+	return l.legacyPath(key)
+}
+func (l *LocalStorage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
 	filePath := l.fullPath(key)
+	// 键可能带有前缀 (例如隔离区)，确保父目录存在
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return 0, fmt.Errorf("本地存储创建目录失败: %w", err)
+	}
 	file, err := os.Create(filePath)
 	if err != nil {
 		return 0, fmt.Errorf("本地存储创建文件失败: %w", err)
 	}
 	defer file.Close()
-	return io.Copy(file, reader)
+	return io.Copy(file, &contextReader{ctx: ctx, r: reader})
 }
-func (l *LocalStorage) Retrieve(key string) (io.ReadCloser, error) {
+func (l *LocalStorage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	file, err := os.Open(l.fullPath(key))
+	if os.IsNotExist(err) && l.shard {
+		file, err = os.Open(l.legacyPath(key))
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, gorm.ErrRecordNotFound
 		}
 		return nil, fmt.Errorf("本地存储打开文件失败: %w", err)
 	}
-	return file, nil
+	return newContextReadCloser(ctx, file, nil), nil
 }
-func (l *LocalStorage) Delete(key string) error {
-	err := os.Remove(l.fullPath(key))
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("本地存储删除文件失败: %w", err)
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	paths := []string{l.fullPath(key)}
+	if l.shard {
+		paths = append(paths, l.legacyPath(key))
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("本地存储删除文件失败: %w", err)
+		}
 	}
 	return nil
 }
 func (l *LocalStorage) Exists(key string) bool {
-	_, err := os.Stat(l.fullPath(key))
-	return !os.IsNotExist(err)
+	if _, err := os.Stat(l.fullPath(key)); !os.IsNotExist(err) {
+		return true
+	}
+	if l.shard {
+		_, err := os.Stat(l.legacyPath(key))
+		return !os.IsNotExist(err)
+	}
+	return false
+}
+func (l *LocalStorage) Size(ctx context.Context, key string) (int64, error) {
+	info, err := os.Stat(l.fullPath(key))
+	if os.IsNotExist(err) && l.shard {
+		info, err = os.Stat(l.legacyPath(key))
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, gorm.ErrRecordNotFound
+		}
+		return 0, fmt.Errorf("本地存储读取文件信息失败: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// keyDir 返回 prefix 中最后一个 / 之前的目录部分 (含 /)，Walk 只需从该目录开始遍历
+func keyDir(prefix string) string {
+	return prefix[:strings.LastIndex(prefix, "/")+1]
+}
+
+func (l *LocalStorage) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	root := filepath.Join(l.basePath, filepath.FromSlash(l.prefix))
+	err := filepath.WalkDir(filepath.Join(root, filepath.FromSlash(keyDir(prefix))), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if l.shard {
+			key = unshardKey(key)
+		}
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(key)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // 该前缀对应的目录还没有写入过任何文件
+	}
+	return err
 }
 
 // --- S3 Storage Implementation ---
+// s3Endpoint 是一个 S3 端点及其桶，Fallbacks 中的每一项对应一个只读副本
+type s3Endpoint struct {
+	client   *s3.Client
+	bucket   string
+	endpoint string
+}
+
 type S3Storage struct {
-	client *s3.Client
-	bucket string
+	client    *s3.Client
+	bucket    string
+	prefix    string
+	fallbacks []s3Endpoint
 }
 
-func NewS3Storage(config StorageConfig) (*S3Storage, error) {
+// s3MaxAttemptsPerEndpoint 是读取时每个端点遇到可重试错误后的最大尝试次数
+const s3MaxAttemptsPerEndpoint = 2
+
+func newS3Client(config S3Config) (*s3.Client, error) {
 	cfg, err := awsconfig.LoadDefaultConfig(context.TODO(),
-		awsconfig.WithRegion(config.S3.Region),
-		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(config.S3.AccessKeyID, config.S3.SecretAccessKey, "")),
+		awsconfig.WithRegion(config.Region),
+		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(config.AccessKeyID, config.SecretAccessKey, "")),
 		awsconfig.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(
 			func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-				if config.S3.Endpoint != "" {
-					return aws.Endpoint{URL: config.S3.Endpoint}, nil
+				if config.Endpoint != "" {
+					return aws.Endpoint{URL: config.Endpoint}, nil
 				}
 				return aws.Endpoint{}, &aws.EndpointNotFoundError{}
 			},
@@ -94,40 +292,123 @@ func NewS3Storage(config StorageConfig) (*S3Storage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("无法加载 S3 配置: %w", err)
 	}
-	client := s3.NewFromConfig(cfg, func(o *s3.Options) { o.UsePathStyle = config.S3.UsePathStyle })
-	slog.Info("使用 S3 对象存储", "endpoint", config.S3.Endpoint, "bucket", config.S3.Bucket)
-	return &S3Storage{client: client, bucket: config.S3.Bucket}, nil
+	return s3.NewFromConfig(cfg, func(o *s3.Options) { o.UsePathStyle = config.UsePathStyle }), nil
+}
+
+func NewS3Storage(config StorageConfig) (*S3Storage, error) {
+	client, err := newS3Client(config.S3)
+	if err != nil {
+		return nil, err
+	}
+	if config.S3.CreateBucketIfMissing {
+		if err := ensureS3Bucket(context.Background(), client, config.S3); err != nil {
+			return nil, err
+		}
+	}
+	storage := &S3Storage{client: client, bucket: config.S3.Bucket, prefix: config.KeyPrefix}
+	slog.Info("使用 S3 对象存储", "endpoint", config.S3.Endpoint, "bucket", config.S3.Bucket, "keyPrefix", config.KeyPrefix)
+
+	for i, fallback := range config.S3.Fallbacks {
+		// 未填写的字段沿用主端点的配置，通常副本只需要不同的 Endpoint/Region
+		if fallback.Region == "" {
+			fallback.Region = config.S3.Region
+		}
+		if fallback.Bucket == "" {
+			fallback.Bucket = config.S3.Bucket
+		}
+		if fallback.AccessKeyID == "" {
+			fallback.AccessKeyID, fallback.SecretAccessKey = config.S3.AccessKeyID, config.S3.SecretAccessKey
+		}
+		client, err := newS3Client(fallback)
+		if err != nil {
+			return nil, fmt.Errorf("S3 备用端点 #%d: %w", i+1, err)
+		}
+		storage.fallbacks = append(storage.fallbacks, s3Endpoint{client: client, bucket: fallback.Bucket, endpoint: fallback.Endpoint})
+		slog.Info("已添加 S3 读取备用端点", "endpoint", fallback.Endpoint, "region", fallback.Region, "bucket", fallback.Bucket)
+	}
+	return storage, nil
+}
+
+// ensureS3Bucket 在 HeadBucket 返回 404 时创建桶。其他实例同时创建导致的 BucketAlreadyOwnedByYou 视为成功；
+// 桶名已被其他账户占用 (BucketAlreadyExists) 时返回错误，需要换一个桶名
+func ensureS3Bucket(ctx context.Context, client *s3.Client, config S3Config) error {
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(config.Bucket)})
+	if err == nil {
+		return nil
+	}
+	var notFound *types.NotFound
+	if !errors.As(err, &notFound) {
+		return fmt.Errorf("S3 存储检查桶 %s 失败: %w", config.Bucket, err)
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(config.Bucket)}
+	// us-east-1 是默认区域，AWS 不接受显式指定它作为 LocationConstraint
+	if config.Region != "" && config.Region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{LocationConstraint: types.BucketLocationConstraint(config.Region)}
+	}
+	_, err = client.CreateBucket(ctx, input)
+	var ownedByYou *types.BucketAlreadyOwnedByYou
+	if errors.As(err, &ownedByYou) {
+		return nil
+	}
+	var exists *types.BucketAlreadyExists
+	if errors.As(err, &exists) {
+		return fmt.Errorf("S3 存储无法创建桶 %s: 桶名已被其他账户占用", config.Bucket)
+	}
+	if err != nil {
+		return fmt.Errorf("S3 存储创建桶 %s 失败: %w", config.Bucket, err)
+	}
+	slog.Info("S3 桶不存在，已自动创建", "bucket", config.Bucket, "region", config.Region)
+	return nil
 }
-func (s *S3Storage) Save(key string, reader io.Reader) (int64, error) {
-	data, err := io.ReadAll(reader)
+
+func (s *S3Storage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	data, err := io.ReadAll(&contextReader{ctx: ctx, r: reader})
 	if err != nil {
 		return 0, fmt.Errorf("S3 存储读取数据流失败: %w", err)
 	}
 	contentLength := int64(len(data))
-	_, err = s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(s.bucket), Key: aws.String(key), Body: bytes.NewReader(data), ContentLength: &contentLength,
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + key), Body: bytes.NewReader(data), ContentLength: &contentLength,
 	})
 	if err != nil {
 		return 0, fmt.Errorf("S3 存储上传对象失败: %w", err)
 	}
 	return contentLength, nil
 }
-func (s *S3Storage) Retrieve(key string) (io.ReadCloser, error) {
-	output, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket), Key: aws.String(key),
-	})
-	if err != nil {
-		var nsk *types.NoSuchKey
-		if errors.As(err, &nsk) {
-			return nil, gorm.ErrRecordNotFound
+
+// Retrieve 先从主端点读取，遇到可重试错误 (非 NoSuchKey、非请求取消) 时依次尝试备用端点
+func (s *S3Storage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	endpoints := append([]s3Endpoint{{client: s.client, bucket: s.bucket, endpoint: "primary"}}, s.fallbacks...)
+
+	var lastErr error
+	for i, ep := range endpoints {
+		for attempt := 1; attempt <= s3MaxAttemptsPerEndpoint; attempt++ {
+			output, err := ep.client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(ep.bucket), Key: aws.String(s.prefix + key),
+			})
+			if err == nil {
+				if i > 0 {
+					loggerFromContext(ctx).Info("S3 读取由备用端点完成", "endpoint", ep.endpoint, "key", key)
+				}
+				return output.Body, nil
+			}
+			var nsk *types.NoSuchKey
+			if errors.As(err, &nsk) {
+				return nil, gorm.ErrRecordNotFound
+			}
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("S3 存储获取对象失败: %w", err)
+			}
+			lastErr = err
+			loggerFromContext(ctx).Warn("S3 读取失败", "endpoint", ep.endpoint, "key", key, "attempt", attempt, "error", err)
 		}
-		return nil, fmt.Errorf("S3 存储获取对象失败: %w", err)
 	}
-	return output.Body, nil
+	return nil, fmt.Errorf("S3 存储获取对象失败: %w", lastErr)
 }
-func (s *S3Storage) Delete(key string) error {
-	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucket), Key: aws.String(key),
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + key),
 	})
 	if err != nil {
 		return fmt.Errorf("S3 存储删除对象失败: %w", err)
@@ -136,18 +417,73 @@ func (s *S3Storage) Delete(key string) error {
 }
 func (s *S3Storage) Exists(key string) bool {
 	_, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
-		Bucket: aws.String(s.bucket), Key: aws.String(key),
+		Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + key),
 	})
 	return err == nil
 }
 
+// Size 只查询主端点，备用端点只在 Retrieve 失败时使用
+func (s *S3Storage) Size(ctx context.Context, key string) (int64, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return 0, gorm.ErrRecordNotFound
+		}
+		return 0, fmt.Errorf("S3 存储查询对象失败: %w", err)
+	}
+	return aws.ToInt64(output.ContentLength), nil
+}
+
+// Walk 使用 ListObjectsV2 分页列出对象，每页最多 1000 个键
+func (s *S3Storage) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket), Prefix: aws.String(s.prefix + prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("S3 存储列出对象失败: %w", err)
+		}
+		for _, object := range page.Contents {
+			if err := fn(strings.TrimPrefix(aws.ToString(object.Key), s.prefix)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // --- WebDAV Storage Implementation ---
+
+// webdavTimeout 限制 WebDAV 的连接、TLS 握手和等待响应头的时间，以及 gowebdav 发出的元数据请求 (PROPFIND、MKCOL、DELETE) 的总时长。
+// 流式的 PUT/GET 不设总时长 (大文件传输可能很久)，由 ctx 和 Storage.*TimeoutSeconds 控制
+const webdavTimeout = 60 * time.Second
+
 type WebDAVStorage struct {
 	client *gowebdav.Client
+	// 上传绕过 gowebdav 直接发送 PUT: gowebdav 的 WriteStream 会把不可 Seek 的流完整读入内存，
+	// 而 Write 需要 []byte，两者都无法流式上传。
+	// 直接发送的请求只使用 Basic 认证 (gowebdav 协商认证方式的逻辑不对外公开)，启动时由 checkWebDAVBasicAuth 确认服务器接受
+	baseURL  string
+	prefix   string
+	username string
+	password string
+	http     *http.Client
+	dirs     sync.Map // 已确认存在的父目录，避免每次上传都发送 MKCOL
 }
 
 func NewWebDAVStorage(config StorageConfig) (*WebDAVStorage, error) {
+	// gowebdav 与直接发送的请求共用同一个带超时的连接池
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: webdavTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = webdavTimeout
+	transport.ResponseHeaderTimeout = webdavTimeout
 	client := gowebdav.NewClient(config.WebDAV.URL, config.WebDAV.Username, config.WebDAV.Password)
+	client.SetTransport(transport)
+	client.SetTimeout(webdavTimeout)
 
 	// ✨ 修复点: 检查连接和认证
 	if err := client.Connect(); err != nil {
@@ -157,38 +493,144 @@ func NewWebDAVStorage(config StorageConfig) (*WebDAVStorage, error) {
 		return nil, fmt.Errorf("WebDAV 服务器连接失败 at %s: %w", config.WebDAV.URL, err)
 	}
 
-	slog.Info("使用 WebDAV 存储", "url", config.WebDAV.URL)
-	return &WebDAVStorage{client: client}, nil
+	httpClient := &http.Client{Transport: transport}
+	if err := checkWebDAVBasicAuth(httpClient, config.WebDAV.URL, config.WebDAV.Username, config.WebDAV.Password); err != nil {
+		return nil, err
+	}
+
+	slog.Info("使用 WebDAV 存储", "url", config.WebDAV.URL, "keyPrefix", config.KeyPrefix)
+	return &WebDAVStorage{
+		client:   client,
+		baseURL:  config.WebDAV.URL,
+		prefix:   config.KeyPrefix,
+		username: config.WebDAV.Username,
+		password: config.WebDAV.Password,
+		http:     httpClient,
+	}, nil
 }
 
-func (w *WebDAVStorage) Save(key string, reader io.Reader) (int64, error) {
-	data, err := io.ReadAll(reader)
+// checkWebDAVBasicAuth 以 Save/Retrieve 相同的方式 (Basic 认证) 对根目录发送 PROPFIND。
+// gowebdav 的 Connect 会自动协商 Digest 等认证方式，仅要求这些方式的服务器能通过 Connect，
+// 却会让之后的每次上传下载都返回 401，因此在启动时明确拒绝
+func checkWebDAVBasicAuth(client *http.Client, baseURL, username, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webdavTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", baseURL, nil)
 	if err != nil {
-		return 0, fmt.Errorf("WebDAV 存储读取数据流失败: %w", err)
+		return fmt.Errorf("WebDAV 存储地址无效: %w", err)
 	}
-	contentLength := int64(len(data))
+	req.Header.Set("Depth", "0")
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("WebDAV 服务器连接失败 at %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil
+	}
+	for _, challenge := range resp.Header.Values("WWW-Authenticate") {
+		if strings.HasPrefix(strings.ToLower(challenge), "basic") {
+			return fmt.Errorf("WebDAV 认证失败 (401 Unauthorized): 请检查用户名和密码")
+		}
+	}
+	return fmt.Errorf("WebDAV 服务器不接受 Basic 认证 (WWW-Authenticate: %q): 流式上传和下载仅支持 Basic 认证，请在服务器上启用 Basic 认证 (建议配合 HTTPS)", resp.Header.Get("WWW-Authenticate"))
+}
+
+// ensureParent 为带前缀的键 (例如 quarantine/xxx) 创建中间目录。
+// 流式上传无法在 409 后重放请求体，因此需要在 PUT 之前创建
+func (w *WebDAVStorage) ensureParent(key string) error {
+	dir := path.Dir(key)
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	if _, ok := w.dirs.Load(dir); ok {
+		return nil
+	}
+	if err := w.client.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	w.dirs.Store(dir, struct{}{})
+	return nil
+}
 
-	err = w.client.Write(key, data, 0644)
+// Save 以分块传输编码 (chunked) 流式 PUT 到服务器，不在内存中缓冲整个文件。
+// 仅支持 Basic 认证；请求随 ctx 取消而中止
+func (w *WebDAVStorage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	key = w.prefix + key
+	if err := w.ensureParent(key); err != nil {
+		return 0, fmt.Errorf("WebDAV 存储创建目录失败: %w", err)
+	}
+	target, err := url.JoinPath(w.baseURL, key)
+	if err != nil {
+		return 0, fmt.Errorf("WebDAV 存储地址无效: %w", err)
+	}
+	body := &countingReader{r: reader}
+	// 请求体不是 bytes/strings 类型时 ContentLength 为 0，net/http 会使用 chunked 编码
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, body)
+	if err != nil {
+		return 0, fmt.Errorf("WebDAV 存储创建请求失败: %w", err)
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.http.Do(req)
 	if err != nil {
 		return 0, fmt.Errorf("WebDAV 存储写入失败: %w", err)
 	}
-	return contentLength, nil
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return body.n, nil
+	case http.StatusNotFound, http.StatusConflict:
+		// 父目录可能已被外部删除，清除缓存以便下次重新创建
+		w.dirs.Delete(path.Dir(key))
+		return 0, fmt.Errorf("WebDAV 存储写入失败: 父目录不存在 (%d)", resp.StatusCode)
+	default:
+		return 0, fmt.Errorf("WebDAV 存储写入失败: 服务器返回 %w", gowebdav.StatusError{Status: resp.StatusCode})
+	}
 }
 
-func (w *WebDAVStorage) Retrieve(key string) (io.ReadCloser, error) {
-	stream, err := w.client.ReadStream(key)
+// Retrieve 与 Save 一样直接发送 GET 请求而不使用 gowebdav (不支持 context)，
+// 服务器迟迟不响应时请求随 ctx 取消 (例如 RequestTimeoutSeconds 或 RetrieveTimeoutSeconds) 而中止
+func (w *WebDAVStorage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := url.JoinPath(w.baseURL, w.prefix+key)
+	if err != nil {
+		return nil, fmt.Errorf("WebDAV 存储地址无效: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("WebDAV 存储创建请求失败: %w", err)
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.http.Do(req)
 	if err != nil {
-		// ✨ 修复点: gowebdav 在文件不存在时会返回符合 os.IsNotExist 的错误
-		if os.IsNotExist(err) {
-			return nil, gorm.ErrRecordNotFound
-		}
 		return nil, fmt.Errorf("WebDAV 存储读取流失败: %w", err)
 	}
-	return stream, nil
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound, http.StatusGone:
+		resp.Body.Close()
+		return nil, gorm.ErrRecordNotFound
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("WebDAV 存储读取流失败: 服务器返回 %w", gowebdav.StatusError{Status: resp.StatusCode})
+	}
 }
 
-func (w *WebDAVStorage) Delete(key string) error {
-	err := w.client.Remove(key)
+func (w *WebDAVStorage) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := w.client.Remove(w.prefix + key)
 	if err != nil {
 		// ✨ 修复点: 同样使用 os.IsNotExist 判断
 		if os.IsNotExist(err) {
@@ -200,20 +642,248 @@ func (w *WebDAVStorage) Delete(key string) error {
 }
 
 func (w *WebDAVStorage) Exists(key string) bool {
-	_, err := w.client.Stat(key)
+	_, err := w.client.Stat(w.prefix + key)
 	return err == nil
 }
 
+func (w *WebDAVStorage) Size(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	info, err := w.client.Stat(w.prefix + key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, gorm.ErrRecordNotFound
+		}
+		return 0, fmt.Errorf("WebDAV 存储读取文件信息失败: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// Walk 从 prefix 所在的目录开始逐层 PROPFIND，WebDAV 没有分页，每个目录的列表会一次性返回
+func (w *WebDAVStorage) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	start := keyDir(prefix)
+	return w.walkDir(ctx, start, start, prefix, fn)
+}
+
+func (w *WebDAVStorage) walkDir(ctx context.Context, start, dir, prefix string, fn func(key string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := w.client.ReadDir("/" + w.prefix + dir)
+	if err != nil {
+		if dir == start && gowebdav.IsErrNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("WebDAV 存储列出目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		key := dir + entry.Name()
+		switch {
+		case entry.IsDir():
+			err = w.walkDir(ctx, start, key+"/", prefix, fn)
+		case strings.HasPrefix(key, prefix):
+			err = fn(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Timeout Decorator ---
+// timeoutStorage 为每次存储操作附加配置的超时时间，0 表示不限制
+type timeoutStorage struct {
+	FileStorage
+	save, retrieve, delete time.Duration
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+func (t *timeoutStorage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	ctx, cancel := withTimeout(ctx, t.save)
+	defer cancel()
+	return t.FileStorage.Save(ctx, key, reader)
+}
+
+// Retrieve 的超时覆盖整个读取过程，直到调用方关闭返回的流
+func (t *timeoutStorage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, cancel := withTimeout(ctx, t.retrieve)
+	rc, err := t.FileStorage.Retrieve(ctx, key)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return newContextReadCloser(ctx, rc, cancel), nil
+}
+
+func (t *timeoutStorage) Size(ctx context.Context, key string) (int64, error) {
+	ctx, cancel := withTimeout(ctx, t.retrieve)
+	defer cancel()
+	return t.FileStorage.Size(ctx, key)
+}
+
+func (t *timeoutStorage) Delete(ctx context.Context, key string) error {
+	ctx, cancel := withTimeout(ctx, t.delete)
+	defer cancel()
+	return t.FileStorage.Delete(ctx, key)
+}
+
+// --- Retry Decorator ---
+// retryingStorage 在遇到暂时性错误 (超时、连接中断、5xx、429) 时按指数退避重试存储操作，
+// 对象不存在、4xx 等确定性错误立即返回。Save 只在尚未读取任何上传数据时重试，已读取的数据无法重放
+type retryingStorage struct {
+	FileStorage
+	config RetryConfig
+}
+
+// permanentStorageError 标记不应重试的错误
+type permanentStorageError struct{ error }
+
+func (e permanentStorageError) Unwrap() error { return e.error }
+
+// isRetryableStorageError 判断存储错误是否可能在重试后成功。调用方的 ctx 已结束时不再重试
+func isRetryableStorageError(ctx context.Context, err error) bool {
+	var permanent permanentStorageError
+	if err == nil || ctx.Err() != nil || errors.As(err, &permanent) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return false
+	}
+	// S3 (smithy) 的响应错误带有 HTTP 状态码，WebDAV 的状态码错误为 gowebdav.StatusError
+	var withStatus interface{ HTTPStatusCode() int }
+	if errors.As(err, &withStatus) {
+		return withStatus.HTTPStatusCode() >= 500 || withStatus.HTTPStatusCode() == http.StatusTooManyRequests
+	}
+	var webdavStatus gowebdav.StatusError
+	if errors.As(err, &webdavStatus) {
+		return webdavStatus.Status >= 500 || webdavStatus.Status == http.StatusTooManyRequests
+	}
+	// 单次操作超时 (见 timeoutStorage) 而调用方的 ctx 仍有效时可以重试
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoff 返回第 attempt 次失败后的等待时间: InitialBackoffMs*2^(attempt-1)，不超过 MaxBackoffMs，并加入随机抖动
+func (r *retryingStorage) backoff(attempt int) time.Duration {
+	delay := time.Duration(r.config.InitialBackoffMs) * time.Millisecond
+	maxDelay := time.Duration(r.config.MaxBackoffMs) * time.Millisecond
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retry 执行 fn，可重试的错误最多尝试 MaxAttempts 次。多次尝试后仍失败时在错误中注明尝试次数
+func (r *retryingStorage) retry(ctx context.Context, op, key string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryableStorageError(ctx, err) {
+			return err
+		}
+		if attempt >= r.config.MaxAttempts {
+			if attempt > 1 {
+				return fmt.Errorf("存储操作 %s 在 %d 次尝试后仍然失败: %w", op, attempt, err)
+			}
+			return err
+		}
+		delay := r.backoff(attempt)
+		loggerFromContext(ctx).Warn("存储操作失败，稍后重试", "op", op, "key", key, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (r *retryingStorage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	body := &countingReader{r: reader}
+	var written int64
+	err := r.retry(ctx, "save", key, func() error {
+		var err error
+		written, err = r.FileStorage.Save(ctx, key, body)
+		if err != nil && body.n > 0 {
+			return permanentStorageError{err}
+		}
+		return err
+	})
+	return written, err
+}
+
+func (r *retryingStorage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := r.retry(ctx, "retrieve", key, func() error {
+		var err error
+		rc, err = r.FileStorage.Retrieve(ctx, key)
+		return err
+	})
+	return rc, err
+}
+
+func (r *retryingStorage) Delete(ctx context.Context, key string) error {
+	return r.retry(ctx, "delete", key, func() error {
+		return r.FileStorage.Delete(ctx, key)
+	})
+}
+
+func (r *retryingStorage) Size(ctx context.Context, key string) (int64, error) {
+	var size int64
+	err := r.retry(ctx, "size", key, func() error {
+		var err error
+		size, err = r.FileStorage.Size(ctx, key)
+		return err
+	})
+	return size, err
+}
+
 // --- Factory Function ---
 func NewFileStorage(config StorageConfig) (FileStorage, error) {
+	var storage FileStorage
+	var err error
+	if config.KeyPrefix, err = normalizeKeyPrefix(config.KeyPrefix); err != nil {
+		return nil, err
+	}
 	switch strings.ToLower(config.Type) {
 	case "local":
-		return NewLocalStorage(config)
+		storage, err = NewLocalStorage(config)
 	case "s3":
-		return NewS3Storage(config)
+		storage, err = NewS3Storage(config)
 	case "webdav":
-		return NewWebDAVStorage(config)
+		storage, err = NewWebDAVStorage(config)
+	case "ipfs":
+		storage, err = NewIPFSStorage(config)
+	case "b2":
+		storage, err = NewB2Storage(config)
 	default:
 		return nil, fmt.Errorf("不支持的存储类型: %s", config.Type)
 	}
+	if err != nil {
+		return nil, err
+	}
+	// 超时作用于每一次尝试，超时的尝试可以被重试
+	storage = &timeoutStorage{
+		FileStorage: storage,
+		save:        time.Duration(config.SaveTimeoutSeconds) * time.Second,
+		retrieve:    time.Duration(config.RetrieveTimeoutSeconds) * time.Second,
+		delete:      time.Duration(config.DeleteTimeoutSeconds) * time.Second,
+	}
+	if config.Retry.MaxAttempts > 1 {
+		storage = &retryingStorage{FileStorage: storage, config: config.Retry}
+	}
+	return storage, nil
 }
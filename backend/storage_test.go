@@ -0,0 +1,42 @@
+// backend/storage_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckWebDAVBasicAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		scheme   string // 服务器在 401 时声明的认证方式
+		username string
+		password string
+		wantErr  string
+	}{
+		{"basic accepted", `Basic realm="dav"`, "user", "secret", ""},
+		{"basic wrong password", `Basic realm="dav"`, "user", "wrong", "请检查用户名和密码"},
+		{"digest only", `Digest realm="dav", nonce="abc", qop="auth"`, "user", "secret", "不接受 Basic 认证"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, pass, ok := r.BasicAuth()
+				if !strings.HasPrefix(tt.scheme, "Basic") || !ok || user != "user" || pass != "secret" {
+					w.Header().Set("WWW-Authenticate", tt.scheme)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(http.StatusMultiStatus)
+			}))
+			defer server.Close()
+
+			err := checkWebDAVBasicAuth(server.Client(), server.URL, tt.username, tt.password)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("checkWebDAVBasicAuth = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// backend/tags.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// 自定义标签 (X-File-Tags) 的限制
+const (
+	MaxFileTags        = 10
+	MaxFileTagKeyLen   = 64
+	MaxFileTagValueLen = 256
+)
+
+var errInvalidFileTags = errors.New("无效的文件标签 (X-File-Tags)")
+
+// parseFileTags 解析 JSON 对象形式的标签，例如 {"project":"alpha","owner":"me"}。
+// 键只能由字母、数字和 _ . - 组成，值不能包含控制字符。返回空字符串表示未提供，
+// 否则返回重新序列化后的 JSON (键有序)，以便按标签过滤时做字面匹配
+func parseFileTags(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(raw), &tags); err != nil || len(tags) > MaxFileTags {
+		return "", errInvalidFileTags
+	}
+	if len(tags) == 0 {
+		return "", nil
+	}
+	for key, value := range tags {
+		if !validTagKey(key) || len(value) > MaxFileTagValueLen {
+			return "", errInvalidFileTags
+		}
+		for _, r := range value {
+			if unicode.IsControl(r) {
+				return "", errInvalidFileTags
+			}
+		}
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return "", errInvalidFileTags
+	}
+	return string(data), nil
+}
+
+func validTagKey(key string) bool {
+	if key == "" || len(key) > MaxFileTagKeyLen {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// tags 解码文件记录中保存的标签，没有标签时返回 nil
+func (f File) tags() map[string]string {
+	if f.Tags == "" {
+		return nil
+	}
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(f.Tags), &tags); err != nil {
+		return nil
+	}
+	return tags
+}
+
+// whereTag 限定为带有 key=value 标签的文件。标签按 json.Marshal 的规范形式保存，
+// 字符串内部的引号总会被转义，因此 "key":"value" 的字面匹配不会误中其他键值的内容
+func whereTag(query *gorm.DB, key, value string) *gorm.DB {
+	k, _ := json.Marshal(key)
+	v, _ := json.Marshal(value)
+	pattern := "%" + likeEscaper.Replace(string(k)+":"+string(v)) + "%"
+	return query.Where("tags LIKE ? ESCAPE '!'", pattern)
+}
+
+// tagFlags 收集可重复的 --tag key=value 参数
+type tagFlags [][2]string
+
+func (t *tagFlags) String() string { return fmt.Sprint(*t) }
+
+func (t *tagFlags) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return errors.New("格式应为 key=value")
+	}
+	*t = append(*t, [2]string{key, value})
+	return nil
+}
+
+// runListFiles 实现 `tempshare files [--tag project=alpha ...] [--all]`: 供运维按标签查看文件。
+// 多个 --tag 需同时满足；默认只列出未过期的文件。每行输出分享码、文件名、大小、过期时间和标签，以制表符分隔。
+// 标签只能由此命令或文件元信息查看，公开列表不会返回
+func runListFiles(args []string) error {
+	fs := flag.NewFlagSet("files", flag.ExitOnError)
+	var tagFilters tagFlags
+	fs.Var(&tagFilters, "tag", "只列出带有该标签的文件 (key=value，可重复)")
+	all := fs.Bool("all", false, "同时列出已过期的文件")
+	fs.Parse(args)
+
+	db, err := ConnectDatabase(AppConfig().Database)
+	if err != nil {
+		return fmt.Errorf("数据库初始化失败: %w", err)
+	}
+	query := db.Model(&File{}).Select("id", "access_code", "filename", "size_bytes", "original_size_bytes", "compressed", "expires_at", "tags")
+	if !*all {
+		query = query.Where("expires_at > ?", time.Now())
+	}
+	for _, tag := range tagFilters {
+		query = whereTag(query, tag[0], tag[1])
+	}
+
+	var count int
+	var batch []File
+	result := query.FindInBatches(&batch, migrateBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, file := range batch {
+			tags := file.tags()
+			pairs := make([]string, 0, len(tags))
+			for k, v := range tags {
+				pairs = append(pairs, k+"="+v)
+			}
+			sort.Strings(pairs)
+			fmt.Printf("%s\t%s\t%d\t%s\t%s\n", file.AccessCode, file.Filename, file.contentLength(),
+				file.ExpiresAt.UTC().Format(time.RFC3339), strings.Join(pairs, ","))
+			count++
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return fmt.Errorf("查询文件记录失败: %w", result.Error)
+	}
+	slog.Info("文件列表查询完成", "count", count)
+	return nil
+}
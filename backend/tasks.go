@@ -2,38 +2,52 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io/fs"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
 	"time"
 
 	"gorm.io/gorm"
 )
 
-// CleanupExpiredFilesTask 接收 db 和 storage 实例
-func CleanupExpiredFilesTask(db *gorm.DB, storage FileStorage) {
-	ticker := time.NewTicker(10 * time.Minute)
+// cleanupInterval 是过期文件清理任务的运行间隔
+const cleanupInterval = 10 * time.Minute
+
+// CleanupExpiredFilesTask 接收 db、storage 和 quota 实例
+func CleanupExpiredFilesTask(db *gorm.DB, storage FileStorage, quota *StorageQuota) {
+	ticker := time.NewTicker(cleanupInterval)
 	defer ticker.Stop()
 
 	// 首次运行前先执行一次
-	cleanup(db, storage)
+	cleanup(db, storage, quota)
 
 	for {
 		<-ticker.C
-		cleanup(db, storage)
+		cleanup(db, storage, quota)
 	}
 }
 
-func cleanup(db *gorm.DB, storage FileStorage) {
+func cleanup(db *gorm.DB, storage FileStorage, quota *StorageQuota) {
 	slog.Info("开始执行过期文件清理任务...")
 
 	const batchSize = 100
 	var deletedCount int64
+	// 本轮删除失败的记录保留到下一轮重试，本轮内不再查询，避免死循环
+	var failedIDs []string
 
 	for {
 		var expiredFiles []File
 
 		// 查询时只选择必要的字段
-		result := db.Select("id", "storage_key", "access_code", "filename").
-			Where("expires_at <= ?", time.Now()).Limit(batchSize).Find(&expiredFiles)
+		query := db.Select("id", "storage_key", "access_code", "filename", "size_bytes").Where("expires_at <= ?", time.Now())
+		if len(failedIDs) > 0 {
+			query = query.Where("id NOT IN ?", failedIDs)
+		}
+		result := query.Limit(batchSize).Find(&expiredFiles)
 
 		if result.Error != nil {
 			slog.Error("清理任务错误: 查询批次失败", "error", result.Error)
@@ -45,25 +59,210 @@ func cleanup(db *gorm.DB, storage FileStorage) {
 		}
 
 		for _, file := range expiredFiles {
-			// 先删除物理文件/对象
-			if err := storage.Delete(file.StorageKey); err != nil {
-				slog.Error("清理错误: 删除存储对象失败", "key", file.StorageKey, "error", err)
-				// 即使物理文件删除失败，也继续尝试删除数据库记录，避免无限重试
-			}
-
-			// 再删除数据库记录
-			if err := db.Delete(&File{}, "id = ?", file.ID).Error; err != nil {
-				slog.Error("清理错误: 删除数据库记录失败", "id", file.ID, "error", err)
-			} else {
-				slog.Info("已清理过期文件", "id", file.ID, "accessCode", file.AccessCode, "filename", file.Filename)
-				deletedCount++
+			if err := purgeFile(context.Background(), db, storage, quota, file); err != nil {
+				slog.Error("清理错误: 删除过期文件失败，将在下一轮重试", "id", file.ID, "error", err)
+				failedIDs = append(failedIDs, file.ID)
+				continue
 			}
+			slog.Info("已清理过期文件", "id", file.ID, "accessCode", file.AccessCode, "filename", file.Filename)
+			deletedCount++
 		}
 	}
 
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&UploadIdempotencyKey{}).Error; err != nil {
+		slog.Error("清理任务错误: 删除过期幂等记录失败", "error", err)
+	}
+
 	if deletedCount > 0 {
 		slog.Info("本轮清理任务完成", "deletedCount", deletedCount)
 	} else {
 		slog.Info("清理完成，没有发现新的过期文件。")
 	}
 }
+
+// purgeFile 先删除存储对象，成功后再删除数据库记录并释放配额。存储删除失败时保留记录，
+// 文件已过期因而无法再被下载，由下一轮清理重试，不会留下无人管理的存储对象。
+// 各存储后端删除不存在的对象都视为成功，因此对象已丢失的记录不会被反复重试
+func purgeFile(ctx context.Context, db *gorm.DB, storage FileStorage, quota *StorageQuota, file File) error {
+	if err := storage.Delete(ctx, file.StorageKey); err != nil {
+		return fmt.Errorf("删除存储对象失败: %w", err)
+	}
+	result := db.Delete(&File{}, "id = ?", file.ID)
+	if result.Error != nil {
+		return fmt.Errorf("删除数据库记录失败: %w", result.Error)
+	}
+	fileCache.Invalidate(file.AccessCode)
+	// 记录可能已被并发的清理删除，只释放一次配额
+	if result.RowsAffected > 0 {
+		quota.Release(file.SizeBytes)
+	}
+	return nil
+}
+
+// CleanupStaleScanFilesTask 在启动时以及之后每 10 分钟清理临时扫描目录中超过 maxAge 的残留文件，
+// 这些文件通常来自上传或扫描过程中崩溃的进程。本进程仍在使用的文件 (见 activeScanFiles) 不会被删除
+func CleanupStaleScanFilesTask(dir string, maxAge time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	cleanupStaleScanFiles(dir, maxAge)
+
+	for {
+		<-ticker.C
+		cleanupStaleScanFiles(dir, maxAge)
+	}
+}
+
+func cleanupStaleScanFiles(dir string, maxAge time.Duration) {
+	cutoff := time.Now().Add(-maxAge)
+	var removedCount int
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, inUse := activeScanFiles.Load(path); inUse {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			slog.Error("清理错误: 删除残留扫描文件失败", "path", path, "error", err)
+			return nil
+		}
+		slog.Info("已清理残留扫描文件", "path", path, "sizeBytes", info.Size())
+		removedCount++
+		return nil
+	})
+	if err != nil {
+		slog.Error("清理错误: 遍历临时扫描目录失败", "path", dir, "error", err)
+	}
+	if removedCount > 0 {
+		slog.Info("残留扫描文件清理完成", "removedCount", removedCount)
+	}
+}
+
+// RescanFilesTask 定期重新扫描因扫描器不可用而处于 pending/error/skipped 状态的文件
+func RescanFilesTask(db *gorm.DB, storage FileStorage, scanner Scanner, alerts *AlertNotifier, config ScanRetryConfig) {
+	ticker := time.NewTicker(time.Duration(config.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		rescan(db, storage, scanner, alerts, config)
+	}
+}
+
+// scanRetryStatuses 是需要重扫的扫描状态
+var scanRetryStatuses = []string{ScanStatusPending, ScanStatusError, ScanStatusSkipped}
+
+// nextScanDelay 返回第 attempts 次重扫失败后到下一次重扫的等待时间，按 BackoffMinutes 指数增长，最长一天
+func nextScanDelay(config ScanRetryConfig, attempts int) time.Duration {
+	delay := time.Duration(config.BackoffMinutes) * time.Minute
+	for i := 1; i < attempts && delay < 24*time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, 24*time.Hour)
+}
+
+func rescan(db *gorm.DB, storage FileStorage, scanner Scanner, alerts *AlertNotifier, config ScanRetryConfig) {
+	if !scanner.Available() {
+		slog.Info("重扫任务: 扫描器仍不可用，跳过本轮")
+		return
+	}
+
+	const batchSize = 20
+	const scanInterval = 2 * time.Second // 两次扫描之间的间隔，避免压垮 clamd
+
+	now := time.Now()
+	var files []File
+	query := db.Select("id", "storage_key", "access_code", "size_bytes", "compressed", "original_size_bytes", "expires_at", "scan_attempts").
+		Where("scan_status IN ? AND expires_at > ?", scanRetryStatuses, now).
+		Where("next_scan_at IS NULL OR next_scan_at <= ?", now)
+	if config.MaxAttempts > 0 {
+		query = query.Where("scan_attempts < ?", config.MaxAttempts)
+	}
+	if !AppConfig().ScanEncryptedBlobs {
+		query = query.Where("is_encrypted = ?", false)
+	}
+	if maxScanBytes := AppConfig().MaxScanSizeMB * 1024 * 1024; maxScanBytes > 0 {
+		// 超过扫描上限的文件即使重扫也会被跳过。扫描的是解压后的内容，压缩存储的文件按原始大小比较
+		query = query.Where("CASE WHEN compressed THEN original_size_bytes ELSE size_bytes END <= ?", maxScanBytes)
+	}
+	if err := query.Order("created_at asc").Limit(batchSize).Find(&files).Error; err != nil {
+		slog.Error("重扫任务错误: 查询待扫描文件失败", "error", err)
+		return
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	slog.Info("开始重新扫描文件", "count", len(files))
+	var rescannedCount int
+	for i, file := range files {
+		if i > 0 {
+			time.Sleep(scanInterval)
+		}
+
+		updates := map[string]interface{}{}
+		status, result, err := rescanFile(storage, scanner, file)
+		if err != nil {
+			slog.Error("重扫错误: 无法从存储后端获取文件", "key", file.StorageKey, "error", err)
+		} else if status == ScanStatusError && !scanner.Available() {
+			slog.Warn("重扫任务: 扫描器再次不可用，提前结束本轮")
+			break
+		} else {
+			updates["scan_status"], updates["scan_result"] = status, result
+		}
+
+		// 重扫后仍未得到结论 (或无法读取文件) 时计入重试次数并推迟下一次重扫
+		if err != nil || slices.Contains(scanRetryStatuses, status) {
+			attempts := file.ScanAttempts + 1
+			updates["scan_attempts"] = attempts
+			updates["next_scan_at"] = time.Now().Add(nextScanDelay(config, attempts))
+			if config.MaxAttempts > 0 && attempts >= config.MaxAttempts {
+				slog.Warn("重扫任务: 文件重试次数已达上限，不再重扫", "accessCode", file.AccessCode, "attempts", attempts, "scanStatus", status)
+			}
+		}
+
+		if err := db.Model(&File{}).Where("id = ?", file.ID).Updates(updates).Error; err != nil {
+			slog.Error("重扫错误: 更新扫描状态失败", "id", file.ID, "error", err)
+			continue
+		}
+		fileCache.Invalidate(file.AccessCode)
+		if status == ScanStatusInfected {
+			if err := QuarantineFile(context.Background(), db, storage, file); err != nil {
+				slog.Error("重扫错误: 隔离被感染文件失败", "id", file.ID, "error", err)
+			}
+			alerts.NotifyInfected(InfectionAlert{AccessCode: file.AccessCode, VirusName: result, Source: "rescan"})
+		}
+		if err == nil {
+			slog.Info("已重新扫描文件", "accessCode", file.AccessCode, "scanStatus", status)
+			rescannedCount++
+		}
+	}
+	slog.Info("本轮重扫任务完成", "rescannedCount", rescannedCount)
+}
+
+// rescanFile 从存储中读取对象 (压缩存储的先解压) 并以数据流方式交给扫描器
+func rescanFile(storage FileStorage, scanner Scanner, file File) (string, string, error) {
+	reader, err := retrieveFile(context.Background(), storage, file)
+	if err != nil {
+		return "", "", err
+	}
+	defer reader.Close()
+
+	status, result := scanner.ScanStream(context.Background(), reader)
+	return status, result, nil
+}
@@ -0,0 +1,174 @@
+// backend/tasks_test.go
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eicarSignature = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// eicarScanner 是只识别 EICAR 测试字符串的扫描器，记录扫描过的内容
+type eicarScanner struct {
+	scanned []string
+}
+
+func (s *eicarScanner) ScanFile(ctx context.Context, filePath string) (string, string) {
+	return ScanStatusError, "不支持扫描文件路径"
+}
+
+func (s *eicarScanner) ScanStream(ctx context.Context, reader io.Reader) (string, string) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return ScanStatusError, err.Error()
+	}
+	s.scanned = append(s.scanned, string(data))
+	if strings.Contains(string(data), eicarSignature) {
+		return ScanStatusInfected, "Eicar-Test-Signature"
+	}
+	return ScanStatusClean, "文件安全"
+}
+
+func (s *eicarScanner) Available() bool { return true }
+
+func TestRescanCompressedFile(t *testing.T) {
+	withTestConfig(t, func(c *Config) { c.MaxScanSizeMB = 1 })
+	db := newTestDB(t, &File{})
+	storage, err := NewLocalStorage(StorageConfig{LocalPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+
+	// 压缩后的大小远小于扫描上限，但解压后超过上限的文件不应重扫
+	files := []File{
+		{ID: "eicar", AccessCode: "EICAR1", Filename: "eicar.txt", OriginalSizeBytes: int64(len(eicarSignature))},
+		{ID: "large", AccessCode: "LARGE1", Filename: "large.log", OriginalSizeBytes: 2 * 1024 * 1024},
+	}
+	contents := map[string]string{"eicar": eicarSignature, "large": strings.Repeat("a", 2*1024*1024)}
+	for i := range files {
+		files[i].StorageKey = files[i].ID
+		files[i].Compressed = true
+		files[i].ScanStatus = ScanStatusPending
+		files[i].ExpiresAt = time.Now().Add(time.Hour)
+		n, err := gzipStorage{storage}.Save(context.Background(), files[i].StorageKey, strings.NewReader(contents[files[i].ID]))
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		files[i].SizeBytes = n
+		if err := db.Create(&files[i]).Error; err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	scanner := &eicarScanner{}
+	rescan(db, storage, scanner, nil, ScanRetryConfig{BackoffMinutes: 1})
+
+	if len(scanner.scanned) != 1 {
+		t.Fatalf("扫描了 %d 个文件, want 1", len(scanner.scanned))
+	}
+	if scanner.scanned[0] != eicarSignature {
+		t.Fatalf("扫描器收到的不是解压后的内容: %q", scanner.scanned[0][:min(len(scanner.scanned[0]), 16)])
+	}
+	var eicar, large File
+	db.First(&eicar, "id = ?", "eicar")
+	db.First(&large, "id = ?", "large")
+	if eicar.ScanStatus != ScanStatusInfected || eicar.ScanResult != "Eicar-Test-Signature" {
+		t.Fatalf("EICAR 文件扫描结果 = %s/%s, want infected", eicar.ScanStatus, eicar.ScanResult)
+	}
+	if eicar.StorageKey == "eicar" || storage.Exists("eicar") {
+		t.Fatalf("被感染文件没有移入隔离区: key=%s", eicar.StorageKey)
+	}
+	if large.ScanStatus != ScanStatusPending || large.ScanAttempts != 0 {
+		t.Fatalf("超过扫描上限的文件被重扫: %s, attempts %d", large.ScanStatus, large.ScanAttempts)
+	}
+}
+
+func TestNextScanDelay(t *testing.T) {
+	config := ScanRetryConfig{BackoffMinutes: 5}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{3, 20 * time.Minute},
+		{9, 1280 * time.Minute},
+		{10, 24 * time.Hour}, // 5 分钟 * 2^9 超过一天，取上限
+		{1000, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := nextScanDelay(config, tt.attempts); got != tt.want {
+			t.Errorf("nextScanDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// failingScanner 始终返回扫描出错，但报告自己可用，模拟 clamd 对某个文件持续失败
+type failingScanner struct {
+	calls int
+}
+
+func (s *failingScanner) ScanFile(ctx context.Context, filePath string) (string, string) {
+	s.calls++
+	return ScanStatusError, "Clamd扫描通信失败"
+}
+
+func (s *failingScanner) ScanStream(ctx context.Context, reader io.Reader) (string, string) {
+	s.calls++
+	return ScanStatusError, "Clamd扫描通信失败"
+}
+
+func (s *failingScanner) Available() bool { return true }
+
+func TestRescanBackoffAndAttemptCap(t *testing.T) {
+	withTestConfig(t, nil)
+	db := newTestDB(t, &File{})
+	storage, err := NewLocalStorage(StorageConfig{LocalPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	if _, err := storage.Save(context.Background(), "key", strings.NewReader("data")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	file := File{ID: "id", AccessCode: "ABC123", StorageKey: "key", SizeBytes: 4, ScanStatus: ScanStatusError, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	config := ScanRetryConfig{MaxAttempts: 2, BackoffMinutes: 10}
+	scanner := &failingScanner{}
+	// dueNow 让下一次重扫时间立即到期，模拟等待了退避时间
+	dueNow := func() {
+		db.Model(&File{}).Where("id = ?", file.ID).Update("next_scan_at", time.Now().Add(-time.Second))
+	}
+
+	for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
+		before := time.Now()
+		rescan(db, storage, scanner, nil, config)
+		var got File
+		db.First(&got, "id = ?", file.ID)
+		if scanner.calls != attempt || got.ScanAttempts != attempt {
+			t.Fatalf("第 %d 轮: calls=%d, attempts=%d", attempt, scanner.calls, got.ScanAttempts)
+		}
+		wantNext := before.Add(nextScanDelay(config, attempt))
+		if got.NextScanAt == nil || got.NextScanAt.Before(wantNext) || got.NextScanAt.After(wantNext.Add(time.Minute)) {
+			t.Fatalf("第 %d 轮: NextScanAt = %v, want 约 %v", attempt, got.NextScanAt, wantNext)
+		}
+
+		// 退避时间未到时不重扫
+		rescan(db, storage, scanner, nil, config)
+		if scanner.calls != attempt {
+			t.Fatalf("第 %d 轮: 退避时间内再次重扫", attempt)
+		}
+		dueNow()
+	}
+
+	// 达到 MaxAttempts 后即使到期也不再重扫
+	rescan(db, storage, scanner, nil, config)
+	if scanner.calls != config.MaxAttempts {
+		t.Fatalf("达到重试上限后仍在重扫: calls=%d", scanner.calls)
+	}
+}
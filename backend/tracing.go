@@ -0,0 +1,240 @@
+// backend/tracing.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tracer 创建存储、数据库和扫描的子 span。未启用 Tracing 时全局 TracerProvider 为 no-op，
+// 创建 span 几乎没有开销
+var tracer = otel.Tracer("tempshare")
+
+// tracingShutdownTimeout 是退出时等待剩余 span 导出的最长时间
+const tracingShutdownTimeout = 5 * time.Second
+
+// tracingEndpointURL 把 Tracing.Endpoint 规范化为 OTLP/HTTP 的完整地址，未指定路径时使用标准的 /v1/traces
+func tracingEndpointURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("Tracing.Endpoint 必须是 http:// 或 https:// 开头的 OTLP/HTTP 地址，当前为 %q", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// InitTracing 按配置创建通过 OTLP/HTTP 导出 span 的 TracerProvider 并设为全局，同时启用 W3C Trace Context 传播。
+// 未启用时什么也不做。收到 SIGINT/SIGTERM 时先导出剩余的 span 再退出
+func InitTracing(config TracingConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	endpoint, err := tracingEndpointURL(config.Endpoint)
+	if err != nil {
+		return err
+	}
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return fmt.Errorf("无法创建 OTLP 导出器: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", config.ServiceName)))
+	if err != nil {
+		return fmt.Errorf("无法创建追踪资源: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Error("导出剩余的追踪数据失败", "error", err)
+		}
+		os.Exit(0)
+	}()
+
+	slog.Info("已启用 OpenTelemetry 追踪", "endpoint", endpoint, "serviceName", config.ServiceName, "sampleRatio", config.SampleRatio)
+	return nil
+}
+
+// TracingMiddleware 为每个请求创建服务端 span，并从请求头中提取上游的 trace context。
+// span 保存在 c.Request 的 ctx 中，处理函数传给存储、数据库和扫描器的 ctx 都会带上它。/health 和 /metrics 不记录
+func TracingMiddleware(serviceName string) gin.HandlerFunc {
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/health" && r.URL.Path != "/metrics"
+	}))
+}
+
+// endSpan 记录错误 (对象或记录不存在不算错误) 并结束 span
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceScan 为一次扫描创建子 span (包括等待扫描名额的时间)，记录扫描状态，扫描出错时标记为错误
+func traceScan(ctx context.Context, name string, scan func(ctx context.Context) (string, string)) (string, string) {
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	status, result := scan(ctx)
+	span.SetAttributes(attribute.String("scan.status", status))
+	if status == ScanStatusError {
+		span.SetStatus(codes.Error, result)
+	}
+	return status, result
+}
+
+// --- Tracing Decorator ---
+// tracingStorage 为每次存储操作创建子 span。它包在重试装饰器外面，一个 span 覆盖包括重试在内的整个操作
+type tracingStorage struct {
+	FileStorage
+	backend string
+}
+
+func (t *tracingStorage) start(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "storage."+op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("storage.backend", t.backend), attribute.String("storage.key", key)))
+}
+
+func (t *tracingStorage) Save(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	ctx, span := t.start(ctx, "Save", key)
+	n, err := t.FileStorage.Save(ctx, key, reader)
+	span.SetAttributes(attribute.Int64("storage.bytes", n))
+	endSpan(span, err)
+	return n, err
+}
+
+// Retrieve 的 span 持续到调用方关闭返回的流，覆盖整个读取过程
+func (t *tracingStorage) Retrieve(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, span := t.start(ctx, "Retrieve", key)
+	rc, err := t.FileStorage.Retrieve(ctx, key)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &tracedReadCloser{ReadCloser: rc, span: span}, nil
+}
+
+func (t *tracingStorage) Size(ctx context.Context, key string) (int64, error) {
+	ctx, span := t.start(ctx, "Size", key)
+	n, err := t.FileStorage.Size(ctx, key)
+	endSpan(span, err)
+	return n, err
+}
+
+func (t *tracingStorage) Delete(ctx context.Context, key string) error {
+	ctx, span := t.start(ctx, "Delete", key)
+	err := t.FileStorage.Delete(ctx, key)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingStorage) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	ctx, span := t.start(ctx, "Walk", prefix)
+	err := t.FileStorage.Walk(ctx, prefix, fn)
+	endSpan(span, err)
+	return err
+}
+
+// tracedReadCloser 统计读取的字节数，关闭时结束 Retrieve 的 span
+type tracedReadCloser struct {
+	io.ReadCloser
+	span trace.Span
+	n    int64
+	err  error
+}
+
+func (r *tracedReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *tracedReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.span.SetAttributes(attribute.Int64("storage.bytes", r.n))
+	endSpan(r.span, r.err)
+	return err
+}
+
+// gormSpanKey 是保存当前语句 span 的 gorm 实例键
+const gormSpanKey = "tempshare:otel_span"
+
+// registerGormTracing 为每条 SQL 语句创建子 span。父 span 取自 db.WithContext 传入的 ctx (见 FileHandler.db)，
+// span 中只记录带占位符的 SQL，不记录参数值
+func registerGormTracing(db *gorm.DB) error {
+	before := func(op string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			ctx, span := tracer.Start(tx.Statement.Context, "gorm."+op, trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attribute.String("db.system", tx.Dialector.Name())))
+			tx.Statement.Context = ctx
+			tx.InstanceSet(gormSpanKey, span)
+		}
+	}
+	after := func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(gormSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		span.SetAttributes(
+			attribute.String("db.statement", tx.Statement.SQL.String()),
+			attribute.String("db.table", tx.Statement.Table),
+			attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+		)
+		endSpan(span, tx.Error)
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("otel:before_create", before("create")),
+		callbacks.Create().After("gorm:create").Register("otel:after_create", after),
+		callbacks.Query().Before("gorm:query").Register("otel:before_query", before("query")),
+		callbacks.Query().After("gorm:query").Register("otel:after_query", after),
+		callbacks.Update().Before("gorm:update").Register("otel:before_update", before("update")),
+		callbacks.Update().After("gorm:update").Register("otel:after_update", after),
+		callbacks.Delete().Before("gorm:delete").Register("otel:before_delete", before("delete")),
+		callbacks.Delete().After("gorm:delete").Register("otel:after_delete", after),
+		callbacks.Row().Before("gorm:row").Register("otel:before_row", before("row")),
+		callbacks.Row().After("gorm:row").Register("otel:after_row", after),
+		callbacks.Raw().Before("gorm:raw").Register("otel:before_raw", before("raw")),
+		callbacks.Raw().After("gorm:raw").Register("otel:after_raw", after),
+	)
+}
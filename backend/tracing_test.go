@@ -0,0 +1,214 @@
+// backend/tracing_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+var (
+	spanExporterOnce sync.Once
+	spanExporter     *tracetest.InMemoryExporter
+)
+
+// recordSpans 把全局 TracerProvider 设为同步导出到内存的 provider (整个测试进程只设置一次)，并清空之前记录的 span
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	spanExporterOnce.Do(func() {
+		spanExporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	spanExporter.Reset()
+	return spanExporter
+}
+
+// spansByName 按名称索引已结束的 span
+func spansByName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestTracingEndpointURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{"http://otel-collector:4318", "http://otel-collector:4318/v1/traces", false},
+		{"https://collector.example.com/", "https://collector.example.com/v1/traces", false},
+		{"http://collector:4318/custom/traces", "http://collector:4318/custom/traces", false},
+		{"otel-collector:4318", "", true},
+		{"grpc://collector:4317", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := tracingEndpointURL(tt.endpoint)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("tracingEndpointURL(%q) = %q, %v; want %q, wantErr %v", tt.endpoint, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTracingStorageSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	local, err := NewLocalStorage(StorageConfig{LocalPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	storage := &tracingStorage{FileStorage: local, backend: "local"}
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	if _, err := storage.Save(ctx, "key", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	rc, err := storage.Retrieve(ctx, "key")
+	if err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	io.Copy(io.Discard, rc)
+	if len(spansByName(exporter)) != 1 {
+		t.Fatal("Retrieve 的 span 应在关闭流之后才结束")
+	}
+	rc.Close()
+	if _, err := storage.Retrieve(ctx, "missing"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("Retrieve(missing) = %v, want gorm.ErrRecordNotFound", err)
+	}
+	parent.End()
+
+	var retrieves []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "storage.Retrieve" {
+			retrieves = append(retrieves, span)
+		}
+		if span.Name != "request" && span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %s 的父 span 不是请求的 span", span.Name)
+		}
+	}
+	save := spansByName(exporter)["storage.Save"]
+	if !hasAttribute(save, "storage.bytes", "5") || !hasAttribute(save, "storage.backend", "local") {
+		t.Errorf("storage.Save 的属性不正确: %v", save.Attributes)
+	}
+	if len(retrieves) != 2 || !hasAttribute(retrieves[0], "storage.bytes", "5") {
+		t.Fatalf("storage.Retrieve spans = %v", retrieves)
+	}
+	for _, span := range retrieves {
+		if span.Status.Code == codes.Error {
+			t.Errorf("对象不存在不应标记为错误: %v", span.Status)
+		}
+	}
+}
+
+func TestGormTracingSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	db := newTestDB(t, &Report{})
+	if err := registerGormTracing(db); err != nil {
+		t.Fatalf("registerGormTracing: %v", err)
+	}
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	if err := db.WithContext(ctx).Create(&Report{AccessCode: "ABC123", Reason: "spam"}).Error; err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var report Report
+	if err := db.WithContext(ctx).Where("access_code = ?", "NOPE").First(&report).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("First = %v, want gorm.ErrRecordNotFound", err)
+	}
+	parent.End()
+
+	spans := spansByName(exporter)
+	for _, name := range []string{"gorm.create", "gorm.query"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("缺少 span %s, got %v", name, spans)
+		}
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %s 的父 span 不是请求的 span", name)
+		}
+		if span.Status.Code == codes.Error {
+			t.Errorf("span %s 不应标记为错误: %v", name, span.Status)
+		}
+	}
+	if query := spans["gorm.query"]; !hasAttribute(query, "db.table", "reports") ||
+		strings.Contains(attributeValue(query, "db.statement"), "NOPE") {
+		t.Errorf("gorm.query 的属性不正确 (不应包含参数值): %v", query.Attributes)
+	}
+}
+
+func TestTracingMiddlewarePropagatesContext(t *testing.T) {
+	exporter := recordSpans(t)
+	router := gin.New()
+	router.Use(TracingMiddleware("tempshare-test"), RequestIDMiddleware())
+	var handlerSpan trace.SpanContext
+	router.GET("/api/v1/info", func(c *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+	router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/info", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	req.Header.Set(requestIDHeader, "req-123")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if handlerSpan.TraceID().String() != traceID {
+		t.Fatalf("处理函数中的 trace ID = %s, want %s", handlerSpan.TraceID(), traceID)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("应只记录 1 个 span (/health 不记录), got %d", len(spans))
+	}
+	if !hasAttribute(spans[0], "request.id", "req-123") {
+		t.Errorf("请求 span 缺少 request.id: %v", spans[0].Attributes)
+	}
+}
+
+func TestTraceScanMarksErrors(t *testing.T) {
+	exporter := recordSpans(t)
+	traceScan(context.Background(), "clamd.ScanStream", func(ctx context.Context) (string, string) {
+		return ScanStatusError, "Clamd扫描通信失败"
+	})
+	traceScan(context.Background(), "clamd.ScanFile", func(ctx context.Context) (string, string) {
+		return ScanStatusClean, "文件安全"
+	})
+	spans := spansByName(exporter)
+	if spans["clamd.ScanStream"].Status.Code != codes.Error || !hasAttribute(spans["clamd.ScanStream"], "scan.status", ScanStatusError) {
+		t.Errorf("扫描出错的 span 不正确: %+v", spans["clamd.ScanStream"])
+	}
+	if spans["clamd.ScanFile"].Status.Code == codes.Error || !hasAttribute(spans["clamd.ScanFile"], "scan.status", ScanStatusClean) {
+		t.Errorf("扫描成功的 span 不正确: %+v", spans["clamd.ScanFile"])
+	}
+}
+
+func attributeValue(span tracetest.SpanStub, key string) string {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func hasAttribute(span tracetest.SpanStub, key, value string) bool {
+	return attributeValue(span, key) == value
+}
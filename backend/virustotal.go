@@ -0,0 +1,255 @@
+// backend/virustotal.go
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	virusTotalAPIBase = "https://www.virustotal.com/api/v3"
+	// VirusTotal 公共 API 直接上传的文件大小上限
+	virusTotalMaxUploadBytes = 32 * 1024 * 1024
+	virusTotalPollInterval   = 15 * time.Second
+)
+
+// errVirusTotalNotFound 表示 VirusTotal 中没有该哈希的分析记录
+var errVirusTotalNotFound = errors.New("VirusTotal 中没有该文件的记录")
+
+// VirusTotalScanner 通过 SHA-256 查询 VirusTotal，未知文件可选择上传并轮询分析结果
+type VirusTotalScanner struct {
+	apiKey        string
+	uploadUnknown bool
+	pollTimeout   time.Duration
+	client        *http.Client
+	limiter       *rate.Limiter
+}
+
+// virusTotalStats 对应 API 返回的 last_analysis_stats / stats 字段
+type virusTotalStats struct {
+	Malicious  int `json:"malicious"`
+	Suspicious int `json:"suspicious"`
+}
+
+type virusTotalEngineResult struct {
+	Category string `json:"category"`
+	Result   string `json:"result"`
+}
+
+// NewVirusTotalScanner 根据配置创建扫描器，请求速率受 RequestsPerMinute 限制
+func NewVirusTotalScanner(config VirusTotalConfig) *VirusTotalScanner {
+	perMinute := config.RequestsPerMinute
+	if perMinute <= 0 {
+		perMinute = 4 // 公共 API 的默认配额
+	}
+	pollTimeout := time.Duration(config.PollTimeoutSeconds) * time.Second
+	if pollTimeout <= 0 {
+		pollTimeout = time.Minute
+	}
+	slog.Info("已启用 VirusTotal 扫描", "requestsPerMinute", perMinute, "uploadUnknown", config.UploadUnknown)
+	return &VirusTotalScanner{
+		apiKey:        config.APIKey,
+		uploadUnknown: config.UploadUnknown,
+		pollTimeout:   pollTimeout,
+		client:        &http.Client{Timeout: 60 * time.Second},
+		limiter:       rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), 1),
+	}
+}
+
+func (v *VirusTotalScanner) ScanFile(ctx context.Context, filePath string) (string, string) {
+	hash, size, err := sha256File(filePath)
+	if err != nil {
+		loggerFromContext(ctx).Error("VirusTotal 扫描错误: 无法计算文件哈希", "component", "virustotal", "path", filePath, "error", err)
+		return ScanStatusError, "无法计算文件哈希"
+	}
+
+	loggerFromContext(ctx).Info("开始查询 VirusTotal", "component", "virustotal", "sha256", hash)
+	stats, results, err := v.lookup(ctx, hash)
+	if errors.Is(err, errVirusTotalNotFound) {
+		if !v.uploadUnknown {
+			return ScanStatusSkipped, "VirusTotal 中没有该文件的记录"
+		}
+		if size > virusTotalMaxUploadBytes {
+			return ScanStatusSkipped, "文件超过 VirusTotal 上传上限，已跳过"
+		}
+		stats, results, err = v.uploadAndPoll(ctx, filePath)
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			// 分析尚未完成，保持 pending 让后台重扫任务稍后再查
+			loggerFromContext(ctx).Info("VirusTotal 分析尚未完成", "component", "virustotal", "sha256", hash)
+			return ScanStatusPending, "VirusTotal 分析中"
+		}
+		loggerFromContext(ctx).Error("VirusTotal 扫描通信出错", "component", "virustotal", "error", err)
+		return ScanStatusError, "VirusTotal 扫描通信失败"
+	}
+	return virusTotalVerdict(ctx, hash, stats, results)
+}
+
+// ScanStream 需要完整文件来计算哈希和上传，因此先写入临时文件
+func (v *VirusTotalScanner) ScanStream(ctx context.Context, reader io.Reader) (string, string) {
+	return scanStreamViaTempFile(ctx, v, reader)
+}
+
+// Available 报告是否配置了 API Key。VirusTotal 的可用性在每次请求时处理
+func (v *VirusTotalScanner) Available() bool {
+	return v != nil && v.apiKey != ""
+}
+
+// virusTotalVerdict 将 VirusTotal 的统计结果转换为扫描状态
+func virusTotalVerdict(ctx context.Context, hash string, stats virusTotalStats, results map[string]virusTotalEngineResult) (string, string) {
+	if stats.Malicious == 0 {
+		loggerFromContext(ctx).Info("VirusTotal 扫描完成，文件安全", "component", "virustotal", "sha256", hash, "suspicious", stats.Suspicious)
+		return ScanStatusClean, "文件安全 (VirusTotal)"
+	}
+	virusName := "VirusTotal"
+	for _, r := range results {
+		if r.Category == "malicious" && r.Result != "" {
+			virusName = r.Result
+			break
+		}
+	}
+	loggerFromContext(ctx).Warn("危险! VirusTotal 报告文件为恶意", "component", "virustotal", "sha256", hash, "malicious", stats.Malicious, "virus", virusName)
+	return ScanStatusInfected, fmt.Sprintf("%s (%d 个引擎检出)", virusName, stats.Malicious)
+}
+
+// lookup 按 SHA-256 查询已有的分析报告
+func (v *VirusTotalScanner) lookup(ctx context.Context, hash string) (virusTotalStats, map[string]virusTotalEngineResult, error) {
+	var body struct {
+		Data struct {
+			Attributes struct {
+				Stats   virusTotalStats                   `json:"last_analysis_stats"`
+				Results map[string]virusTotalEngineResult `json:"last_analysis_results"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := v.do(context.WithoutCancel(ctx), http.MethodGet, "/files/"+hash, nil, "", &body); err != nil {
+		return virusTotalStats{}, nil, err
+	}
+	return body.Data.Attributes.Stats, body.Data.Attributes.Results, nil
+}
+
+// uploadAndPoll 上传未知文件并轮询分析结果，超过 pollTimeout 返回 context.DeadlineExceeded
+func (v *VirusTotalScanner) uploadAndPoll(ctx context.Context, filePath string) (virusTotalStats, map[string]virusTotalEngineResult, error) {
+	// 扫描可能在请求结束后继续 (后台重扫等)，只沿用 ctx 中的 logger，不继承其取消信号
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), v.pollTimeout)
+	defer cancel()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return virusTotalStats{}, nil, err
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	defer pr.Close() // 请求提前失败时让写入协程退出
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", filepath.Base(filePath))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	var upload struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodPost, "/files", pr, mw.FormDataContentType(), &upload); err != nil {
+		return virusTotalStats{}, nil, err
+	}
+	loggerFromContext(ctx).Info("已上传文件到 VirusTotal，等待分析结果", "component", "virustotal", "analysisID", upload.Data.ID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return virusTotalStats{}, nil, ctx.Err()
+		case <-time.After(virusTotalPollInterval):
+		}
+
+		var analysis struct {
+			Data struct {
+				Attributes struct {
+					Status  string                            `json:"status"`
+					Stats   virusTotalStats                   `json:"stats"`
+					Results map[string]virusTotalEngineResult `json:"results"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		if err := v.do(ctx, http.MethodGet, "/analyses/"+upload.Data.ID, nil, "", &analysis); err != nil {
+			return virusTotalStats{}, nil, err
+		}
+		if analysis.Data.Attributes.Status == "completed" {
+			return analysis.Data.Attributes.Stats, analysis.Data.Attributes.Results, nil
+		}
+	}
+}
+
+// do 在速率限制下发送请求并解析 JSON 响应
+func (v *VirusTotalScanner) do(ctx context.Context, method, path string, body io.Reader, contentType string, out interface{}) error {
+	if err := v.limiter.Wait(ctx); err != nil {
+		// 等待配额会超过截止时间，与超时同样处理
+		return context.DeadlineExceeded
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, virusTotalAPIBase+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-apikey", v.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errVirusTotalNotFound
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return errors.New("VirusTotal 请求配额已用尽")
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("VirusTotal 返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// sha256File 计算文件的 SHA-256 并返回文件大小
+func sha256File(filePath string) (string, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
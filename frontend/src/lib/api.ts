@@ -23,6 +23,7 @@ export interface FileMetadata {
     expiresAt: string;
     scanStatus: 'pending' | 'clean' | 'infected' | 'error' | 'skipped';
     scanResult: string;
+    description?: string;
 }
 
 export interface PublicFileInfo {
@@ -67,6 +68,21 @@ export async function submitReport(accessCode: string, reason: string): Promise<
     return res.json();
 }
 
+export interface ExpiryPreset {
+    value: string;
+    seconds: number;
+    label: string;
+}
+
+// 服务器允许的有效期预设；strict 为 true 时上传只接受这些值
+export async function fetchExpiryPresets(): Promise<{ presets: ExpiryPreset[], strict: boolean, defaultSeconds: number }> {
+    const res = await fetch(`${DIRECT_API_BASE_URL}/api/v1/config/expiry-presets`);
+    if (!res.ok) {
+        throw new Error("无法获取有效期选项");
+    }
+    return res.json();
+}
+
 export async function fetchAppInfo(): Promise<{ publicHost: string }> {
     const res = await fetch(`${DIRECT_API_BASE_URL}/api/v1/info`);
     if (!res.ok) {
@@ -165,6 +165,30 @@ const DownloadPage = () => {
         }
     };
     
+    // 阅后即焚文件需要先 GET 取得确认令牌，再以表单 POST 提交令牌下载，避免链接预览等自动请求消耗唯一的一次下载
+    const handleDownloadOnce = async () => {
+        try {
+            const response = await fetch(`${DIRECT_API_BASE_URL}/data/${accessCode}`);
+            const data = await response.json().catch(() => null);
+            if (!response.ok || !data?.downloadToken) {
+                throw new Error(data?.message || `服务器错误: ${response.statusText}`);
+            }
+            const form = document.createElement('form');
+            form.method = 'POST';
+            form.action = `${DIRECT_API_BASE_URL}/data/${accessCode}`;
+            const input = document.createElement('input');
+            input.type = 'hidden';
+            input.name = 'downloadToken';
+            input.value = data.downloadToken;
+            form.appendChild(input);
+            document.body.appendChild(form);
+            form.submit();
+            form.remove();
+        } catch (err: any) {
+            setError(err.message || "下载失败，请稍后重试。");
+        }
+    };
+    
     const renderContent = () => {
         if (isLoading) { 
             return <DownloadPageSkeleton />;
@@ -188,7 +212,9 @@ const DownloadPage = () => {
         );
             
         const downloadButtonText = meta.isEncrypted ? '解密并下载' : '下载';
-        const downloadAction = meta.isEncrypted ? handleStreamDecryptAndDownload : () => window.location.href = `${DIRECT_API_BASE_URL}/data/${accessCode}`;
+        const downloadAction = meta.isEncrypted ? handleStreamDecryptAndDownload
+            : meta.downloadOnce ? handleDownloadOnce
+            : () => window.location.href = `${DIRECT_API_BASE_URL}/data/${accessCode}`;
 
         return (
             <div className="w-full max-w-6xl mx-auto p-4 md:p-8 grid grid-cols-1 lg:grid-cols-2 gap-8">
@@ -203,6 +229,8 @@ const DownloadPage = () => {
                            <HumanizedCountdown expiresAt={meta.expiresAt} />
                         </div>
                     </div>
+                    {/* 说明是上传者提供的纯文本，交给 React 转义，不能用 dangerouslySetInnerHTML */}
+                    {meta.description && <p className="mt-4 text-brand-dark whitespace-pre-wrap break-words text-center">{meta.description}</p>}
                     
                     {downloadOnceNotice}
                     {infectedWarning && !meta.isEncrypted && <div className="mt-4">{infectedWarning}</div>}
@@ -8,8 +8,8 @@ import { FileText, X, Copy, KeyRound, Plus, Trash2, Repeat, Check, QrCode, Uploa
 import JSZip from 'jszip';
 import { QRCodeSVG } from 'qrcode.react';
 import { E2EE } from '../lib/crypto.ts';
-import type { ShareDetails } from '../lib/api';
-import { DIRECT_API_BASE_URL } from '../lib/api.ts';
+import type { ShareDetails, ExpiryPreset } from '../lib/api';
+import { DIRECT_API_BASE_URL, fetchExpiryPresets } from '../lib/api.ts';
 import UploadProgressCircle from '../components/UploadProgressCircle.tsx';
 import HumanizedCountdown from '../components/HumanizedCountdown.tsx';
 import CodeInput from '../components/CodeInput';
@@ -194,6 +194,14 @@ const InteractiveUploader = ({ onAddFileClick, onAddFolderClick, onCodeSubmit, o
 };
 
 
+const DEFAULT_EXPIRY_PRESETS: ExpiryPreset[] = [
+    { value: '3m', seconds: 180, label: '3分钟' },
+    { value: '10m', seconds: 600, label: '10分钟' },
+    { value: '1h', seconds: 3600, label: '1小时' },
+    { value: '24h', seconds: 86400, label: '24小时' },
+    { value: '7d', seconds: 604800, label: '7天' },
+];
+
 const UploadSettingsPanel = ({
     files, onAddFiles, onRemoveFile, onStartUpload, onCancel,
     usePassword, setUsePassword, password, setPassword, expiry, setExpiry, downloadOnce, setDownloadOnce, isProcessing
@@ -206,6 +214,18 @@ const UploadSettingsPanel = ({
 }) => {
     const totalSize = useMemo(() => files.reduce((acc, file) => acc + file.size, 0), [files]);
     const [tosAccepted, setTosAccepted] = useState(false);
+    const [expiryPresets, setExpiryPresets] = useState<ExpiryPreset[]>(DEFAULT_EXPIRY_PRESETS);
+
+    // 以服务器配置的预设为准，获取失败时保留内置选项
+    useEffect(() => {
+        fetchExpiryPresets().then(({ presets }) => {
+            if (presets.length === 0) return;
+            setExpiryPresets(presets);
+            if (!presets.some(p => p.seconds === expiry)) {
+                setExpiry(presets[0].seconds);
+            }
+        }).catch(() => {});
+    }, []);
 
     const ToggleSwitch = ({ enabled, setEnabled, accentClass = 'bg-brand-cyan' }: { enabled: boolean, setEnabled: (enabled: boolean) => void, accentClass?: string }) => (
         <button type="button" role="switch" aria-checked={enabled} onClick={() => setEnabled(!enabled)} className={`${enabled ? accentClass : 'bg-slate-200'} relative inline-flex h-6 w-11 items-center rounded-full transition-colors`}>
@@ -261,11 +281,7 @@ const UploadSettingsPanel = ({
                 <div className="flex justify-between items-center">
                     <label className="font-semibold">有效期</label>
                     <select value={expiry} onChange={e => setExpiry(Number(e.target.value))} className="bg-black/5 border-none rounded-md font-semibold focus:ring-2 focus:ring-brand-cyan">
-                        <option value={180}>3分钟</option>
-                        <option value={600}>10分钟</option>
-                        <option value={3600}>1小时</option>
-                        <option value={86400}>24小时</option>
-                        <option value={604800}>7天</option>
+                        {expiryPresets.map(p => <option key={p.value} value={p.seconds}>{p.label}</option>)}
                     </select>
                 </div>
             </div>